@@ -0,0 +1,42 @@
+package v1
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types
+const (
+	ConditionReady              = "Ready"
+	ConditionReplicating        = "Replicating"
+	ConditionFailoverInProgress = "FailoverInProgress"
+	ConditionBackupFailed       = "BackupFailed"
+	ConditionSpecInvalid        = "SpecInvalid"
+	ConditionStorageBlocked     = "StorageBlocked"
+	ConditionBootstrapBlocked   = "BootstrapBlocked"
+)
+
+// SetCondition sets the condition of the current generation, returns whether it changed
+func (r *Mysql) SetCondition(conditionType string, status metav1.ConditionStatus, reason, message string) bool {
+	c := meta.FindStatusCondition(r.Status.Conditions, conditionType)
+	if c != nil &&
+		c.Status == status &&
+		c.Reason == reason &&
+		c.Message == message &&
+		c.ObservedGeneration == r.Generation {
+		return false
+	}
+
+	meta.SetStatusCondition(&r.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: r.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+	return true
+}
+
+func (r *Mysql) IsConditionTrue(conditionType string) bool {
+	return meta.IsStatusConditionTrue(r.Status.Conditions, conditionType)
+}
@@ -0,0 +1,140 @@
+package v1
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DynamicVariables can be applied with SET GLOBAL, others need a restart
+var DynamicVariables = map[string]bool{
+	"auto_increment_increment":       true,
+	"auto_increment_offset":          true,
+	"binlog_cache_size":              true,
+	"binlog_expire_logs_seconds":     true,
+	"binlog_row_image":               true,
+	"character_set_server":           true,
+	"collation_server":               true,
+	"connect_timeout":                true,
+	"expire_logs_days":               true,
+	"general_log":                    true,
+	"group_concat_max_len":           true,
+	"innodb_adaptive_hash_index":     true,
+	"innodb_buffer_pool_size":        true,
+	"innodb_flush_log_at_trx_commit": true,
+	"innodb_io_capacity":             true,
+	"innodb_io_capacity_max":         true,
+	"innodb_lock_wait_timeout":       true,
+	"innodb_max_dirty_pages_pct":     true,
+	"innodb_print_all_deadlocks":     true,
+	"innodb_stats_on_metadata":       true,
+	"interactive_timeout":            true,
+	"join_buffer_size":               true,
+	"lock_wait_timeout":              true,
+	"log_output":                     true,
+	"log_queries_not_using_indexes":  true,
+	"long_query_time":                true,
+	"max_allowed_packet":             true,
+	"max_binlog_cache_size":          true,
+	"max_binlog_size":                true,
+	"max_connect_errors":             true,
+	"max_connections":                true,
+	"max_execution_time":             true,
+	"max_heap_table_size":            true,
+	"max_user_connections":           true,
+	"net_read_timeout":               true,
+	"net_write_timeout":              true,
+	"read_buffer_size":               true,
+	"read_rnd_buffer_size":           true,
+	"slow_query_log":                 true,
+	"sort_buffer_size":               true,
+	"sql_mode":                       true,
+	"sync_binlog":                    true,
+	"table_definition_cache":         true,
+	"table_open_cache":               true,
+	"thread_cache_size":              true,
+	"time_zone":                      true,
+	"tmp_table_size":                 true,
+	"transaction_isolation":          true,
+	"wait_timeout":                   true,
+}
+
+// Variables managed by the operator, overriding them would break replication
+var ReservedVariables = map[string]bool{
+	"datadir":                  true,
+	"gtid_mode":                true,
+	"enforce_gtid_consistency": true,
+	"log_bin":                  true,
+	"port":                     true,
+	"read_only":                true,
+	"report_host":              true,
+	"server_id":                true,
+	"socket":                   true,
+	"super_read_only":          true,
+}
+
+var variableRegexp = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// NormalizeVariable lowercases and replaces dashes, as mysqld does for option names
+func NormalizeVariable(k string) string {
+	return strings.ReplaceAll(strings.ToLower(k), "-", "_")
+}
+
+func IsDynamicVariable(k string) bool {
+	return DynamicVariables[NormalizeVariable(k)]
+}
+
+func (spec *MysqlSpec) ValidateMysqlConfig() error {
+	for k, v := range spec.MysqlConfig {
+		n := NormalizeVariable(k)
+		if !variableRegexp.MatchString(n) {
+			return fmt.Errorf("mysql config variable invalid: %s", k)
+		}
+		if ReservedVariables[n] {
+			return fmt.Errorf("mysql config variable reserved: %s", k)
+		}
+		if strings.ContainsAny(v, "\r\n") || HasQuote(v) {
+			return fmt.Errorf("mysql config value invalid: %s", k)
+		}
+	}
+	return nil
+}
+
+// SplitMysqlConfig splits the config into the dynamic and the restart required parts
+func (spec *MysqlSpec) SplitMysqlConfig() (dynamic, static map[string]string) {
+	dynamic = make(map[string]string, len(spec.MysqlConfig))
+	static = make(map[string]string, len(spec.MysqlConfig))
+	for k, v := range spec.MysqlConfig {
+		if IsDynamicVariable(k) {
+			dynamic[k] = v
+		} else {
+			static[k] = v
+		}
+	}
+	return
+}
+
+// HashConfig returns a short stable hash, empty for an empty config
+func HashConfig(m map[string]string) string {
+	if len(m) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{'='})
+		h.Write([]byte(m[k]))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
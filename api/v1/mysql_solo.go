@@ -27,6 +27,24 @@ type MysqlSoloStatus struct {
 
 	//+optional
 	Hang int `json:"hang,omitempty"`
+
+	// Seconds behind the source as reported by mylet, -1 if replication is not running
+	//+optional
+	Lag *int `json:"lag,omitempty"`
+
+	// Hash of the mysql config in effect as reported by mylet
+	//+optional
+	ConfigHash string `json:"configHash,omitempty"`
+
+	// Group replication member state, ONLINE, RECOVERING, OFFLINE, ERROR or UNREACHABLE
+	//+optional
+	MemberState string `json:"memberState,omitempty"`
+	// Group replication member role, PRIMARY or SECONDARY
+	//+optional
+	MemberRole string `json:"memberRole,omitempty"`
+	// Transactions waiting for certification on the member
+	//+optional
+	TransactionsInQueue int64 `json:"transactionsInQueue,omitempty"`
 }
 
 type MysqlSoloSpec struct {
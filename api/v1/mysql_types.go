@@ -41,6 +41,7 @@ type MysqlSpec struct {
 	//+optional
 	PrimaryMode string `json:"primaryMode,omitempty"`
 
+	// Changed together with the primary mode, or in the same group mode keeping the size
 	//+kubebuilder:validation:Minimum=1
 	//+kubebuilder:validation:Maximum=9
 	//+kubebuilder:default=1
@@ -61,13 +62,15 @@ type MysqlSpec struct {
 	//+kubebuilder:default=root
 	//+optional
 	LocalUsername string `json:"localUsername,omitempty"`
+	// Defaults to the localPassword key of the operator generated secret
 	//+optional
-	LocalPassword string `json:"localPassword,omitempty"`
+	LocalPasswordSecretRef *corev1.SecretKeySelector `json:"localPasswordSecretRef,omitempty"`
 	//+kubebuilder:default=repl
 	//+optional
 	ReplicaUsername string `json:"replicaUsername,omitempty"`
+	// Defaults to the replicaPassword key of the operator generated secret
 	//+optional
-	ReplicaPassword string `json:"replicaPassword,omitempty"`
+	ReplicaPasswordSecretRef *corev1.SecretKeySelector `json:"replicaPasswordSecretRef,omitempty"`
 
 	//+kubebuilder:default=standard
 	//+optional
@@ -89,6 +92,35 @@ type MysqlSpec struct {
 	//+optional
 	MyletPort int `json:"myletPort,omitempty"`
 
+	// What to do with the mydir volumes when the Mysql is deleted
+	//+kubebuilder:validation:Enum=Retain;Delete;SnapshotThenDelete
+	//+kubebuilder:default=Retain
+	//+optional
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+	// Take a full backup through mylet before teardown, a failed one is retried and the volumes kept,
+	// annotate the Mysql with database.erda.cloud/skip-final-backup: "true" to skip it.
+	// The Delete deletion policy requires the backup storage, the backup is shipped off the volumes
+	//+optional
+	FinalBackup bool `json:"finalBackup,omitempty"`
+	// Used by the SnapshotThenDelete deletion policy
+	//+optional
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+	// Object storage the backups are shipped to, the local ones are kept as well
+	//+optional
+	BackupStorage *MysqlBackupStorage `json:"backupStorage,omitempty"`
+	// Encrypt the backups leaving the volume, plain if nil
+	//+optional
+	BackupEncryption *MysqlBackupEncryption `json:"backupEncryption,omitempty"`
+	// Limits of the local backups, all kept if nil
+	//+optional
+	BackupRetention *MysqlBackupRetention `json:"backupRetention,omitempty"`
+	// How an empty replica is seeded from its source, Clone uses the clone plugin of 8.0.17,
+	// a source without it falls back to Xtrabackup
+	//+kubebuilder:validation:Enum=Xtrabackup;Clone
+	//+kubebuilder:default=Xtrabackup
+	//+optional
+	SeedStrategy string `json:"seedStrategy,omitempty"`
+
 	//+kubebuilder:default=/mydir
 	//+optional
 	Mydir string `json:"mydir,omitempty"`
@@ -114,8 +146,9 @@ type MysqlSpec struct {
 	//+kubebuilder:default=exporter
 	//+optional
 	ExporterUsername string `json:"exporterUsername,omitempty"`
+	// Defaults to the exporterPassword key of the operator generated secret
 	//+optional
-	ExporterPassword string `json:"exporterPassword,omitempty"`
+	ExporterPasswordSecretRef *corev1.SecretKeySelector `json:"exporterPasswordSecretRef,omitempty"`
 
 	//+kubebuilder:default=33061
 	//+optional
@@ -160,6 +193,25 @@ type MysqlSpec struct {
 	// +patchMergeKey=name
 	// +patchStrategy=merge
 	Env []corev1.EnvVar `json:"env,omitempty" patchStrategy:"merge" patchMergeKey:"name" protobuf:"bytes,7,rep,name=env"`
+
+	// Variables rendered into my.cnf.d, the dynamic ones are applied with SET GLOBAL,
+	// changing the others restarts the pods one at a time
+	//+optional
+	MysqlConfig map[string]string `json:"mysqlConfig,omitempty"`
+
+	// Deprecated: plaintext passwords, only read once to seed the generated secret
+	//+optional
+	DeprecatedLocalPassword string `json:"localPassword,omitempty"`
+	//+optional
+	DeprecatedReplicaPassword string `json:"replicaPassword,omitempty"`
+	//+optional
+	DeprecatedExporterPassword string `json:"exporterPassword,omitempty"`
+
+	// Resolved from secrets at runtime, never persisted
+	LocalPassword    string `json:"-"`
+	ReplicaPassword  string `json:"-"`
+	ExporterPassword string `json:"-"`
+	GroupToken       string `json:"-"`
 }
 
 // MysqlStatus defines the observed state of Mysql
@@ -178,6 +230,127 @@ type MysqlStatus struct {
 	WriteId *int `json:"writeId,omitempty"`
 	//+optional
 	ReadId *int `json:"readId,omitempty"`
+	// Solos behind the read service, green and caught up replicas,
+	// or the primary if none
+	//+optional
+	ReadIds []int `json:"readIds,omitempty"`
+
+	// Progress of the rolling upgrade, nil if all pods are up to date
+	//+optional
+	Upgrade *MysqlUpgradeStatus `json:"upgrade,omitempty"`
+
+	// Hash of spec.mysqlConfig, compare with the solo config hashes
+	//+optional
+	ConfigHash string `json:"configHash,omitempty"`
+
+	// Progress of the volume expansion, nil if all claims have the storage size
+	//+optional
+	Storage *MysqlStorageStatus `json:"storage,omitempty"`
+
+	// Progress of the primary mode conversion, nil if none is in progress
+	//+optional
+	Conversion *MysqlConversionStatus `json:"conversion,omitempty"`
+
+	// The MysqlRestore in progress, no failover meanwhile
+	//+optional
+	Restoring string `json:"restoring,omitempty"`
+
+	// The generation observed by the controller
+	//+optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	//+optional
+	//+listType=map
+	//+listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// Phases of the rolling upgrade
+const (
+	UpgradeWaiting           = "Waiting"
+	UpgradeRestartingReplica = "RestartingReplica"
+	UpgradeSwitchover        = "Switchover"
+	UpgradeRestartingPrimary = "RestartingPrimary"
+)
+
+type MysqlUpgradeStatus struct {
+	// The statefulset revision being rolled out
+	Revision string `json:"revision"`
+	//+optional
+	Phase string `json:"phase,omitempty"`
+	// Number of pods running the revision
+	Updated int `json:"updated"`
+	Total   int `json:"total"`
+	// The solo being restarted or switched to
+	//+optional
+	CurrentId *int `json:"currentId,omitempty"`
+	//+optional
+	Message string `json:"message,omitempty"`
+	//+optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+}
+
+// Phases of the volume expansion
+const (
+	StorageExpanding   = "Expanding"
+	StorageResizing    = "Resizing"
+	StorageUnsupported = "Unsupported"
+)
+
+type MysqlStorageStatus struct {
+	// The storage size being expanded to
+	Size resource.Quantity `json:"size"`
+	//+optional
+	Phase string `json:"phase,omitempty"`
+	// Number of claims with the storage size
+	Expanded int `json:"expanded"`
+	Total    int `json:"total"`
+	//+optional
+	Message string `json:"message,omitempty"`
+}
+
+// Phases of the primary mode conversion
+const (
+	ConversionPreparing     = "Preparing"
+	ConversionBootstrapping = "Bootstrapping"
+	ConversionJoining       = "Joining"
+	ConversionDetaching     = "Detaching"
+	ConversionPromoting     = "Promoting"
+	ConversionRepointing    = "Repointing"
+	ConversionFailed        = "Failed"
+)
+
+// MysqlTopology is the part of the spec a conversion changes
+type MysqlTopology struct {
+	PrimaryMode string `json:"primaryMode"`
+	Primaries   int    `json:"primaries"`
+	Replicas    int    `json:"replicas"`
+	PrimaryId   int    `json:"primaryId"`
+}
+
+type MysqlConversionStatus struct {
+	// The topology converted from, set the spec back to it to roll back,
+	// the converted solos are converted back
+	From MysqlTopology `json:"from"`
+	To   MysqlTopology `json:"to"`
+	//+optional
+	Phase string `json:"phase,omitempty"`
+	// Solos converted in order, each one is a rollback point
+	//+optional
+	ConvertedIds []int `json:"convertedIds,omitempty"`
+	// Index of the current step
+	Step  int `json:"step"`
+	Total int `json:"total"`
+	// The solo being converted
+	//+optional
+	CurrentId *int `json:"currentId,omitempty"`
+	//+optional
+	Message string `json:"message,omitempty"`
+	//+optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// When the current solo was asked to convert
+	//+optional
+	RequestTime *metav1.Time `json:"requestTime,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -186,6 +359,7 @@ type MysqlStatus struct {
 //+kubebuilder:printcolumn:name="Primaries",type=integer,JSONPath=`.spec.primaries`
 //+kubebuilder:printcolumn:name="Replicas",type=integer,JSONPath=`.spec.replicas`
 //+kubebuilder:printcolumn:name="Color",type=string,JSONPath=`.status.color`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
 //+kubebuilder:printcolumn:name="WriteId",type=integer,JSONPath=`.status.writeId`
 //+kubebuilder:printcolumn:name="ReadId",type=integer,JSONPath=`.status.readId`
 //+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
@@ -226,12 +400,39 @@ func (r *Mysql) NewLabels() map[string]string {
 	}
 }
 
-const HeadlessSuffix = "x"
+const (
+	HeadlessSuffix = "x"
+	SecretSuffix   = "secret"
+
+	// Pod label selected by the read service, kept by the controller
+	ReadLabel = "database.erda.cloud/read"
+	// Pod template annotation, restarts the pods when the static config changes
+	StaticConfigHashAnnotation = "database.erda.cloud/static-config-hash"
+	// Mysql annotation, "true" skips the final backup of a Mysql being deleted
+	SkipFinalBackupAnnotation = "database.erda.cloud/skip-final-backup"
+)
+
+// Keys of the operator generated secret
+const (
+	LocalPasswordKey    = "localPassword"
+	ReplicaPasswordKey  = "replicaPassword"
+	ExporterPasswordKey = "exporterPassword"
+	GroupTokenKey       = "groupToken"
+)
 
 func (r *Mysql) BuildName(suffix string) string {
 	return r.Name + "-" + suffix
 }
 
+func (spec *MysqlSpec) Topology() MysqlTopology {
+	return MysqlTopology{
+		PrimaryMode: spec.PrimaryMode,
+		Primaries:   spec.Primaries,
+		Replicas:    *spec.Replicas,
+		PrimaryId:   *spec.PrimaryId,
+	}
+}
+
 func (spec *MysqlSpec) Size() int {
 	return spec.Primaries + *spec.Replicas
 }
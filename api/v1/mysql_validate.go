@@ -11,14 +11,28 @@ import (
 	"k8s.io/utils/pointer"
 )
 
-//TODO webhook
-
 const (
 	ModeClassic = "Classic"
 	ModeSingle  = "Single"
 	ModeMulti   = "Multi"
 )
 
+const (
+	DeletionPolicyRetain             = "Retain"
+	DeletionPolicyDelete             = "Delete"
+	DeletionPolicySnapshotThenDelete = "SnapshotThenDelete"
+)
+
+const (
+	SeedStrategyXtrabackup = "Xtrabackup"
+	SeedStrategyClone      = "Clone"
+)
+
+// CloneUsername is the user a recipient clones with, on the donor only
+const CloneUsername = "mylet_clone"
+
+const Finalizer = "database.erda.cloud/finalizer"
+
 func (r *Mysql) Default() {
 	if r.Spec.Version == "" {
 		if runtime.GOARCH == "amd64" {
@@ -66,18 +80,17 @@ func (r *Mysql) Default() {
 		}
 	}
 
-	//TODO secret
 	if r.Spec.LocalUsername == "" {
 		r.Spec.LocalUsername = "root"
 	}
-	if r.Spec.LocalPassword == "" {
-		r.Spec.LocalPassword = GeneratePassword(29)
+	if r.Spec.LocalPasswordSecretRef == nil {
+		r.Spec.LocalPasswordSecretRef = r.NewSecretKeySelector(LocalPasswordKey)
 	}
 	if r.Spec.ReplicaUsername == "" {
 		r.Spec.ReplicaUsername = "repl"
 	}
-	if r.Spec.ReplicaPassword == "" {
-		r.Spec.ReplicaPassword = GeneratePassword(29)
+	if r.Spec.ReplicaPasswordSecretRef == nil {
+		r.Spec.ReplicaPasswordSecretRef = r.NewSecretKeySelector(ReplicaPasswordKey)
 	}
 
 	if r.Spec.StorageClassName == "" {
@@ -107,6 +120,13 @@ func (r *Mysql) Default() {
 		r.Spec.ExporterPort = 9104
 	}
 
+	if r.Spec.DeletionPolicy == "" {
+		r.Spec.DeletionPolicy = DeletionPolicyRetain
+	}
+	if r.Spec.SeedStrategy == "" {
+		r.Spec.SeedStrategy = SeedStrategyXtrabackup
+	}
+
 	if r.Spec.Mydir == "" {
 		r.Spec.Mydir = "/mydir"
 	}
@@ -127,12 +147,57 @@ func (r *Mysql) Default() {
 	if r.Spec.ExporterUsername == "" {
 		r.Spec.ExporterUsername = "exporter"
 	}
-	if r.Spec.ExporterPassword == "" {
-		r.Spec.ExporterPassword = GeneratePassword(29)
+	if r.Spec.ExporterPasswordSecretRef == nil {
+		r.Spec.ExporterPasswordSecretRef = r.NewSecretKeySelector(ExporterPasswordKey)
+	}
+}
+
+func (r *Mysql) NewSecretKeySelector(key string) *corev1.SecretKeySelector {
+	return &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{
+			Name: r.BuildName(SecretSuffix),
+		},
+		Key: key,
+	}
+}
+
+// Validate validates the spec and the credentials resolved from secrets
+func (r *Mysql) Validate() error {
+	if err := r.ValidateSpec(); err != nil {
+		return err
+	}
+	return r.ValidateSecret()
+}
+
+// ValidateSecret validates the credentials resolved from secrets
+func (r *Mysql) ValidateSecret() error {
+	if r.Spec.LocalPassword == "" {
+		return fmt.Errorf("local password required")
+	}
+	if r.Spec.ReplicaPassword == "" {
+		return fmt.Errorf("replica password required")
+	}
+	if r.Spec.GroupToken == "" {
+		return fmt.Errorf("group token required")
+	}
+	if HasQuote(r.Spec.LocalPassword, r.Spec.ReplicaPassword) {
+		return fmt.Errorf("password must not contains any quotation marks")
+	}
+
+	if r.Spec.EnableExporter {
+		if r.Spec.ExporterPassword == "" {
+			return fmt.Errorf("exporter password required")
+		}
+		if HasQuote(r.Spec.ExporterPassword) {
+			return fmt.Errorf("exporter password must not contains any quotation marks")
+		}
 	}
+
+	return nil
 }
 
-func (r *Mysql) Validate() (err error) {
+// ValidateSpec validates the spec only, the status version and solos are normalized
+func (r *Mysql) ValidateSpec() (err error) {
 	r.Status.Version, err = ParseVersion(r.Spec.Version)
 	if err != nil {
 		return err
@@ -178,20 +243,17 @@ func (r *Mysql) Validate() (err error) {
 	if r.Spec.LocalUsername == "" {
 		return fmt.Errorf("local username required")
 	}
-	if r.Spec.LocalPassword == "" {
-		return fmt.Errorf("local password required")
-	}
 	if r.Spec.ReplicaUsername == "" {
 		return fmt.Errorf("replica username required")
 	}
-	if r.Spec.ReplicaPassword == "" {
-		return fmt.Errorf("replica password required")
-	}
 	if r.Spec.LocalUsername == r.Spec.ReplicaUsername {
 		return fmt.Errorf("local username must not equal replica username")
 	}
-	if HasQuote(r.Spec.LocalUsername, r.Spec.LocalPassword, r.Spec.ReplicaUsername, r.Spec.ReplicaPassword) {
-		return fmt.Errorf("username and password must not contains any quotation marks")
+	if HasQuote(r.Spec.LocalUsername, r.Spec.ReplicaUsername) {
+		return fmt.Errorf("username must not contains any quotation marks")
+	}
+	if HasQuote(r.Spec.DeprecatedLocalPassword, r.Spec.DeprecatedReplicaPassword, r.Spec.DeprecatedExporterPassword) {
+		return fmt.Errorf("password must not contains any quotation marks")
 	}
 
 	if !Between(r.Spec.Port, minPort, maxPort) {
@@ -210,6 +272,56 @@ func (r *Mysql) Validate() (err error) {
 		return fmt.Errorf("ports must not equal")
 	}
 
+	if err = r.Spec.ValidateMysqlConfig(); err != nil {
+		return err
+	}
+	r.Status.ConfigHash = HashConfig(r.Spec.MysqlConfig)
+
+	switch r.Spec.DeletionPolicy {
+	case DeletionPolicyRetain, DeletionPolicyDelete, DeletionPolicySnapshotThenDelete:
+	default:
+		return fmt.Errorf("deletion policy invalid: %s", r.Spec.DeletionPolicy)
+	}
+	if r.Spec.FinalBackup && r.Spec.DeletionPolicy == DeletionPolicyDelete && r.Spec.BackupStorage == nil {
+		// kept on the volumes deleted otherwise
+		return fmt.Errorf("final backup with deletion policy %s requires backup storage", r.Spec.DeletionPolicy)
+	}
+	switch r.Spec.SeedStrategy {
+	case SeedStrategyXtrabackup:
+	case SeedStrategyClone:
+		if r.Status.Version.LT(8, 0, 17) {
+			return fmt.Errorf("seed strategy %s requires mysql 8.0.17: %s", r.Spec.SeedStrategy, r.Spec.Version)
+		}
+	default:
+		return fmt.Errorf("seed strategy invalid: %s", r.Spec.SeedStrategy)
+	}
+
+	if bs := r.Spec.BackupStorage; bs != nil {
+		if bs.Endpoint == "" {
+			return fmt.Errorf("backup storage endpoint required")
+		}
+		if bs.Bucket == "" {
+			return fmt.Errorf("backup storage bucket required")
+		}
+		if bs.AccessKeySecretRef == nil || bs.SecretKeySecretRef == nil {
+			return fmt.Errorf("backup storage secret refs required")
+		}
+	}
+	if be := r.Spec.BackupEncryption; be != nil && be.KeySecretRef == nil {
+		return fmt.Errorf("backup encryption key secret ref required")
+	}
+	if br := r.Spec.BackupRetention; br != nil {
+		if br.KeepChains < 0 {
+			return fmt.Errorf("backup retention keep chains invalid: %d", br.KeepChains)
+		}
+		if br.MaxAge != nil && br.MaxAge.Duration < 0 {
+			return fmt.Errorf("backup retention max age invalid: %s", br.MaxAge.Duration)
+		}
+		if br.MaxBytes != nil && br.MaxBytes.Sign() < 0 {
+			return fmt.Errorf("backup retention max bytes invalid: %s", br.MaxBytes.String())
+		}
+	}
+
 	if r.Spec.Mydir == "" {
 		return fmt.Errorf("mydir required")
 	}
@@ -233,14 +345,11 @@ func (r *Mysql) Validate() (err error) {
 		if r.Spec.ExporterUsername == "" {
 			return fmt.Errorf("exporter username required")
 		}
-		if r.Spec.ExporterPassword == "" {
-			return fmt.Errorf("exporter password required")
-		}
 		if r.Spec.ExporterUsername == r.Spec.LocalUsername || r.Spec.ExporterUsername == r.Spec.ReplicaUsername {
 			return fmt.Errorf("exporter username must not equal local username or replica username")
 		}
-		if HasQuote(r.Spec.ExporterUsername, r.Spec.ExporterPassword) {
-			return fmt.Errorf("exporter username and password must not contains any quotation marks")
+		if HasQuote(r.Spec.ExporterUsername) {
+			return fmt.Errorf("exporter username must not contains any quotation marks")
 		}
 	}
 
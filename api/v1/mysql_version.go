@@ -23,7 +23,13 @@ type MysqlVersion struct {
 }
 
 func (v MysqlVersion) LT(major, minor, patch int) bool {
-	return v.Major < major || v.Minor < minor || v.Patch < patch
+	if v.Major != major {
+		return v.Major < major
+	}
+	if v.Minor != minor {
+		return v.Minor < minor
+	}
+	return v.Patch < patch
 }
 
 func (v MysqlVersion) ValidateMasterHost(s string) bool {
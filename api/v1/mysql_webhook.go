@@ -0,0 +1,170 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var mysqllog = logf.Log.WithName("mysql-resource")
+
+func (r *Mysql) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-database-erda-cloud-v1-mysql,mutating=true,failurePolicy=fail,sideEffects=None,groups=database.erda.cloud,resources=mysqls,verbs=create;update,versions=v1,name=mmysql.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &Mysql{}
+
+//+kubebuilder:webhook:path=/validate-database-erda-cloud-v1-mysql,mutating=false,failurePolicy=fail,sideEffects=None,groups=database.erda.cloud,resources=mysqls,verbs=create;update,versions=v1,name=vmysql.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &Mysql{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *Mysql) ValidateCreate() error {
+	mysqllog.Info("validate create", "name", r.Name)
+
+	// credentials are resolved by the controller, validate the spec only
+	return r.DeepCopy().ValidateSpec()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *Mysql) ValidateUpdate(old runtime.Object) error {
+	mysqllog.Info("validate update", "name", r.Name)
+
+	o, ok := old.(*Mysql)
+	if !ok {
+		return fmt.Errorf("expect old object to be a Mysql but got %T", old)
+	}
+
+	if err := r.DeepCopy().ValidateSpec(); err != nil {
+		return err
+	}
+
+	return r.ValidateChange(o)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *Mysql) ValidateDelete() error {
+	return nil
+}
+
+// ValidateChange rejects the spec changes that can not be applied to a running group
+func (r *Mysql) ValidateChange(old *Mysql) error {
+	if old.Spec.Version != "" && r.Spec.Version != old.Spec.Version {
+		v, err := ParseVersion(r.Spec.Version)
+		if err != nil {
+			return err
+		}
+		o, err := ParseVersion(old.Spec.Version)
+		if err != nil {
+			return err
+		}
+		patch := o.Patch
+		if v.NoPatch || o.NoPatch {
+			patch = v.Patch
+		}
+		if v.LT(o.Major, o.Minor, patch) {
+			return fmt.Errorf("version can not be downgraded: %s to %s", old.Spec.Version, r.Spec.Version)
+		}
+	}
+
+	if old.Spec.Mydir != "" && r.Spec.Mydir != old.Spec.Mydir {
+		return fmt.Errorf("mydir is immutable")
+	}
+	if old.Spec.StorageClassName != "" && r.Spec.StorageClassName != old.Spec.StorageClassName {
+		return fmt.Errorf("storage class name is immutable")
+	}
+	if !old.Spec.StorageSize.IsZero() && r.Spec.StorageSize.Cmp(old.Spec.StorageSize) < 0 {
+		return fmt.Errorf("storage size can not be shrunk: %s to %s", old.Spec.StorageSize.String(), r.Spec.StorageSize.String())
+	}
+	if old.Spec.LocalUsername != "" && r.Spec.LocalUsername != old.Spec.LocalUsername {
+		return fmt.Errorf("local username is immutable")
+	}
+	if old.Spec.ReplicaUsername != "" && r.Spec.ReplicaUsername != old.Spec.ReplicaUsername {
+		return fmt.Errorf("replica username is immutable")
+	}
+	if old.Spec.GroupName != "" && r.Spec.GroupName != old.Spec.GroupName {
+		return fmt.Errorf("group name is immutable")
+	}
+
+	if old.Spec.PrimaryMode != "" && r.Spec.PrimaryMode != old.Spec.PrimaryMode {
+		if err := r.ValidateConversion(old); err != nil {
+			return err
+		}
+	} else if old.Spec.Primaries != 0 && r.Spec.Primaries != old.Spec.Primaries {
+		if err := r.ValidateResize(old); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateResize allows the group to change its primaries in the same mode,
+// the size is kept so the solos move between the members and the replicas,
+// the primary stays a member and the group keeps a majority of its members
+func (r *Mysql) ValidateResize(old *Mysql) error {
+	if r.Spec.PrimaryMode == ModeClassic {
+		return fmt.Errorf("%s mode primaries must equal 1", r.Spec.PrimaryMode)
+	}
+	if old.Spec.Replicas != nil && r.Spec.Replicas != nil && r.Spec.Size() != old.Spec.Size() {
+		return fmt.Errorf("size can not be changed together with the primaries: %d to %d", old.Spec.Size(), r.Spec.Size())
+	}
+	if 2*r.Spec.Primaries <= old.Spec.Primaries {
+		return fmt.Errorf("primaries can not lose the majority at once: %d to %d", old.Spec.Primaries, r.Spec.Primaries)
+	}
+	if old.Status.Conversion != nil {
+		return fmt.Errorf("primaries can not be changed during the conversion")
+	}
+	if r.Spec.PrimaryMode == ModeSingle && old.Status.WriteId != nil && *old.Status.WriteId >= r.Spec.Primaries {
+		return fmt.Errorf("primary %d must be a member, switch it below %d first", *old.Status.WriteId, r.Spec.Primaries)
+	}
+	return nil
+}
+
+// ValidateConversion allows the online conversion between Classic and Single modes,
+// the size is kept and the primary stays the primary
+func (r *Mysql) ValidateConversion(old *Mysql) error {
+	from, to := old.Spec.PrimaryMode, r.Spec.PrimaryMode
+	if !(from == ModeClassic && to == ModeSingle) && !(from == ModeSingle && to == ModeClassic) {
+		return fmt.Errorf("primary mode can not be converted: %s to %s", from, to)
+	}
+	if old.Spec.Replicas != nil && r.Spec.Replicas != nil && r.Spec.Size() != old.Spec.Size() {
+		return fmt.Errorf("size can not be changed by the primary mode conversion: %d to %d", old.Spec.Size(), r.Spec.Size())
+	}
+	if old.Status.WriteId == nil {
+		return nil
+	}
+
+	writeId := *old.Status.WriteId
+	if to == ModeSingle && writeId >= r.Spec.Primaries {
+		return fmt.Errorf("primary %d must be a member, switch it below %d first", writeId, r.Spec.Primaries)
+	}
+	if to == ModeClassic && r.Spec.PrimaryId != nil && *r.Spec.PrimaryId != writeId {
+		return fmt.Errorf("primary id must be the group primary %d", writeId)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Backup types
+const (
+	BackupFull        = "full"
+	BackupIncremental = "incremental"
+)
+
+// Backup sources
+const (
+	// A green replica, the primary if none
+	BackupSourceReplica = "replica"
+	BackupSourcePrimary = "primary"
+	// The solo of spec.sourceId
+	BackupSourceSolo = "solo"
+)
+
+// Backup phases
+const (
+	BackupPending   = "Pending"
+	BackupRunning   = "Running"
+	BackupSucceeded = "Succeeded"
+	BackupFailed    = "Failed"
+)
+
+// MysqlBackupStorage is an S3 compatible bucket, the backups are stored under
+// prefix/namespace/solo.datetime/, a tarball for the base and each incremental
+type MysqlBackupStorage struct {
+	// https://s3.amazonaws.com or http://minio:9000, https if no scheme
+	Endpoint string `json:"endpoint"`
+	//+kubebuilder:default=us-east-1
+	//+optional
+	Region string `json:"region,omitempty"`
+	Bucket string `json:"bucket"`
+	//+optional
+	Prefix string `json:"prefix,omitempty"`
+	// The bucket in the path instead of the host, MinIO needs it
+	//+optional
+	PathStyle bool `json:"pathStyle,omitempty"`
+
+	AccessKeySecretRef *corev1.SecretKeySelector `json:"accessKeySecretRef"`
+	SecretKeySecretRef *corev1.SecretKeySelector `json:"secretKeySecretRef"`
+
+	// Resolved from secrets at runtime by mylet, never persisted
+	AccessKey string `json:"-"`
+	SecretKey string `json:"-"`
+}
+
+// MysqlBackupEncryption seals with AES-256-GCM the tarballs, the pieces shipped to the backup storage
+// and the archives served by mylet, the backup directories on the volume stay plain like the datadir.
+// A mysql restoring or fetching a sealed backup needs the same key
+type MysqlBackupEncryption struct {
+	// Any length, the AES key is derived from it
+	KeySecretRef *corev1.SecretKeySelector `json:"keySecretRef"`
+
+	// Resolved from the secret at runtime by mylet, never persisted
+	Key string `json:"-"`
+}
+
+// MysqlBackupRetention bounds the local backups of each solo, enforced by mylet after each backup,
+// the newest chain and the chains being read are always kept, zero for no limit
+type MysqlBackupRetention struct {
+	// Chains to keep, a full backup with its incrementals
+	//+kubebuilder:validation:Minimum=0
+	//+optional
+	KeepChains int `json:"keepChains,omitempty"`
+	//+optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+	// Bytes of the backup directory on the volume, the archived binlogs included
+	//+optional
+	MaxBytes *resource.Quantity `json:"maxBytes,omitempty"`
+}
+
+// MysqlBackupSpec defines the desired state of MysqlBackup
+type MysqlBackupSpec struct {
+	// The Mysql to back up, in the same namespace
+	MysqlName string `json:"mysqlName"`
+
+	//+kubebuilder:validation:Enum=full;incremental
+	//+kubebuilder:default=full
+	//+optional
+	Type string `json:"type,omitempty"`
+
+	//+kubebuilder:validation:Enum=replica;primary;solo
+	//+kubebuilder:default=replica
+	//+optional
+	Source string `json:"source,omitempty"`
+	// The solo id if the source is solo
+	//+optional
+	SourceId *int `json:"sourceId,omitempty"`
+
+	// Compress the backup directory into a tarball
+	//+optional
+	Compress bool `json:"compress,omitempty"`
+
+	// Prove the chain restorable after the backup, prepared and started in a throwaway mysqld
+	//+optional
+	Verify bool `json:"verify,omitempty"`
+}
+
+// MysqlBackupVerification is the chain restored in a throwaway mysqld
+type MysqlBackupVerification struct {
+	Verified bool `json:"verified"`
+	//+optional
+	VerifyTime *metav1.Time `json:"verifyTime,omitempty"`
+	// The GTID of the last change in the backup
+	//+optional
+	Gtid string `json:"gtid,omitempty"`
+	// User schemas and tables found
+	//+optional
+	Schemas int `json:"schemas,omitempty"`
+	//+optional
+	Tables int `json:"tables,omitempty"`
+	// The sample of tables passing CHECK TABLE
+	//+optional
+	Checked []string `json:"checked,omitempty"`
+	// Why the chain is not restorable
+	//+optional
+	Message string `json:"message,omitempty"`
+}
+
+// MysqlBackupStatus defines the observed state of MysqlBackup
+type MysqlBackupStatus struct {
+	//+optional
+	Phase string `json:"phase,omitempty"`
+	// The solo backed up
+	//+optional
+	SourceId *int `json:"sourceId,omitempty"`
+	//+optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	//+optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// The full backup, 20060102.150405, the incrementals are based on it
+	//+optional
+	BackupTime string `json:"backupTime,omitempty"`
+	// Index of the incremental backup, 0 for the full one
+	//+optional
+	Incremental int `json:"incremental,omitempty"`
+	//+optional
+	Compress bool `json:"compress,omitempty"`
+	// Size in bytes
+	//+optional
+	Size int64 `json:"size,omitempty"`
+	// Where the backup is shipped, empty if no backup storage
+	//+optional
+	Location string `json:"location,omitempty"`
+	// Set if asked to verify
+	//+optional
+	Verification *MysqlBackupVerification `json:"verification,omitempty"`
+	// Id of the key the backup is sealed with, empty if plain
+	//+optional
+	KeyId string `json:"keyId,omitempty"`
+	// The chains removed by the retention after the backup
+	//+optional
+	Pruned []string `json:"pruned,omitempty"`
+	// Bytes freed by the retention
+	//+optional
+	Reclaimed int64 `json:"reclaimed,omitempty"`
+
+	// Why the backup failed
+	//+optional
+	Reason string `json:"reason,omitempty"`
+	//+optional
+	Message string `json:"message,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Mysql",type=string,JSONPath=`.spec.mysqlName`
+//+kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="BackupTime",type=string,JSONPath=`.status.backupTime`
+//+kubebuilder:printcolumn:name="Incremental",type=integer,JSONPath=`.status.incremental`
+//+kubebuilder:printcolumn:name="Verified",type=boolean,JSONPath=`.status.verification.verified`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// MysqlBackup is the Schema for the mysqlbackups API
+type MysqlBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MysqlBackupSpec   `json:"spec,omitempty"`
+	Status MysqlBackupStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// MysqlBackupList contains a list of MysqlBackup
+type MysqlBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MysqlBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MysqlBackup{}, &MysqlBackupList{})
+}
+
+func (r *MysqlBackup) NamespacedName() types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: r.Namespace,
+		Name:      r.Name,
+	}
+}
+
+func (r *MysqlBackup) MysqlNamespacedName() types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: r.Namespace,
+		Name:      r.Spec.MysqlName,
+	}
+}
+
+func (r *MysqlBackup) IsFinished() bool {
+	return r.Status.Phase == BackupSucceeded || r.Status.Phase == BackupFailed
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// The label of the backups created by a schedule
+const ScheduleLabel = "database.erda.cloud/schedule"
+
+// MysqlBackupScheduleSpec defines the desired state of MysqlBackupSchedule
+type MysqlBackupScheduleSpec struct {
+	// The Mysql to back up, in the same namespace
+	MysqlName string `json:"mysqlName"`
+
+	// Cron of the full backups, 5 fields or @daily etc, in the operator time zone
+	Full string `json:"full"`
+	// Cron of the incremental backups on top of the latest full backup,
+	// a full backup runs instead if there is none, a due full backup wins
+	//+optional
+	Incremental string `json:"incremental,omitempty"`
+
+	// Source of the full backups, the incrementals are taken on the same solo
+	//+kubebuilder:validation:Enum=replica;primary;solo
+	//+kubebuilder:default=replica
+	//+optional
+	Source string `json:"source,omitempty"`
+	// The solo id if the source is solo
+	//+optional
+	SourceId *int `json:"sourceId,omitempty"`
+
+	// Compress the backup directory into a tarball
+	//+optional
+	Compress bool `json:"compress,omitempty"`
+	// Prove each chain restorable after the backup
+	//+optional
+	Verify bool `json:"verify,omitempty"`
+
+	// Chains of this schedule to keep, a chain is a full backup with its incrementals,
+	// the other chains follow the backupRetention of the Mysql
+	//+kubebuilder:validation:Minimum=1
+	//+optional
+	KeepChains *int `json:"keepChains,omitempty"`
+	// Chains of this schedule older than this are pruned, the latest one is always kept
+	//+optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+
+	// Failed backups to keep
+	//+kubebuilder:validation:Minimum=0
+	//+kubebuilder:default=3
+	//+optional
+	FailedHistoryLimit *int `json:"failedHistoryLimit,omitempty"`
+
+	// No new backups while suspended
+	//+optional
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// MysqlBackupScheduleStatus defines the observed state of MysqlBackupSchedule
+type MysqlBackupScheduleStatus struct {
+	//+optional
+	LastFullTime *metav1.Time `json:"lastFullTime,omitempty"`
+	//+optional
+	LastIncrementalTime *metav1.Time `json:"lastIncrementalTime,omitempty"`
+	//+optional
+	NextFullTime *metav1.Time `json:"nextFullTime,omitempty"`
+	//+optional
+	NextIncrementalTime *metav1.Time `json:"nextIncrementalTime,omitempty"`
+
+	// The last MysqlBackup created
+	//+optional
+	LastBackup string `json:"lastBackup,omitempty"`
+	// The full MysqlBackup the solos were last pruned after
+	//+optional
+	LastPruned string `json:"lastPruned,omitempty"`
+
+	//+optional
+	Message string `json:"message,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Mysql",type=string,JSONPath=`.spec.mysqlName`
+//+kubebuilder:printcolumn:name="Full",type=string,JSONPath=`.spec.full`
+//+kubebuilder:printcolumn:name="Incremental",type=string,JSONPath=`.spec.incremental`
+//+kubebuilder:printcolumn:name="Suspend",type=boolean,JSONPath=`.spec.suspend`
+//+kubebuilder:printcolumn:name="LastBackup",type=string,JSONPath=`.status.lastBackup`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// MysqlBackupSchedule is the Schema for the mysqlbackupschedules API
+type MysqlBackupSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MysqlBackupScheduleSpec   `json:"spec,omitempty"`
+	Status MysqlBackupScheduleStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// MysqlBackupScheduleList contains a list of MysqlBackupSchedule
+type MysqlBackupScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MysqlBackupSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MysqlBackupSchedule{}, &MysqlBackupScheduleList{})
+}
+
+func (r *MysqlBackupSchedule) MysqlNamespacedName() types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: r.Namespace,
+		Name:      r.Spec.MysqlName,
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Account phases, of a MysqlDatabase or a MysqlUser
+const (
+	// Waiting for the mysql and its writer
+	AccountPending = "Pending"
+	// Converged on the writer at the last sync
+	AccountReady = "Ready"
+	// The last sync failed, retried
+	AccountFailed = "Failed"
+)
+
+// Maximum identifier lengths of mysql
+const (
+	MaxDatabaseName = 64
+	MaxUsername     = 32
+)
+
+// MysqlAccountStatus is the last sync of a MysqlDatabase or a MysqlUser on the writer,
+// synced every minute, written only when it changes
+type MysqlAccountStatus struct {
+	//+optional
+	Phase string `json:"phase,omitempty"`
+	// The generation converged
+	//+optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// The solo applied on
+	//+optional
+	WriteId *int `json:"writeId,omitempty"`
+	// What the last change did, drift corrected included
+	//+optional
+	Changes []string `json:"changes,omitempty"`
+	//+optional
+	ChangeTime *metav1.Time `json:"changeTime,omitempty"`
+
+	// The schema, or the username and host of the user, last applied,
+	// the old one is dropped, or kept if retained, when the spec changes it
+	//+optional
+	AppliedName string `json:"appliedName,omitempty"`
+	//+optional
+	AppliedHost string `json:"appliedHost,omitempty"`
+
+	// Why the sync failed
+	//+optional
+	Reason string `json:"reason,omitempty"`
+	//+optional
+	Message string `json:"message,omitempty"`
+}
+
+// MysqlDatabaseSpec defines the desired state of MysqlDatabase
+type MysqlDatabaseSpec struct {
+	// The Mysql holding the database, in the same namespace
+	MysqlName string `json:"mysqlName"`
+
+	// The schema, defaults to the name of the resource
+	//+optional
+	Name string `json:"name,omitempty"`
+
+	//+kubebuilder:default=utf8mb4
+	//+optional
+	Charset string `json:"charset,omitempty"`
+	//+kubebuilder:default=utf8mb4_general_ci
+	//+optional
+	Collation string `json:"collation,omitempty"`
+
+	// Whether the schema is dropped with the resource, its data lost
+	//+kubebuilder:validation:Enum=Retain;Delete
+	//+kubebuilder:default=Retain
+	//+optional
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Mysql",type=string,JSONPath=`.spec.mysqlName`
+//+kubebuilder:printcolumn:name="Database",type=string,JSONPath=`.spec.name`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Message",type=string,JSONPath=`.status.message`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// MysqlDatabase is the Schema for the mysqldatabases API
+type MysqlDatabase struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MysqlDatabaseSpec  `json:"spec,omitempty"`
+	Status MysqlAccountStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// MysqlDatabaseList contains a list of MysqlDatabase
+type MysqlDatabaseList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MysqlDatabase `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MysqlDatabase{}, &MysqlDatabaseList{})
+}
+
+func (r *MysqlDatabase) NamespacedName() types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: r.Namespace,
+		Name:      r.Name,
+	}
+}
+
+func (r *MysqlDatabase) MysqlNamespacedName() types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: r.Namespace,
+		Name:      r.Spec.MysqlName,
+	}
+}
+
+func (r *MysqlDatabase) Default() {
+	if r.Spec.Name == "" {
+		r.Spec.Name = r.Name
+	}
+	if r.Spec.Charset == "" {
+		r.Spec.Charset = "utf8mb4"
+	}
+	if r.Spec.Collation == "" {
+		r.Spec.Collation = "utf8mb4_general_ci"
+	}
+	if r.Spec.DeletionPolicy == "" {
+		r.Spec.DeletionPolicy = DeletionPolicyRetain
+	}
+}
+
+func (r *MysqlDatabase) Validate() error {
+	if r.Spec.MysqlName == "" {
+		return fmt.Errorf("mysql name required")
+	}
+	if err := ValidateDatabaseName(r.Spec.Name); err != nil {
+		return err
+	}
+	if !IsWord(r.Spec.Charset) {
+		return fmt.Errorf("charset invalid: %s", r.Spec.Charset)
+	}
+	// binary is both
+	if !IsWord(r.Spec.Collation) || r.Spec.Collation != r.Spec.Charset && !strings.HasPrefix(r.Spec.Collation, r.Spec.Charset+"_") {
+		return fmt.Errorf("collation invalid for charset %s: %s", r.Spec.Charset, r.Spec.Collation)
+	}
+	switch r.Spec.DeletionPolicy {
+	case DeletionPolicyRetain, DeletionPolicyDelete:
+	default:
+		return fmt.Errorf("deletion policy invalid: %s", r.Spec.DeletionPolicy)
+	}
+	return nil
+}
+
+// ValidateDatabaseName rejects the system schemas and the names mysql does not store as is
+func ValidateDatabaseName(s string) error {
+	if !Between(len(s), 1, MaxDatabaseName) {
+		return fmt.Errorf("database name length not in [1, %d]: %s", MaxDatabaseName, s)
+	}
+	if strings.ContainsAny(s, "`'\"\\/.") || strings.TrimSpace(s) != s {
+		return fmt.Errorf("database name invalid: %s", s)
+	}
+	switch strings.ToLower(s) {
+	case "mysql", "sys", "information_schema", "performance_schema":
+		return fmt.Errorf("database name reserved: %s", s)
+	}
+	return nil
+}
+
+// IsWord tells whether s is letters, digits and underscores only
+func IsWord(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
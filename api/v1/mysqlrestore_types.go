@@ -0,0 +1,171 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Restore phases
+const (
+	RestorePending = "Pending"
+	// Waiting for the new mysql to be green
+	RestoreCreating = "Creating"
+	// The primary downloads and prepares the backup beside its datadir
+	RestoreStaging = "Staging"
+	// The primary restarts onto the prepared backup
+	RestoreRestarting = "Restarting"
+	// The replicas restart and fetch the restored data from the primary
+	RestoreReseeding = "Reseeding"
+	RestoreSucceeded = "Succeeded"
+	RestoreFailed    = "Failed"
+)
+
+// MysqlRestoreSource is a backup taken by mylet, by a MysqlBackup or by the solo and datetime,
+// or an external archive
+type MysqlRestoreSource struct {
+	// A succeeded MysqlBackup in the same namespace
+	//+optional
+	BackupName string `json:"backupName,omitempty"`
+
+	// The Mysql holding the backup, in the same namespace
+	//+optional
+	MysqlName string `json:"mysqlName,omitempty"`
+	// The solo holding the backup
+	//+optional
+	SoloId *int `json:"soloId,omitempty"`
+	// The full backup, 20060102.150405, the latest one if empty
+	//+optional
+	BackupTime string `json:"backupTime,omitempty"`
+	// Apply the incrementals up to this index, 0 for the full backup only, all if nil
+	//+optional
+	Incremental *int `json:"incremental,omitempty"`
+
+	// A tar.gz archive of a backup directory, base and incN, as served by mylet,
+	// sealed with the backup encryption key if the mysql has one
+	//+optional
+	URL string `json:"url,omitempty"`
+}
+
+// MysqlPointInTime is where the binlog replay stops, the first one reached,
+// all the archived binlogs are replayed if none
+type MysqlPointInTime struct {
+	// Replay the transactions committed before the time
+	//+optional
+	Time *metav1.Time `json:"time,omitempty"`
+	// Replay the transactions before the GTID, uuid:N, the bad one excluded
+	//+optional
+	Gtid string `json:"gtid,omitempty"`
+}
+
+// MysqlRestoreSpec defines the desired state of MysqlRestore
+type MysqlRestoreSpec struct {
+	// The Mysql to restore into, in the same namespace,
+	// it is created from the template if it does not exist, restored in place otherwise
+	MysqlName string `json:"mysqlName"`
+
+	Source MysqlRestoreSource `json:"source"`
+
+	// Replay the binlogs archived by the source solo after the backup,
+	// the source must be a mylet, the nearest backup before the time is restored
+	// if no backup time or name is given
+	//+optional
+	PointInTime *MysqlPointInTime `json:"pointInTime,omitempty"`
+
+	// Spec of the Mysql to create
+	//+optional
+	Template *MysqlSpec `json:"template,omitempty"`
+}
+
+// MysqlRestoreStatus defines the observed state of MysqlRestore
+type MysqlRestoreStatus struct {
+	//+optional
+	Phase string `json:"phase,omitempty"`
+	// The Mysql was created by the restore
+	//+optional
+	Created bool `json:"created,omitempty"`
+	// The primary restored, then reseeding the others
+	//+optional
+	PrimaryId *int `json:"primaryId,omitempty"`
+	// The solos asked to fetch the restored data on restart
+	//+optional
+	ReseedIds []int `json:"reseedIds,omitempty"`
+	// The solos running the restored data
+	//+optional
+	RestoredIds []int `json:"restoredIds,omitempty"`
+	//+optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// When the current phase was requested from the solos
+	//+optional
+	RequestTime *metav1.Time `json:"requestTime,omitempty"`
+	//+optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Why the restore failed
+	//+optional
+	Reason string `json:"reason,omitempty"`
+	//+optional
+	Message string `json:"message,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Mysql",type=string,JSONPath=`.spec.mysqlName`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Message",type=string,JSONPath=`.status.message`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// MysqlRestore is the Schema for the mysqlrestores API
+type MysqlRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MysqlRestoreSpec   `json:"spec,omitempty"`
+	Status MysqlRestoreStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// MysqlRestoreList contains a list of MysqlRestore
+type MysqlRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MysqlRestore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MysqlRestore{}, &MysqlRestoreList{})
+}
+
+func (r *MysqlRestore) NamespacedName() types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: r.Namespace,
+		Name:      r.Name,
+	}
+}
+
+func (r *MysqlRestore) MysqlNamespacedName() types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: r.Namespace,
+		Name:      r.Spec.MysqlName,
+	}
+}
+
+func (r *MysqlRestore) IsFinished() bool {
+	return r.Status.Phase == RestoreSucceeded || r.Status.Phase == RestoreFailed
+}
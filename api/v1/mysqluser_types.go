@@ -0,0 +1,186 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// MysqlGrant is privileges on a database or a table of it, global privileges are not declared
+type MysqlGrant struct {
+	// ALL, SELECT, INSERT, UPDATE, DELETE, CREATE, DROP, INDEX, ALTER...
+	//+kubebuilder:validation:MinItems=1
+	Privileges []string `json:"privileges"`
+	Database   string   `json:"database"`
+	// The table, all of the database if empty
+	//+optional
+	Table string `json:"table,omitempty"`
+	//+optional
+	GrantOption bool `json:"grantOption,omitempty"`
+}
+
+// MysqlUserSpec defines the desired state of MysqlUser
+type MysqlUserSpec struct {
+	// The Mysql holding the user, in the same namespace
+	MysqlName string `json:"mysqlName"`
+
+	// The user, defaults to the name of the resource
+	//+optional
+	Username string `json:"username,omitempty"`
+	//+kubebuilder:default="%"
+	//+optional
+	Host string `json:"host,omitempty"`
+	// The password is reset to it when it changes or drifts
+	PasswordSecretRef *corev1.SecretKeySelector `json:"passwordSecretRef"`
+
+	// The privileges the user has, the others are revoked
+	//+optional
+	Grants []MysqlGrant `json:"grants,omitempty"`
+	// 0 for no limit
+	//+kubebuilder:validation:Minimum=0
+	//+optional
+	MaxUserConnections int `json:"maxUserConnections,omitempty"`
+
+	// Whether the user is dropped with the resource
+	//+kubebuilder:validation:Enum=Retain;Delete
+	//+kubebuilder:default=Delete
+	//+optional
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Mysql",type=string,JSONPath=`.spec.mysqlName`
+//+kubebuilder:printcolumn:name="Username",type=string,JSONPath=`.spec.username`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Message",type=string,JSONPath=`.status.message`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// MysqlUser is the Schema for the mysqlusers API
+type MysqlUser struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MysqlUserSpec      `json:"spec,omitempty"`
+	Status MysqlAccountStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// MysqlUserList contains a list of MysqlUser
+type MysqlUserList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MysqlUser `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MysqlUser{}, &MysqlUserList{})
+}
+
+func (r *MysqlUser) NamespacedName() types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: r.Namespace,
+		Name:      r.Name,
+	}
+}
+
+func (r *MysqlUser) MysqlNamespacedName() types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: r.Namespace,
+		Name:      r.Spec.MysqlName,
+	}
+}
+
+func (r *MysqlUser) Default() {
+	if r.Spec.Username == "" {
+		r.Spec.Username = r.Name
+	}
+	if r.Spec.Host == "" {
+		r.Spec.Host = "%"
+	}
+	if r.Spec.DeletionPolicy == "" {
+		r.Spec.DeletionPolicy = DeletionPolicyDelete
+	}
+}
+
+// Validate validates the spec, the usernames of the operator on the mysql are reserved,
+// the default ones if the mysql is nil
+func (r *MysqlUser) Validate(mysql *Mysql) error {
+	if r.Spec.MysqlName == "" {
+		return fmt.Errorf("mysql name required")
+	}
+	if !Between(len(r.Spec.Username), 1, MaxUsername) {
+		return fmt.Errorf("username length not in [1, %d]: %s", MaxUsername, r.Spec.Username)
+	}
+	reserved := []string{"root", "repl", "exporter", CloneUsername}
+	if mysql != nil {
+		reserved = []string{mysql.Spec.LocalUsername, mysql.Spec.ReplicaUsername, mysql.Spec.ExporterUsername, CloneUsername}
+	}
+	for _, s := range reserved {
+		if r.Spec.Username == s {
+			return fmt.Errorf("username reserved by the operator: %s", s)
+		}
+	}
+	if HasQuote(r.Spec.Username, r.Spec.Host) || strings.Contains(r.Spec.Username+r.Spec.Host, "\\") {
+		return fmt.Errorf("username and host must not contains any quotation marks")
+	}
+	if r.Spec.Host == "" {
+		return fmt.Errorf("host required")
+	}
+	if r.Spec.PasswordSecretRef == nil {
+		return fmt.Errorf("password secret ref required")
+	}
+	if r.Spec.MaxUserConnections < 0 {
+		return fmt.Errorf("max user connections invalid: %d", r.Spec.MaxUserConnections)
+	}
+	for _, g := range r.Spec.Grants {
+		if err := g.Validate(); err != nil {
+			return err
+		}
+	}
+	switch r.Spec.DeletionPolicy {
+	case DeletionPolicyRetain, DeletionPolicyDelete:
+	default:
+		return fmt.Errorf("deletion policy invalid: %s", r.Spec.DeletionPolicy)
+	}
+	return nil
+}
+
+func (g MysqlGrant) Validate() error {
+	if err := ValidateDatabaseName(g.Database); err != nil {
+		return err
+	}
+	if g.Table != "" && (HasQuote(g.Table) || !Between(len(g.Table), 1, MaxDatabaseName)) {
+		return fmt.Errorf("grant table invalid: %s", g.Table)
+	}
+	if len(g.Privileges) == 0 {
+		return fmt.Errorf("grant on %s privileges required", g.Database)
+	}
+	for _, p := range g.Privileges {
+		// SHOW VIEW, CREATE TEMPORARY TABLES
+		if !IsWord(strings.ReplaceAll(p, " ", "_")) {
+			return fmt.Errorf("grant on %s privilege invalid: %s", g.Database, p)
+		}
+	}
+	return nil
+}
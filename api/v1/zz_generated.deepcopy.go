@@ -23,6 +23,7 @@ package v1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -53,6 +54,500 @@ func (in *Mysql) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlAccountStatus) DeepCopyInto(out *MysqlAccountStatus) {
+	*out = *in
+	if in.WriteId != nil {
+		in, out := &in.WriteId, &out.WriteId
+		*out = new(int)
+		**out = **in
+	}
+	if in.Changes != nil {
+		in, out := &in.Changes, &out.Changes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ChangeTime != nil {
+		in, out := &in.ChangeTime, &out.ChangeTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlAccountStatus.
+func (in *MysqlAccountStatus) DeepCopy() *MysqlAccountStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlAccountStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlBackup) DeepCopyInto(out *MysqlBackup) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlBackup.
+func (in *MysqlBackup) DeepCopy() *MysqlBackup {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlBackup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MysqlBackup) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlBackupEncryption) DeepCopyInto(out *MysqlBackupEncryption) {
+	*out = *in
+	if in.KeySecretRef != nil {
+		in, out := &in.KeySecretRef, &out.KeySecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlBackupEncryption.
+func (in *MysqlBackupEncryption) DeepCopy() *MysqlBackupEncryption {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlBackupEncryption)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlBackupList) DeepCopyInto(out *MysqlBackupList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MysqlBackup, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlBackupList.
+func (in *MysqlBackupList) DeepCopy() *MysqlBackupList {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlBackupList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MysqlBackupList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlBackupRetention) DeepCopyInto(out *MysqlBackupRetention) {
+	*out = *in
+	if in.MaxAge != nil {
+		in, out := &in.MaxAge, &out.MaxAge
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaxBytes != nil {
+		in, out := &in.MaxBytes, &out.MaxBytes
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlBackupRetention.
+func (in *MysqlBackupRetention) DeepCopy() *MysqlBackupRetention {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlBackupRetention)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlBackupSchedule) DeepCopyInto(out *MysqlBackupSchedule) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlBackupSchedule.
+func (in *MysqlBackupSchedule) DeepCopy() *MysqlBackupSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlBackupSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MysqlBackupSchedule) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlBackupScheduleList) DeepCopyInto(out *MysqlBackupScheduleList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MysqlBackupSchedule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlBackupScheduleList.
+func (in *MysqlBackupScheduleList) DeepCopy() *MysqlBackupScheduleList {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlBackupScheduleList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MysqlBackupScheduleList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlBackupScheduleSpec) DeepCopyInto(out *MysqlBackupScheduleSpec) {
+	*out = *in
+	if in.SourceId != nil {
+		in, out := &in.SourceId, &out.SourceId
+		*out = new(int)
+		**out = **in
+	}
+	if in.KeepChains != nil {
+		in, out := &in.KeepChains, &out.KeepChains
+		*out = new(int)
+		**out = **in
+	}
+	if in.MaxAge != nil {
+		in, out := &in.MaxAge, &out.MaxAge
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.FailedHistoryLimit != nil {
+		in, out := &in.FailedHistoryLimit, &out.FailedHistoryLimit
+		*out = new(int)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlBackupScheduleSpec.
+func (in *MysqlBackupScheduleSpec) DeepCopy() *MysqlBackupScheduleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlBackupScheduleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlBackupScheduleStatus) DeepCopyInto(out *MysqlBackupScheduleStatus) {
+	*out = *in
+	if in.LastFullTime != nil {
+		in, out := &in.LastFullTime, &out.LastFullTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastIncrementalTime != nil {
+		in, out := &in.LastIncrementalTime, &out.LastIncrementalTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextFullTime != nil {
+		in, out := &in.NextFullTime, &out.NextFullTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextIncrementalTime != nil {
+		in, out := &in.NextIncrementalTime, &out.NextIncrementalTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlBackupScheduleStatus.
+func (in *MysqlBackupScheduleStatus) DeepCopy() *MysqlBackupScheduleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlBackupScheduleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlBackupSpec) DeepCopyInto(out *MysqlBackupSpec) {
+	*out = *in
+	if in.SourceId != nil {
+		in, out := &in.SourceId, &out.SourceId
+		*out = new(int)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlBackupSpec.
+func (in *MysqlBackupSpec) DeepCopy() *MysqlBackupSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlBackupSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlBackupStatus) DeepCopyInto(out *MysqlBackupStatus) {
+	*out = *in
+	if in.SourceId != nil {
+		in, out := &in.SourceId, &out.SourceId
+		*out = new(int)
+		**out = **in
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Verification != nil {
+		in, out := &in.Verification, &out.Verification
+		*out = new(MysqlBackupVerification)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Pruned != nil {
+		in, out := &in.Pruned, &out.Pruned
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlBackupStatus.
+func (in *MysqlBackupStatus) DeepCopy() *MysqlBackupStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlBackupStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlBackupStorage) DeepCopyInto(out *MysqlBackupStorage) {
+	*out = *in
+	if in.AccessKeySecretRef != nil {
+		in, out := &in.AccessKeySecretRef, &out.AccessKeySecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretKeySecretRef != nil {
+		in, out := &in.SecretKeySecretRef, &out.SecretKeySecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlBackupStorage.
+func (in *MysqlBackupStorage) DeepCopy() *MysqlBackupStorage {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlBackupStorage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlBackupVerification) DeepCopyInto(out *MysqlBackupVerification) {
+	*out = *in
+	if in.VerifyTime != nil {
+		in, out := &in.VerifyTime, &out.VerifyTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Checked != nil {
+		in, out := &in.Checked, &out.Checked
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlBackupVerification.
+func (in *MysqlBackupVerification) DeepCopy() *MysqlBackupVerification {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlBackupVerification)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlConversionStatus) DeepCopyInto(out *MysqlConversionStatus) {
+	*out = *in
+	out.From = in.From
+	out.To = in.To
+	if in.ConvertedIds != nil {
+		in, out := &in.ConvertedIds, &out.ConvertedIds
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+	if in.CurrentId != nil {
+		in, out := &in.CurrentId, &out.CurrentId
+		*out = new(int)
+		**out = **in
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.RequestTime != nil {
+		in, out := &in.RequestTime, &out.RequestTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlConversionStatus.
+func (in *MysqlConversionStatus) DeepCopy() *MysqlConversionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlConversionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlDatabase) DeepCopyInto(out *MysqlDatabase) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlDatabase.
+func (in *MysqlDatabase) DeepCopy() *MysqlDatabase {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlDatabase)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MysqlDatabase) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlDatabaseList) DeepCopyInto(out *MysqlDatabaseList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MysqlDatabase, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlDatabaseList.
+func (in *MysqlDatabaseList) DeepCopy() *MysqlDatabaseList {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlDatabaseList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MysqlDatabaseList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlDatabaseSpec) DeepCopyInto(out *MysqlDatabaseSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlDatabaseSpec.
+func (in *MysqlDatabaseSpec) DeepCopy() *MysqlDatabaseSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlDatabaseSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlGrant) DeepCopyInto(out *MysqlGrant) {
+	*out = *in
+	if in.Privileges != nil {
+		in, out := &in.Privileges, &out.Privileges
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlGrant.
+func (in *MysqlGrant) DeepCopy() *MysqlGrant {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlGrant)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MysqlList) DeepCopyInto(out *MysqlList) {
 	*out = *in
@@ -85,11 +580,182 @@ func (in *MysqlList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlPointInTime) DeepCopyInto(out *MysqlPointInTime) {
+	*out = *in
+	if in.Time != nil {
+		in, out := &in.Time, &out.Time
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlPointInTime.
+func (in *MysqlPointInTime) DeepCopy() *MysqlPointInTime {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlPointInTime)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlRestore) DeepCopyInto(out *MysqlRestore) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlRestore.
+func (in *MysqlRestore) DeepCopy() *MysqlRestore {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlRestore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MysqlRestore) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlRestoreList) DeepCopyInto(out *MysqlRestoreList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MysqlRestore, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlRestoreList.
+func (in *MysqlRestoreList) DeepCopy() *MysqlRestoreList {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlRestoreList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MysqlRestoreList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlRestoreSource) DeepCopyInto(out *MysqlRestoreSource) {
+	*out = *in
+	if in.SoloId != nil {
+		in, out := &in.SoloId, &out.SoloId
+		*out = new(int)
+		**out = **in
+	}
+	if in.Incremental != nil {
+		in, out := &in.Incremental, &out.Incremental
+		*out = new(int)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlRestoreSource.
+func (in *MysqlRestoreSource) DeepCopy() *MysqlRestoreSource {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlRestoreSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlRestoreSpec) DeepCopyInto(out *MysqlRestoreSpec) {
+	*out = *in
+	in.Source.DeepCopyInto(&out.Source)
+	if in.PointInTime != nil {
+		in, out := &in.PointInTime, &out.PointInTime
+		*out = new(MysqlPointInTime)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Template != nil {
+		in, out := &in.Template, &out.Template
+		*out = new(MysqlSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlRestoreSpec.
+func (in *MysqlRestoreSpec) DeepCopy() *MysqlRestoreSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlRestoreSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlRestoreStatus) DeepCopyInto(out *MysqlRestoreStatus) {
+	*out = *in
+	if in.PrimaryId != nil {
+		in, out := &in.PrimaryId, &out.PrimaryId
+		*out = new(int)
+		**out = **in
+	}
+	if in.ReseedIds != nil {
+		in, out := &in.ReseedIds, &out.ReseedIds
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+	if in.RestoredIds != nil {
+		in, out := &in.RestoredIds, &out.RestoredIds
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.RequestTime != nil {
+		in, out := &in.RequestTime, &out.RequestTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlRestoreStatus.
+func (in *MysqlRestoreStatus) DeepCopy() *MysqlRestoreStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlRestoreStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MysqlSolo) DeepCopyInto(out *MysqlSolo) {
 	*out = *in
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlSolo.
@@ -125,6 +791,11 @@ func (in *MysqlSoloSpec) DeepCopy() *MysqlSoloSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MysqlSoloStatus) DeepCopyInto(out *MysqlSoloStatus) {
 	*out = *in
+	if in.Lag != nil {
+		in, out := &in.Lag, &out.Lag
+		*out = new(int)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlSoloStatus.
@@ -155,7 +826,32 @@ func (in *MysqlSpec) DeepCopyInto(out *MysqlSpec) {
 		*out = new(bool)
 		**out = **in
 	}
+	if in.LocalPasswordSecretRef != nil {
+		in, out := &in.LocalPasswordSecretRef, &out.LocalPasswordSecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ReplicaPasswordSecretRef != nil {
+		in, out := &in.ReplicaPasswordSecretRef, &out.ReplicaPasswordSecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
 	out.StorageSize = in.StorageSize.DeepCopy()
+	if in.BackupStorage != nil {
+		in, out := &in.BackupStorage, &out.BackupStorage
+		*out = new(MysqlBackupStorage)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BackupEncryption != nil {
+		in, out := &in.BackupEncryption, &out.BackupEncryption
+		*out = new(MysqlBackupEncryption)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BackupRetention != nil {
+		in, out := &in.BackupRetention, &out.BackupRetention
+		*out = new(MysqlBackupRetention)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Solos != nil {
 		in, out := &in.Solos, &out.Solos
 		*out = make([]MysqlSoloSpec, len(*in))
@@ -168,6 +864,11 @@ func (in *MysqlSpec) DeepCopyInto(out *MysqlSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.ExporterPasswordSecretRef != nil {
+		in, out := &in.ExporterPasswordSecretRef, &out.ExporterPasswordSecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Labels != nil {
 		in, out := &in.Labels, &out.Labels
 		*out = make(map[string]string, len(*in))
@@ -202,6 +903,13 @@ func (in *MysqlSpec) DeepCopyInto(out *MysqlSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.MysqlConfig != nil {
+		in, out := &in.MysqlConfig, &out.MysqlConfig
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlSpec.
@@ -225,7 +933,7 @@ func (in *MysqlStatus) DeepCopyInto(out *MysqlStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
-	out.MysqlSoloStatus = in.MysqlSoloStatus
+	in.MysqlSoloStatus.DeepCopyInto(&out.MysqlSoloStatus)
 	if in.WriteId != nil {
 		in, out := &in.WriteId, &out.WriteId
 		*out = new(int)
@@ -236,6 +944,33 @@ func (in *MysqlStatus) DeepCopyInto(out *MysqlStatus) {
 		*out = new(int)
 		**out = **in
 	}
+	if in.ReadIds != nil {
+		in, out := &in.ReadIds, &out.ReadIds
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+	if in.Upgrade != nil {
+		in, out := &in.Upgrade, &out.Upgrade
+		*out = new(MysqlUpgradeStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(MysqlStorageStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conversion != nil {
+		in, out := &in.Conversion, &out.Conversion
+		*out = new(MysqlConversionStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlStatus.
@@ -248,6 +983,147 @@ func (in *MysqlStatus) DeepCopy() *MysqlStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlStorageStatus) DeepCopyInto(out *MysqlStorageStatus) {
+	*out = *in
+	out.Size = in.Size.DeepCopy()
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlStorageStatus.
+func (in *MysqlStorageStatus) DeepCopy() *MysqlStorageStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlStorageStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlTopology) DeepCopyInto(out *MysqlTopology) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlTopology.
+func (in *MysqlTopology) DeepCopy() *MysqlTopology {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlTopology)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlUpgradeStatus) DeepCopyInto(out *MysqlUpgradeStatus) {
+	*out = *in
+	if in.CurrentId != nil {
+		in, out := &in.CurrentId, &out.CurrentId
+		*out = new(int)
+		**out = **in
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlUpgradeStatus.
+func (in *MysqlUpgradeStatus) DeepCopy() *MysqlUpgradeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlUpgradeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlUser) DeepCopyInto(out *MysqlUser) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlUser.
+func (in *MysqlUser) DeepCopy() *MysqlUser {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlUser)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MysqlUser) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlUserList) DeepCopyInto(out *MysqlUserList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MysqlUser, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlUserList.
+func (in *MysqlUserList) DeepCopy() *MysqlUserList {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlUserList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MysqlUserList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MysqlUserSpec) DeepCopyInto(out *MysqlUserSpec) {
+	*out = *in
+	if in.PasswordSecretRef != nil {
+		in, out := &in.PasswordSecretRef, &out.PasswordSecretRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Grants != nil {
+		in, out := &in.Grants, &out.Grants
+		*out = make([]MysqlGrant, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MysqlUserSpec.
+func (in *MysqlUserSpec) DeepCopy() *MysqlUserSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MysqlUserSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MysqlVersion) DeepCopyInto(out *MysqlVersion) {
 	*out = *in
@@ -79,14 +79,66 @@ func main() {
 		os.Exit(1)
 	}
 
+	ctl := myctl.NewMyctl(mgr.GetClient(), mgr.GetAPIReader())
+	if err = mgr.Add(ctl.Leader()); err != nil {
+		setupLog.Error(err, "unable to add myctl leader")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.MysqlReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
-		Myctl:  myctl.NewMyctl(),
+		Myctl:  ctl,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Mysql")
 		os.Exit(1)
 	}
+	if err = (&controllers.MysqlBackupReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Myctl:  ctl,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MysqlBackup")
+		os.Exit(1)
+	}
+	if err = (&controllers.MysqlBackupScheduleReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Myctl:  ctl,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MysqlBackupSchedule")
+		os.Exit(1)
+	}
+	if err = (&controllers.MysqlRestoreReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Myctl:  ctl,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MysqlRestore")
+		os.Exit(1)
+	}
+	if err = (&controllers.MysqlDatabaseReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Myctl:  ctl,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MysqlDatabase")
+		os.Exit(1)
+	}
+	if err = (&controllers.MysqlUserReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Myctl:  ctl,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MysqlUser")
+		os.Exit(1)
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&databasev1.Mysql{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Mysql")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	databasev1 "github.com/erda-project/mysql-operator/api/v1"
+	"github.com/erda-project/mysql-operator/pkg/myctl"
+	"github.com/erda-project/mysql-operator/pkg/mylet"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// Sync the accounts again to correct the drift
+	AccountResync = time.Minute
+	// Retry a pending or failed sync
+	AccountRetry = 15 * time.Second
+)
+
+// SyncAccountStatus records the sync on the writer
+func SyncAccountStatus(status *databasev1.MysqlAccountStatus, generation int64, id int, a mylet.AccountResult, err error) {
+	switch {
+	case err == myctl.ErrGroupNotFound:
+		status.Phase = databasev1.AccountPending
+		status.Reason = ""
+		status.Message = "waiting for the mysql"
+	case err != nil:
+		status.Phase = databasev1.AccountFailed
+		status.Reason = "SyncFailed"
+		status.Message = err.Error()
+	default:
+		status.Phase = databasev1.AccountReady
+		status.Reason = ""
+		status.Message = ""
+		status.ObservedGeneration = generation
+		status.WriteId = pointer.IntPtr(id)
+		if len(a.Changes) > 0 {
+			now := metav1.Now()
+			status.Changes = a.Changes
+			status.ChangeTime = &now
+		}
+	}
+}
+
+// AccountRequeue is when to sync again
+func AccountRequeue(status *databasev1.MysqlAccountStatus) time.Duration {
+	if status.Phase == databasev1.AccountReady {
+		return AccountResync
+	}
+	return AccountRetry
+}
+
+// SyncFinalizer holds the account until dropped if the deletion policy is Delete,
+// returns whether the object changed
+func SyncFinalizer(o client.Object, policy string) bool {
+	want := policy == databasev1.DeletionPolicyDelete
+	if controllerutil.ContainsFinalizer(o, databasev1.Finalizer) == want {
+		return false
+	}
+	if want {
+		controllerutil.AddFinalizer(o, databasev1.Finalizer)
+	} else {
+		controllerutil.RemoveFinalizer(o, databasev1.Finalizer)
+	}
+	return true
+}
+
+// GetAccountMysql returns the mysql holding the account, nil if not found
+func GetAccountMysql(ctx context.Context, c client.Client, k types.NamespacedName) (*databasev1.Mysql, error) {
+	if k.Name == "" {
+		return nil, nil
+	}
+	mysql := &databasev1.Mysql{}
+	err := c.Get(ctx, k, mysql)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mysql, nil
+}
@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	databasev1 "github.com/erda-project/mysql-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var VolumeSnapshotGVK = schema.GroupVersionKind{
+	Group:   "snapshot.storage.k8s.io",
+	Version: "v1",
+	Kind:    "VolumeSnapshot",
+}
+
+// Finalize tears down the mysql according to its deletion policy,
+// the finalizer is removed only when every step is done.
+func (r *MysqlReconciler) Finalize(ctx context.Context, mysql *databasev1.Mysql) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if !controllerutil.ContainsFinalizer(mysql, databasev1.Finalizer) {
+		return ctrl.Result{}, r.Myctl.Purge(mysql.NamespacedName())
+	}
+
+	if mysql.Spec.FinalBackup && mysql.Annotations[databasev1.SkipFinalBackupAnnotation] != "true" {
+		err := r.ResolveSecret(ctx, mysql)
+		done := false
+		if err == nil {
+			done, err = r.Myctl.FinalBackup(mysql)
+		}
+		if err != nil {
+			// the volumes are kept until it succeeds or is skipped
+			log.Error(err, "final backup failed")
+			mysql.SetCondition(databasev1.ConditionBackupFailed, metav1.ConditionTrue, "FinalBackupFailed",
+				err.Error()+", annotate "+databasev1.SkipFinalBackupAnnotation+`: "true" to skip it`)
+			return ctrl.Result{RequeueAfter: time.Minute}, r.Status().Update(ctx, mysql)
+		}
+		if !done {
+			log.Info("waiting for final backup")
+			return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+		}
+	}
+
+	switch mysql.Spec.DeletionPolicy {
+	case databasev1.DeletionPolicyDelete, databasev1.DeletionPolicySnapshotThenDelete:
+		// stop mysqld before touching the volumes
+		stopped, err := r.StopSts(ctx, mysql)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !stopped {
+			log.Info("waiting for pods to stop")
+			return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+		}
+
+		pvcs, err := r.ListPVCs(ctx, mysql)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if mysql.Spec.DeletionPolicy == databasev1.DeletionPolicySnapshotThenDelete {
+			ready, err := r.SnapshotPVCs(ctx, mysql, pvcs)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if !ready {
+				log.Info("waiting for volume snapshots")
+				return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+			}
+		}
+
+		for i := range pvcs {
+			err = r.Delete(ctx, &pvcs[i])
+			if err != nil && !apierrors.IsNotFound(err) {
+				return ctrl.Result{}, err
+			}
+			log.Info("pvc deleted", "Name", pvcs[i].Name)
+		}
+	}
+
+	controllerutil.RemoveFinalizer(mysql, databasev1.Finalizer)
+	if err := r.Update(ctx, mysql); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, r.Myctl.Purge(mysql.NamespacedName())
+}
+
+// StopSts deletes the statefulset, returns whether all pods are gone
+func (r *MysqlReconciler) StopSts(ctx context.Context, mysql *databasev1.Mysql) (bool, error) {
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      mysql.Name,
+			Namespace: mysql.Namespace,
+		},
+	}
+	err := r.Delete(ctx, sts, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if err != nil && !apierrors.IsNotFound(err) {
+		return false, err
+	}
+
+	pods := &corev1.PodList{}
+	err = r.List(ctx, pods, client.InNamespace(mysql.Namespace), client.MatchingLabels(mysql.NewLabels()))
+	if err != nil {
+		return false, err
+	}
+	return len(pods.Items) == 0, nil
+}
+
+// ListPVCs lists the mydir volumes, labeled by the statefulset selector
+func (r *MysqlReconciler) ListPVCs(ctx context.Context, mysql *databasev1.Mysql) ([]corev1.PersistentVolumeClaim, error) {
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	err := r.List(ctx, pvcs, client.InNamespace(mysql.Namespace), client.MatchingLabels(mysql.NewLabels()))
+	if err != nil {
+		return nil, err
+	}
+	return pvcs.Items, nil
+}
+
+// SnapshotPVCs creates a volume snapshot for each pvc, returns whether all are ready to use
+func (r *MysqlReconciler) SnapshotPVCs(ctx context.Context, mysql *databasev1.Mysql, pvcs []corev1.PersistentVolumeClaim) (bool, error) {
+	log := log.FromContext(ctx)
+
+	ready := true
+	for _, pvc := range pvcs {
+		vs := &unstructured.Unstructured{}
+		vs.SetGroupVersionKind(VolumeSnapshotGVK)
+
+		err := r.Get(ctx, client.ObjectKey{Namespace: pvc.Namespace, Name: pvc.Name + "-final"}, vs)
+		if apierrors.IsNotFound(err) {
+			vs.SetName(pvc.Name + "-final")
+			vs.SetNamespace(pvc.Namespace)
+			vs.SetLabels(mysql.NewLabels())
+
+			source := map[string]interface{}{
+				"persistentVolumeClaimName": pvc.Name,
+			}
+			spec := map[string]interface{}{
+				"source": source,
+			}
+			if mysql.Spec.VolumeSnapshotClassName != "" {
+				spec["volumeSnapshotClassName"] = mysql.Spec.VolumeSnapshotClassName
+			}
+			vs.Object["spec"] = spec
+
+			// not owned by the mysql, it must outlive it
+			err = r.Create(ctx, vs)
+			if err != nil {
+				return false, err
+			}
+			log.Info("volume snapshot created", "Name", vs.GetName())
+
+			ready = false
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+
+		ok, _, _ := unstructured.NestedBool(vs.Object, "status", "readyToUse")
+		if !ok {
+			ready = false
+		}
+	}
+
+	return ready, nil
+}
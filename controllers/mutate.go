@@ -1,11 +1,12 @@
 package controllers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"strconv"
 
 	databasev1 "github.com/erda-project/mysql-operator/api/v1"
-	"github.com/erda-project/mysql-operator/pkg/mylet"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -28,19 +29,30 @@ func MutateSts(mysql *databasev1.Mysql, sts *appsv1.StatefulSet) {
 		podLables[k] = v
 	}
 
-	annotations := make(map[string]string, len(mysql.Spec.Annotations))
+	annotations := make(map[string]string, len(mysql.Spec.Annotations)+1)
 	for k, v := range mysql.Spec.Annotations {
 		annotations[k] = v
 	}
+	// dynamic variables are applied by mylet without restart
+	if _, static := mysql.Spec.SplitMysqlConfig(); len(static) > 0 {
+		annotations[databasev1.StaticConfigHashAnnotation] = databasev1.HashConfig(static)
+	}
 
 	spec := mysql.Spec.DeepCopy()
 
+	// immutable once created, the claims are expanded by myctl
+	vcts := sts.Spec.VolumeClaimTemplates
+
 	sts.Spec = appsv1.StatefulSetSpec{
 		ServiceName: mysql.BuildName(databasev1.HeadlessSuffix),
 		Replicas:    pointer.Int32Ptr(int32(mysql.Spec.Size())),
 		Selector: &metav1.LabelSelector{
 			MatchLabels: labels,
 		},
+		// pods are restarted by myctl in a primary aware order
+		UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+			Type: appsv1.OnDeleteStatefulSetStrategyType,
+		},
 		Template: corev1.PodTemplateSpec{
 			ObjectMeta: metav1.ObjectMeta{
 				Labels:      podLables,
@@ -89,8 +101,22 @@ func MutateSts(mysql *databasev1.Mysql, sts *appsv1.StatefulSet) {
 								Value: mysql.Spec.MyctlAddr,
 							},
 							corev1.EnvVar{
-								Name:  "GROUP_TOKEN",
-								Value: mylet.GroupToken(mysql),
+								Name: "GROUP_TOKEN",
+								ValueFrom: &corev1.EnvVarSource{
+									SecretKeyRef: mysql.NewSecretKeySelector(databasev1.GroupTokenKey),
+								},
+							},
+							corev1.EnvVar{
+								Name: "LOCAL_PASSWORD",
+								ValueFrom: &corev1.EnvVarSource{
+									SecretKeyRef: spec.LocalPasswordSecretRef,
+								},
+							},
+							corev1.EnvVar{
+								Name: "REPLICA_PASSWORD",
+								ValueFrom: &corev1.EnvVarSource{
+									SecretKeyRef: spec.ReplicaPasswordSecretRef,
+								},
 							},
 							corev1.EnvVar{
 								Name:  "HTTP_ADDR",
@@ -185,10 +211,52 @@ func MutateSts(mysql *databasev1.Mysql, sts *appsv1.StatefulSet) {
 			},
 		},
 	}
+	if len(vcts) > 0 {
+		sts.Spec.VolumeClaimTemplates = vcts
+	}
+
+	if bs := spec.BackupStorage; bs != nil {
+		c := &sts.Spec.Template.Spec.Containers[0]
+		c.Env = append(c.Env,
+			corev1.EnvVar{
+				Name: "BACKUP_STORAGE_ACCESS_KEY",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: bs.AccessKeySecretRef,
+				},
+			},
+			corev1.EnvVar{
+				Name: "BACKUP_STORAGE_SECRET_KEY",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: bs.SecretKeySecretRef,
+				},
+			},
+		)
+	}
+
+	if be := spec.BackupEncryption; be != nil {
+		c := &sts.Spec.Template.Spec.Containers[0]
+		c.Env = append(c.Env, corev1.EnvVar{
+			Name: "BACKUP_ENCRYPTION_KEY",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: be.KeySecretRef,
+			},
+		})
+	}
 
 	if mysql.Spec.EnableExporter {
-		dsn := fmt.Sprintf("%s:%s@tcp(localhost:%d)/",
-			mysql.Spec.ExporterUsername, mysql.Spec.ExporterPassword, mysql.Spec.Port)
+		exporterPassword := corev1.EnvVar{
+			Name: "EXPORTER_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: spec.ExporterPasswordSecretRef,
+			},
+		}
+
+		c := &sts.Spec.Template.Spec.Containers[0]
+		c.Env = append(c.Env, exporterPassword)
+
+		// $(EXPORTER_PASSWORD) is expanded by kubelet
+		dsn := fmt.Sprintf("%s:$(EXPORTER_PASSWORD)@tcp(localhost:%d)/",
+			mysql.Spec.ExporterUsername, mysql.Spec.Port)
 
 		sts.Spec.Template.Spec.Containers = append(sts.Spec.Template.Spec.Containers, corev1.Container{
 			Name:            "exporter",
@@ -198,6 +266,7 @@ func MutateSts(mysql *databasev1.Mysql, sts *appsv1.StatefulSet) {
 				"--web.listen-address=:" + strconv.Itoa(mysql.Spec.ExporterPort),
 			}, mysql.Spec.ExporterFlags...),
 			Env: NewEnv(
+				exporterPassword,
 				corev1.EnvVar{
 					Name:  "DATA_SOURCE_NAME",
 					Value: dsn,
@@ -252,6 +321,41 @@ func NewEnv(a ...corev1.EnvVar) []corev1.EnvVar {
 	}, a...)
 }
 
+func MutateSecret(mysql *databasev1.Mysql, secret *corev1.Secret) {
+	secret.Labels = mysql.NewLabels()
+	secret.Type = corev1.SecretTypeOpaque
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte, 4)
+	}
+
+	// the pods of an existing mysql present the token computed from its plaintext password until restarted
+	groupToken := ""
+	if mysql.Spec.DeprecatedLocalPassword != "" {
+		groupToken = LegacyGroupToken(mysql)
+	}
+
+	// generate once, seed from the deprecated plaintext fields if any
+	for k, v := range map[string]string{
+		databasev1.LocalPasswordKey:    mysql.Spec.DeprecatedLocalPassword,
+		databasev1.ReplicaPasswordKey:  mysql.Spec.DeprecatedReplicaPassword,
+		databasev1.ExporterPasswordKey: mysql.Spec.DeprecatedExporterPassword,
+		databasev1.GroupTokenKey:       groupToken,
+	} {
+		if len(secret.Data[k]) > 0 {
+			continue
+		}
+		if v == "" {
+			v = databasev1.GeneratePassword(29)
+		}
+		secret.Data[k] = []byte(v)
+	}
+}
+
+// LegacyGroupToken is the group token of a mysql created with a plaintext local password
+func LegacyGroupToken(mysql *databasev1.Mysql) string {
+	return hex.EncodeToString(sha256.New().Sum([]byte(mysql.Spec.LocalUsername + ":" + mysql.Spec.DeprecatedLocalPassword + "@" + mysql.Name)))
+}
+
 func MutateSvc(mysql *databasev1.Mysql, svc *corev1.Service, x string) {
 	svc.Labels = mysql.NewLabels()
 	svc.Spec = corev1.ServiceSpec{
@@ -287,6 +391,6 @@ func MutateSvc(mysql *databasev1.Mysql, svc *corev1.Service, x string) {
 	case "write":
 		svc.Spec.Selector["statefulset.kubernetes.io/pod-name"] = mysql.SoloName(*mysql.Status.WriteId)
 	case "read":
-		svc.Spec.Selector["statefulset.kubernetes.io/pod-name"] = mysql.SoloName(*mysql.Status.ReadId)
+		svc.Spec.Selector[databasev1.ReadLabel] = "true"
 	}
 }
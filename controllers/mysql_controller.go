@@ -18,6 +18,7 @@ package controllers
 
 import (
 	"context"
+	"time"
 
 	databasev1 "github.com/erda-project/mysql-operator/api/v1"
 	"github.com/erda-project/mysql-operator/pkg/myctl"
@@ -28,6 +29,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/source"
@@ -41,6 +43,12 @@ type MysqlReconciler struct {
 }
 
 //+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;patch;delete
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;patch;delete
+//+kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
+//+kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;list;watch;create
 //+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=database.erda.cloud,resources=mysqls,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=database.erda.cloud,resources=mysqls/status,verbs=get;update;patch
@@ -71,9 +79,23 @@ func (r *MysqlReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 
 	mysql.Default()
 
-	if err := r.Myctl.SyncSpec(mysql); err != nil {
+	// the secret may be gone with the namespace, the group keeps the credentials
+	if !mysql.DeletionTimestamp.IsZero() {
+		return r.Finalize(ctx, mysql)
+	}
+
+	if err := r.SyncSecret(ctx, mysql); err != nil {
 		return zeroResult, err
 	}
+	controllerutil.AddFinalizer(mysql, databasev1.Finalizer)
+
+	if err := r.Myctl.SyncSpec(mysql); err != nil {
+		log.Error(err, "sync spec failed")
+		// wait for the next spec change
+		mysql.Status.ObservedGeneration = mysql.Generation
+		mysql.SetCondition(databasev1.ConditionSpecInvalid, metav1.ConditionTrue, "ValidateFailed", err.Error())
+		return zeroResult, r.Status().Update(ctx, mysql)
+	}
 	if err := r.Update(ctx, mysql); err != nil {
 		return zeroResult, err
 	}
@@ -117,6 +139,24 @@ func (r *MysqlReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 	}
 	log.Info("CreateOrUpdate sts succeeded", "OperationResult", opResult)
 
+	converted, err := r.Myctl.Convert(ctx, mysql)
+	if err != nil {
+		log.Error(err, "convert failed")
+		return ctrl.Result{}, err
+	}
+
+	upgraded, err := r.Myctl.Upgrade(ctx, mysql, sts)
+	if err != nil {
+		log.Error(err, "upgrade failed")
+		return ctrl.Result{}, err
+	}
+
+	expanded, err := r.Myctl.ExpandStorage(ctx, mysql)
+	if err != nil {
+		log.Error(err, "expand storage failed")
+		return ctrl.Result{}, err
+	}
+
 	wSvc := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      mysql.BuildName("write"),
@@ -133,6 +173,11 @@ func (r *MysqlReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 	}
 	log.Info("CreateOrUpdate write svc succeeded", "OperationResult", opResult)
 
+	if err = r.SyncReadLabel(ctx, mysql); err != nil {
+		log.Error(err, "sync read label failed")
+		return ctrl.Result{}, err
+	}
+
 	rSvc := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      mysql.BuildName("read"),
@@ -149,6 +194,11 @@ func (r *MysqlReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 	}
 	log.Info("CreateOrUpdate read svc succeeded", "OperationResult", opResult)
 
+	if !converted || !upgraded || !expanded {
+		// status is flushed on the next round
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
 	return zeroResult, nil
 }
 
@@ -158,6 +208,7 @@ func (r *MysqlReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&databasev1.Mysql{}).
 		Owns(&appsv1.StatefulSet{}).
 		Owns(&corev1.Service{}).
+		Owns(&corev1.Secret{}).
 		Watches(
 			&source.Channel{Source: r.Myctl.C},
 			&handler.EnqueueRequestForObject{},
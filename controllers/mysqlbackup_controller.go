@@ -0,0 +1,175 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	databasev1 "github.com/erda-project/mysql-operator/api/v1"
+	"github.com/erda-project/mysql-operator/pkg/myctl"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// MysqlBackupReconciler reconciles a MysqlBackup object
+type MysqlBackupReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Myctl  *myctl.Myctl
+}
+
+//+kubebuilder:rbac:groups=database.erda.cloud,resources=mysqlbackups,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=database.erda.cloud,resources=mysqlbackups/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=database.erda.cloud,resources=mysqlbackups/finalizers,verbs=update
+
+// Reconcile triggers the backup on the chosen solo and tracks it until it finishes,
+// a finished backup is never run again.
+func (r *MysqlBackupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	backup := &databasev1.MysqlBackup{}
+	zeroResult := ctrl.Result{}
+
+	if err := r.Get(ctx, req.NamespacedName, backup); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.Myctl.ForgetBackup(req.NamespacedName)
+			err = nil
+		} else {
+			log.Error(err, "unable to fetch MysqlBackup")
+		}
+		return zeroResult, err
+	}
+
+	if backup.IsFinished() {
+		r.Myctl.ForgetBackup(req.NamespacedName)
+		return zeroResult, nil
+	}
+
+	status := backup.Status.DeepCopy()
+	now := metav1.Now()
+
+	fail := func(reason, message string) {
+		status.Phase = databasev1.BackupFailed
+		status.Reason = reason
+		status.Message = message
+		status.CompletionTime = &now
+	}
+
+	job, ok := r.Myctl.GetBackup(req.NamespacedName)
+	switch {
+	case !ok && status.Phase == databasev1.BackupRunning:
+		// the result is lost with the operator restart
+		fail("Interrupted", "operator restarted during the backup")
+	case !ok:
+		mysql := &databasev1.Mysql{}
+		err := r.Get(ctx, backup.MysqlNamespacedName(), mysql)
+		if apierrors.IsNotFound(err) {
+			fail("MysqlNotFound", "mysql "+backup.Spec.MysqlName+" not found")
+			break
+		}
+		if err != nil {
+			return zeroResult, err
+		}
+		if !mysql.DeletionTimestamp.IsZero() {
+			fail("MysqlDeleting", "mysql "+backup.Spec.MysqlName+" is being deleted")
+			break
+		}
+
+		job, err = r.Myctl.StartBackup(backup)
+		if err == myctl.ErrGroupNotFound {
+			status.Phase = databasev1.BackupPending
+			status.Message = "waiting for mysql " + backup.Spec.MysqlName
+			break
+		}
+		if err != nil {
+			fail("SourceUnavailable", err.Error())
+			break
+		}
+		ok = true
+	}
+
+	if ok {
+		status.SourceId = pointer.IntPtr(job.Id)
+		status.StartTime = &metav1.Time{Time: job.StartTime}
+		switch {
+		case job.Running:
+			status.Phase = databasev1.BackupRunning
+			status.Message = ""
+		case job.Error != nil:
+			fail("BackupFailed", job.Error.Error())
+		default:
+			status.Phase = databasev1.BackupSucceeded
+			status.BackupTime = job.Result.BackupTime
+			status.Incremental = job.Result.Incremental
+			status.Compress = job.Result.Compress
+			status.Size = job.Result.Size
+			status.Location = job.Result.Location
+			status.KeyId = job.Result.KeyId
+			if v := job.Result.Verification; v != nil {
+				status.Verification = &databasev1.MysqlBackupVerification{
+					Verified: v.Verified,
+					Gtid:     v.Gtid,
+					Schemas:  v.Schemas,
+					Tables:   v.Tables,
+					Checked:  v.Checked,
+					Message:  v.Error,
+				}
+				if !v.VerifyTime.IsZero() {
+					status.Verification.VerifyTime = &metav1.Time{Time: v.VerifyTime}
+				}
+			}
+			status.Pruned = job.Result.Pruned
+			status.Reclaimed = job.Result.Reclaimed
+			status.CompletionTime = &now
+		}
+	}
+
+	backup.Status = *status
+	if err := r.Status().Update(ctx, backup); err != nil {
+		log.Error(err, "update status failed")
+		return zeroResult, err
+	}
+
+	if backup.IsFinished() {
+		log.Info("backup finished", "phase", status.Phase, "reason", status.Reason)
+		r.Myctl.ForgetBackup(req.NamespacedName)
+
+		failed, reason, message := false, "BackupSucceeded", "mysqlbackup "+backup.Name
+		if status.Phase == databasev1.BackupFailed {
+			failed, reason, message = true, status.Reason, message+": "+status.Message
+		}
+		err := r.Myctl.SetBackupCondition(backup.MysqlNamespacedName(), failed, reason, message)
+		if err != nil && err != myctl.ErrGroupNotFound {
+			log.Error(err, "set backup condition failed")
+		}
+		return zeroResult, nil
+	}
+
+	return ctrl.Result{RequeueAfter: 15 * time.Second}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *MysqlBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&databasev1.MysqlBackup{}).
+		Complete(r)
+}
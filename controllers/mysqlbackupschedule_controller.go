@@ -0,0 +1,385 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	databasev1 "github.com/erda-project/mysql-operator/api/v1"
+	"github.com/erda-project/mysql-operator/pkg/cron"
+	"github.com/erda-project/mysql-operator/pkg/myctl"
+	"github.com/erda-project/mysql-operator/pkg/mylet"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// MysqlBackupScheduleReconciler reconciles a MysqlBackupSchedule object
+type MysqlBackupScheduleReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Myctl  *myctl.Myctl
+}
+
+//+kubebuilder:rbac:groups=database.erda.cloud,resources=mysqlbackupschedules,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=database.erda.cloud,resources=mysqlbackupschedules/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=database.erda.cloud,resources=mysqlbackupschedules/finalizers,verbs=update
+
+// Reconcile creates the due MysqlBackups one at a time, a missed run is taken once when possible,
+// then prunes the expired chains on the solos and their MysqlBackups.
+func (r *MysqlBackupScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	schedule := &databasev1.MysqlBackupSchedule{}
+	zeroResult := ctrl.Result{}
+
+	if err := r.Get(ctx, req.NamespacedName, schedule); err != nil {
+		if apierrors.IsNotFound(err) {
+			err = nil
+		} else {
+			log.Error(err, "unable to fetch MysqlBackupSchedule")
+		}
+		return zeroResult, err
+	}
+	if !schedule.DeletionTimestamp.IsZero() {
+		return zeroResult, nil
+	}
+
+	status := schedule.Status.DeepCopy()
+	status.Message = ""
+	now := time.Now()
+
+	updateStatus := func() error {
+		schedule.Status = *status
+		err := r.Status().Update(ctx, schedule)
+		if err != nil {
+			log.Error(err, "update status failed")
+		}
+		return err
+	}
+
+	full, err := cron.Parse(schedule.Spec.Full)
+	if err != nil {
+		status.Message = "full: " + err.Error()
+		return zeroResult, updateStatus()
+	}
+	var incremental *cron.Schedule
+	if schedule.Spec.Incremental != "" {
+		incremental, err = cron.Parse(schedule.Spec.Incremental)
+		if err != nil {
+			status.Message = "incremental: " + err.Error()
+			return zeroResult, updateStatus()
+		}
+	}
+
+	list := &databasev1.MysqlBackupList{}
+	err = r.List(ctx, list, client.InNamespace(schedule.Namespace), client.MatchingLabels{databasev1.ScheduleLabel: schedule.Name})
+	if err != nil {
+		return zeroResult, err
+	}
+	backups := list.Items
+	sort.Slice(backups, func(i, j int) bool {
+		ti, tj := backups[i].CreationTimestamp, backups[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+		return backups[i].Name < backups[j].Name
+	})
+
+	running := false
+	var lastFull *databasev1.MysqlBackup
+	for i := range backups {
+		b := &backups[i]
+		if !b.IsFinished() && now.Sub(b.CreationTimestamp.Time) > BackupTimeout {
+			if err = r.TimeoutBackup(ctx, b, now); err != nil {
+				return zeroResult, err
+			}
+			log.Info("backup timed out", "name", b.Name, "phase", b.Status.Phase)
+		}
+		if !b.IsFinished() {
+			running = true
+		} else if b.Status.Phase == databasev1.BackupSucceeded && b.Spec.Type != databasev1.BackupIncremental {
+			lastFull = b
+		}
+	}
+
+	keep, maxAge := 0, time.Duration(0)
+	if schedule.Spec.KeepChains != nil {
+		keep = *schedule.Spec.KeepChains
+	}
+	if schedule.Spec.MaxAge != nil {
+		maxAge = schedule.Spec.MaxAge.Duration
+	}
+
+	if pruned, err := r.PruneRecords(ctx, schedule, backups, keep, maxAge, now); err != nil {
+		log.Error(err, "prune backups failed")
+		status.Message = "prune: " + err.Error()
+	} else if pruned > 0 && lastFull != nil {
+		status.LastPruned = lastFull.Name
+	}
+
+	lastFullTime := schedule.CreationTimestamp.Time
+	if t := status.LastFullTime; t != nil && t.After(lastFullTime) {
+		lastFullTime = t.Time
+	}
+	nextFull := full.Next(lastFullTime)
+	status.NextFullTime = nil
+	if !nextFull.IsZero() {
+		status.NextFullTime = &metav1.Time{Time: nextFull}
+	}
+
+	var nextIncremental time.Time
+	status.NextIncrementalTime = nil
+	if incremental != nil {
+		lastTime := lastFullTime
+		if t := status.LastIncrementalTime; t != nil && t.After(lastTime) {
+			lastTime = t.Time
+		}
+		nextIncremental = incremental.Next(lastTime)
+		if !nextIncremental.IsZero() {
+			status.NextIncrementalTime = &metav1.Time{Time: nextIncremental}
+		}
+	}
+
+	due := ""
+	switch {
+	case !nextFull.IsZero() && !now.Before(nextFull):
+		due = databasev1.BackupFull
+	case !nextIncremental.IsZero() && !now.Before(nextIncremental):
+		due = databasev1.BackupIncremental
+	}
+
+	var requeueAfter time.Duration
+	switch {
+	case schedule.Spec.Suspend:
+		status.Message = "suspended"
+	case due != "" && running:
+		// one backup at a time, the due one runs once the previous finishes
+		status.Message = "waiting for the previous backup"
+		requeueAfter = 30 * time.Second
+	case due != "":
+		mysql := &databasev1.Mysql{}
+		err = r.Get(ctx, schedule.MysqlNamespacedName(), mysql)
+		if apierrors.IsNotFound(err) {
+			status.Message = "mysql " + schedule.Spec.MysqlName + " not found"
+			requeueAfter = time.Minute
+			break
+		}
+		if err != nil {
+			return zeroResult, err
+		}
+
+		backup, err := r.NewBackup(schedule, due, lastFull, now)
+		if err != nil {
+			return zeroResult, err
+		}
+		if err = r.Create(ctx, backup); err != nil && !apierrors.IsAlreadyExists(err) {
+			log.Error(err, "create backup failed", "name", backup.Name)
+			return zeroResult, err
+		}
+		log.Info("backup created", "name", backup.Name, "type", backup.Spec.Type)
+
+		status.LastBackup = backup.Name
+		if backup.Spec.Type == databasev1.BackupIncremental {
+			status.LastIncrementalTime = &metav1.Time{Time: now}
+		} else {
+			status.LastFullTime = &metav1.Time{Time: now}
+			status.NextFullTime = &metav1.Time{Time: full.Next(now)}
+		}
+		if incremental != nil {
+			status.NextIncrementalTime = &metav1.Time{Time: incremental.Next(now)}
+		}
+		// the owned backup finishing triggers the next reconcile
+		requeueAfter = 30 * time.Second
+	default:
+		for _, t := range []*metav1.Time{status.NextFullTime, status.NextIncrementalTime} {
+			if t != nil && (requeueAfter == 0 || t.Sub(now) < requeueAfter) {
+				requeueAfter = t.Sub(now)
+			}
+		}
+		if requeueAfter > 0 {
+			requeueAfter += time.Second
+		}
+	}
+
+	if err = updateStatus(); err != nil {
+		return zeroResult, err
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// BackupTimeout is how long a scheduled backup may stay unfinished before the later runs go on,
+// a running backup is given up by myctl after 8 hours
+const BackupTimeout = mylet.Hour8 + time.Hour
+
+// TimeoutBackup fails the pending or stuck backup so that it does not block the later runs
+func (r *MysqlBackupScheduleReconciler) TimeoutBackup(ctx context.Context, backup *databasev1.MysqlBackup, now time.Time) error {
+	message := fmt.Sprintf("not finished in %s", BackupTimeout)
+	if backup.Status.Phase != "" {
+		message += ", " + backup.Status.Phase
+	}
+	if backup.Status.Message != "" {
+		message += ": " + backup.Status.Message
+	}
+	backup.Status.Phase = databasev1.BackupFailed
+	backup.Status.Reason = "Timeout"
+	backup.Status.Message = message
+	backup.Status.CompletionTime = &metav1.Time{Time: now}
+	if err := r.Status().Update(ctx, backup); err != nil {
+		return err
+	}
+
+	err := r.Myctl.SetBackupCondition(backup.MysqlNamespacedName(), true, "Timeout", "mysqlbackup "+backup.Name+": "+message)
+	if err == myctl.ErrGroupNotFound {
+		err = nil
+	}
+	return err
+}
+
+// NewBackup builds the due backup, an incremental one is taken on the solo of the latest full backup,
+// a full one is taken instead if there is none.
+func (r *MysqlBackupScheduleReconciler) NewBackup(schedule *databasev1.MysqlBackupSchedule, typ string, lastFull *databasev1.MysqlBackup, now time.Time) (*databasev1.MysqlBackup, error) {
+	spec := databasev1.MysqlBackupSpec{
+		MysqlName: schedule.Spec.MysqlName,
+		Type:      databasev1.BackupFull,
+		Source:    schedule.Spec.Source,
+		SourceId:  schedule.Spec.SourceId,
+		Compress:  schedule.Spec.Compress,
+		Verify:    schedule.Spec.Verify,
+	}
+	if typ == databasev1.BackupIncremental && lastFull != nil && lastFull.Status.SourceId != nil {
+		id := *lastFull.Status.SourceId
+		spec.Type = databasev1.BackupIncremental
+		spec.Source = databasev1.BackupSourceSolo
+		spec.SourceId = &id
+	}
+
+	suffix := "full"
+	if spec.Type == databasev1.BackupIncremental {
+		suffix = "inc"
+	}
+
+	backup := &databasev1.MysqlBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%s-%s", schedule.Name, suffix, strconv.FormatInt(now.Unix(), 10)),
+			Namespace: schedule.Namespace,
+			Labels: map[string]string{
+				databasev1.ScheduleLabel: schedule.Name,
+			},
+		},
+		Spec: spec,
+	}
+	if err := ctrl.SetControllerReference(schedule, backup, r.Scheme); err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+// PruneRecords removes the chains of the schedule beyond the retention from the solos,
+// then deletes their succeeded backups, and the failed backups beyond the history limit.
+// The chains of other schedules or taken by hand are left alone. It returns the chains pruned.
+func (r *MysqlBackupScheduleReconciler) PruneRecords(ctx context.Context, schedule *databasev1.MysqlBackupSchedule, backups []databasev1.MysqlBackup, keep int, maxAge time.Duration, now time.Time) (int, error) {
+	type chain struct {
+		sourceId   int
+		backupTime string
+		start      time.Time
+		backups    []*databasev1.MysqlBackup
+	}
+	chains := make(map[string]*chain)
+	var order []string
+	var failed []*databasev1.MysqlBackup
+
+	for i := range backups {
+		b := &backups[i]
+		switch {
+		case b.Status.Phase == databasev1.BackupFailed:
+			failed = append(failed, b)
+		case b.Status.Phase == databasev1.BackupSucceeded && b.Status.SourceId != nil:
+			k := strconv.Itoa(*b.Status.SourceId) + "/" + b.Status.BackupTime
+			c, ok := chains[k]
+			if !ok {
+				c = &chain{
+					sourceId:   *b.Status.SourceId,
+					backupTime: b.Status.BackupTime,
+					start:      b.CreationTimestamp.Time,
+				}
+				chains[k] = c
+				order = append(order, k)
+			}
+			c.backups = append(c.backups, b)
+		}
+	}
+
+	var expired []*databasev1.MysqlBackup
+	limit := 3
+	if schedule.Spec.FailedHistoryLimit != nil {
+		limit = *schedule.Spec.FailedHistoryLimit
+	}
+	if n := len(failed) - limit; n > 0 {
+		expired = append(expired, failed[:n]...)
+	}
+
+	pruned := 0
+	var err error
+	if keep > 0 || maxAge > 0 {
+		m := make(map[int][]string)
+		var records []*databasev1.MysqlBackup
+		for i, k := range order {
+			n := len(order) - i // newer chains including this one
+			if n == 1 {
+				break
+			}
+			c := chains[k]
+			if (keep <= 0 || n <= keep) && (maxAge <= 0 || now.Sub(c.start) <= maxAge) {
+				continue
+			}
+			m[c.sourceId] = append(m[c.sourceId], c.backupTime)
+			records = append(records, c.backups...)
+			pruned++
+		}
+		if pruned > 0 {
+			// the records are kept to retry until their chains are gone
+			_, err = r.Myctl.PruneChains(ctx, schedule.MysqlNamespacedName(), m)
+			if err == nil {
+				expired = append(expired, records...)
+			} else {
+				pruned = 0
+			}
+		}
+	}
+
+	for _, b := range expired {
+		if e := r.Delete(ctx, b); e != nil && !apierrors.IsNotFound(e) {
+			return pruned, e
+		}
+	}
+	return pruned, err
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *MysqlBackupScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&databasev1.MysqlBackupSchedule{}).
+		Owns(&databasev1.MysqlBackup{}).
+		Complete(r)
+}
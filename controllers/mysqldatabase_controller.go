@@ -0,0 +1,189 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	databasev1 "github.com/erda-project/mysql-operator/api/v1"
+	"github.com/erda-project/mysql-operator/pkg/myctl"
+	"github.com/erda-project/mysql-operator/pkg/mylet"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// MysqlDatabaseReconciler reconciles a MysqlDatabase object
+type MysqlDatabaseReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Myctl  *myctl.Myctl
+}
+
+//+kubebuilder:rbac:groups=database.erda.cloud,resources=mysqldatabases,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=database.erda.cloud,resources=mysqldatabases/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=database.erda.cloud,resources=mysqldatabases/finalizers,verbs=update
+
+// Reconcile creates the database on the writer or alters its defaults, synced again every minute,
+// it is dropped with the resource if the deletion policy is Delete.
+func (r *MysqlDatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	database := &databasev1.MysqlDatabase{}
+	zeroResult := ctrl.Result{}
+
+	if err := r.Get(ctx, req.NamespacedName, database); err != nil {
+		if apierrors.IsNotFound(err) {
+			err = nil
+		} else {
+			log.Error(err, "unable to fetch MysqlDatabase")
+		}
+		return zeroResult, err
+	}
+
+	spec := database.Spec
+	database.Default()
+	status := database.Status.DeepCopy()
+
+	if !database.DeletionTimestamp.IsZero() {
+		return r.Finalize(ctx, database, status)
+	}
+
+	if err := database.Validate(); err != nil {
+		status.Phase = databasev1.AccountFailed
+		status.Reason = "SpecInvalid"
+		status.Message = err.Error()
+	} else {
+		// the defaults are persisted, the schema shows in the list
+		if SyncFinalizer(database, database.Spec.DeletionPolicy) || spec != database.Spec {
+			if err := r.Update(ctx, database); err != nil {
+				return zeroResult, err
+			}
+		}
+
+		k := database.MysqlNamespacedName()
+		mysql := &databasev1.Mysql{}
+		err := r.Get(ctx, k, mysql)
+		switch {
+		case apierrors.IsNotFound(err):
+			status.Phase = databasev1.AccountPending
+			status.Reason = ""
+			status.Message = "waiting for mysql " + k.Name
+		case err != nil:
+			return zeroResult, err
+		case !mysql.DeletionTimestamp.IsZero():
+			status.Phase = databasev1.AccountPending
+			status.Reason = ""
+			status.Message = "mysql " + k.Name + " is being deleted"
+		default:
+			id, a, err := r.Myctl.ApplyDatabase(ctx, k, mylet.DatabaseRequest{
+				Name:      database.Spec.Name,
+				Charset:   database.Spec.Charset,
+				Collation: database.Spec.Collation,
+			})
+			if err == nil && status.AppliedName != "" && status.AppliedName != database.Spec.Name {
+				// renamed, the old schema is left behind unless dropped
+				if database.Spec.DeletionPolicy == databasev1.DeletionPolicyDelete {
+					var d mylet.AccountResult
+					_, d, err = r.Myctl.ApplyDatabase(ctx, k, mylet.DatabaseRequest{
+						Name: status.AppliedName,
+						Drop: true,
+					})
+					a.Changes = append(a.Changes, d.Changes...)
+				}
+				if err == nil {
+					log.Info("old database released", "name", status.AppliedName,
+						"dropped", database.Spec.DeletionPolicy == databasev1.DeletionPolicyDelete)
+				}
+			}
+			if err == nil {
+				status.AppliedName = database.Spec.Name
+			}
+			SyncAccountStatus(status, database.Generation, id, a, err)
+			if len(a.Changes) > 0 {
+				log.Info("database synced", "changes", a.Changes)
+			}
+		}
+	}
+
+	if !equality.Semantic.DeepEqual(&database.Status, status) {
+		database.Status = *status
+		if err := r.Status().Update(ctx, database); err != nil {
+			log.Error(err, "update status failed")
+			return zeroResult, err
+		}
+	}
+
+	if status.Reason == "SpecInvalid" {
+		// wait for the next spec change
+		return zeroResult, nil
+	}
+	return ctrl.Result{RequeueAfter: AccountRequeue(status)}, nil
+}
+
+// Finalize drops the database if the mysql still holds it, then releases the resource
+func (r *MysqlDatabaseReconciler) Finalize(ctx context.Context, database *databasev1.MysqlDatabase, status *databasev1.MysqlAccountStatus) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if !controllerutil.ContainsFinalizer(database, databasev1.Finalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	k := database.MysqlNamespacedName()
+	mysql := &databasev1.Mysql{}
+	err := r.Get(ctx, k, mysql)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	// the one applied, the spec may have changed since
+	name, valid := status.AppliedName, true
+	if name == "" {
+		name, valid = database.Spec.Name, database.Validate() == nil
+	}
+
+	// gone with the mysql otherwise
+	if err == nil && mysql.DeletionTimestamp.IsZero() &&
+		database.Spec.DeletionPolicy == databasev1.DeletionPolicyDelete && valid {
+		_, _, err = r.Myctl.ApplyDatabase(ctx, k, mylet.DatabaseRequest{
+			Name: name,
+			Drop: true,
+		})
+		if err != nil {
+			log.Error(err, "drop database failed")
+			status.Phase = databasev1.AccountFailed
+			status.Reason = "DropFailed"
+			status.Message = err.Error()
+			database.Status = *status
+			return ctrl.Result{RequeueAfter: AccountRetry}, r.Status().Update(ctx, database)
+		}
+		log.Info("database dropped", "name", name)
+	}
+
+	controllerutil.RemoveFinalizer(database, databasev1.Finalizer)
+	return ctrl.Result{}, r.Update(ctx, database)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *MysqlDatabaseReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&databasev1.MysqlDatabase{}).
+		Complete(r)
+}
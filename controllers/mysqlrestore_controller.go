@@ -0,0 +1,335 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	databasev1 "github.com/erda-project/mysql-operator/api/v1"
+	"github.com/erda-project/mysql-operator/pkg/myctl"
+	"github.com/erda-project/mysql-operator/pkg/mylet"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Ask the solo again if it did not report in time
+const RestoreRetry = 2 * time.Minute
+
+// How long the restarted solos have to come back green restored,
+// a reseed fetching with xtrabackup takes up to 8 hours, failover is held meanwhile
+const RestoreTimeout = 10 * time.Hour
+
+// MysqlRestoreReconciler reconciles a MysqlRestore object
+type MysqlRestoreReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Myctl  *myctl.Myctl
+}
+
+//+kubebuilder:rbac:groups=database.erda.cloud,resources=mysqlrestores,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=database.erda.cloud,resources=mysqlrestores/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=database.erda.cloud,resources=mysqlrestores/finalizers,verbs=update
+
+// Reconcile restores the backup on the primary, which restarts onto it,
+// then the replicas restart and fetch the restored data, the nearest to the primary first.
+// A missing mysql is created from the template and restored once green.
+func (r *MysqlRestoreReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	restore := &databasev1.MysqlRestore{}
+	zeroResult := ctrl.Result{}
+
+	if err := r.Get(ctx, req.NamespacedName, restore); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.Myctl.ForgetRestore(req.NamespacedName)
+			err = nil
+		} else {
+			log.Error(err, "unable to fetch MysqlRestore")
+		}
+		return zeroResult, err
+	}
+
+	if restore.IsFinished() {
+		return zeroResult, nil
+	}
+
+	status := restore.Status.DeepCopy()
+	now := metav1.Now()
+	k := restore.MysqlNamespacedName()
+
+	fail := func(reason, message string) {
+		status.Phase = databasev1.RestoreFailed
+		status.Reason = reason
+		status.Message = message
+		status.CompletionTime = &now
+	}
+
+	mysql := &databasev1.Mysql{}
+	err := r.Get(ctx, k, mysql)
+	switch {
+	case apierrors.IsNotFound(err) && status.Created:
+		// not in the cache yet
+		status.Message = "waiting for mysql " + k.Name
+	case apierrors.IsNotFound(err) && restore.Spec.Template == nil:
+		fail("MysqlNotFound", "mysql "+k.Name+" not found and no template")
+	case apierrors.IsNotFound(err):
+		mysql = &databasev1.Mysql{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      k.Name,
+				Namespace: k.Namespace,
+			},
+			Spec: *restore.Spec.Template.DeepCopy(),
+		}
+		if err = r.Create(ctx, mysql); err != nil {
+			log.Error(err, "create mysql failed")
+			return zeroResult, err
+		}
+		log.Info("mysql created", "name", k.Name)
+		status.Created = true
+		status.Phase = databasev1.RestoreCreating
+		status.Message = "waiting for mysql " + k.Name + " to be green"
+	case err != nil:
+		return zeroResult, err
+	case !mysql.DeletionTimestamp.IsZero():
+		fail("MysqlDeleting", "mysql "+k.Name+" is being deleted")
+	default:
+		r.Step(ctx, restore, mysql, status, fail)
+	}
+
+	if status.Phase == databasev1.RestoreFailed && status.StartTime != nil {
+		r.Myctl.FinishRestore(k, restore.Name)
+	}
+
+	restore.Status = *status
+	if err := r.Status().Update(ctx, restore); err != nil {
+		log.Error(err, "update status failed")
+		return zeroResult, err
+	}
+
+	if restore.IsFinished() {
+		log.Info("restore finished", "phase", status.Phase, "reason", status.Reason)
+		return zeroResult, nil
+	}
+
+	return ctrl.Result{RequeueAfter: 15 * time.Second}, nil
+}
+
+// Step advances the restore of the existing mysql
+func (r *MysqlRestoreReconciler) Step(ctx context.Context, restore *databasev1.MysqlRestore, mysql *databasev1.Mysql, status *databasev1.MysqlRestoreStatus, fail func(reason, message string)) {
+	log := log.FromContext(ctx)
+	k := mysql.NamespacedName()
+	name := restore.Name
+	now := metav1.Now()
+	reports := r.Myctl.RestoreReports(k)
+
+	restored := func(id int) bool {
+		s := mysql.Status.Solos[id].Status
+		return reports[id].Restored == name && s.Color == databasev1.Green
+	}
+	requested := func() bool {
+		return status.RequestTime != nil && now.Sub(status.RequestTime.Time) < RestoreRetry
+	}
+
+	switch status.Phase {
+	case "", databasev1.RestorePending, databasev1.RestoreCreating:
+		if mysql.Spec.PrimaryMode != databasev1.ModeClassic {
+			fail("Unsupported", string(mysql.Spec.PrimaryMode)+" mysql is not restored in place")
+			return
+		}
+		if status.Phase == "" {
+			status.Phase = databasev1.RestorePending
+		}
+		if mysql.Status.Color != databasev1.Green || mysql.Status.WriteId == nil {
+			status.Message = "waiting for mysql " + k.Name + " to be green"
+			return
+		}
+
+		src, err := r.Source(ctx, restore)
+		if err == myctl.ErrGroupNotFound {
+			status.Message = "waiting for the source mysql"
+			return
+		}
+		if err != nil {
+			fail("SourceUnavailable", err.Error())
+			return
+		}
+
+		if err = r.Myctl.StartRestore(k, name); err == myctl.ErrGroupNotFound {
+			status.Message = "waiting for mysql " + k.Name
+			return
+		} else if err != nil {
+			fail("Conflict", err.Error())
+			return
+		}
+
+		id := *mysql.Status.WriteId
+		status.StartTime = &now
+		status.PrimaryId = pointer.IntPtr(id)
+		if err = r.Myctl.RequestRestore(ctx, k, id, src); err != nil {
+			fail("StageFailed", err.Error())
+			return
+		}
+		status.Phase = databasev1.RestoreStaging
+		status.RequestTime = &now
+		status.Message = "staging on " + mysql.SoloName(id)
+	case databasev1.RestoreStaging:
+		id := *status.PrimaryId
+		switch rep := reports[id]; {
+		case rep.Failed == name:
+			fail("StageFailed", mysql.SoloName(id)+" "+rep.Error)
+		case rep.Staged == name:
+			if err := r.Myctl.RestartSolo(ctx, mysql, id); err != nil {
+				status.Message = err.Error()
+				return
+			}
+			status.Phase = databasev1.RestoreRestarting
+			status.RequestTime = &now
+			status.Message = "restarting " + mysql.SoloName(id)
+		case rep.Staging != name && !requested():
+			// the request is lost with a mylet restart
+			src, err := r.Source(ctx, restore)
+			if err == nil {
+				err = r.Myctl.RequestRestore(ctx, k, id, src)
+			}
+			if err != nil {
+				status.Message = err.Error()
+				return
+			}
+			status.RequestTime = &now
+		}
+	case databasev1.RestoreRestarting:
+		id := *status.PrimaryId
+		if rep := reports[id]; rep.Failed == name {
+			fail("ApplyFailed", mysql.SoloName(id)+" "+rep.Error)
+			return
+		}
+		if !restored(id) {
+			if status.RequestTime != nil && now.Sub(status.RequestTime.Time) > RestoreTimeout {
+				fail("Timeout", mysql.SoloName(id)+" not restored in "+RestoreTimeout.String())
+			}
+			return
+		}
+		log.Info("primary restored", "solo", mysql.SoloName(id))
+		status.RestoredIds = []int{id}
+		status.Phase = databasev1.RestoreReseeding
+		// when the reseeding started
+		status.RequestTime = &now
+		fallthrough
+	case databasev1.RestoreReseeding:
+		n := mysql.Spec.Size()
+		for id := 0; id < n; id++ {
+			if !containsInt(status.RestoredIds, id) && restored(id) {
+				status.RestoredIds = append(status.RestoredIds, id)
+			}
+		}
+		sort.Ints(status.RestoredIds)
+		if len(status.RestoredIds) == n {
+			r.Myctl.FinishRestore(k, name)
+			status.Phase = databasev1.RestoreSucceeded
+			status.Message = ""
+			status.CompletionTime = &now
+			return
+		}
+		for _, id := range status.ReseedIds {
+			if rep := reports[id]; rep.Failed == name && !containsInt(status.RestoredIds, id) {
+				fail("ReseedFailed", mysql.SoloName(id)+" "+rep.Error)
+				return
+			}
+		}
+		if status.RequestTime != nil && now.Sub(status.RequestTime.Time) > RestoreTimeout {
+			fail("Timeout", fmt.Sprintf("%d of %d solos restored in %s", len(status.RestoredIds), n, RestoreTimeout))
+			return
+		}
+		// a solo fetches from its source once the source is restored,
+		// the request survives restarts so it is sent once
+		for id := 0; id < n; id++ {
+			if containsInt(status.ReseedIds, id) || containsInt(status.RestoredIds, id) {
+				continue
+			}
+			source := *mysql.Status.Solos[id].Spec.SourceId
+			if source == -1 {
+				source = *status.PrimaryId
+			}
+			if !containsInt(status.RestoredIds, source) {
+				continue
+			}
+
+			rr := mylet.RestoreRequest{
+				Name:   name,
+				Action: mylet.RestoreReseed,
+			}
+			if err := r.Myctl.RequestRestore(ctx, k, id, rr); err != nil {
+				status.Message = mysql.SoloName(id) + " " + err.Error()
+				continue
+			}
+			status.ReseedIds = append(status.ReseedIds, id)
+			if err := r.Myctl.RestartSolo(ctx, mysql, id); err != nil {
+				status.Message = err.Error()
+				continue
+			}
+			status.Message = "reseeding " + mysql.SoloName(id)
+		}
+	}
+}
+
+func containsInt(a []int, i int) bool {
+	for _, v := range a {
+		if v == i {
+			return true
+		}
+	}
+	return false
+}
+
+// Source resolves the MysqlBackup if any, then the archive to stage
+func (r *MysqlRestoreReconciler) Source(ctx context.Context, restore *databasev1.MysqlRestore) (mylet.RestoreRequest, error) {
+	restore = restore.DeepCopy()
+	src := &restore.Spec.Source
+	if src.BackupName != "" {
+		backup := &databasev1.MysqlBackup{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: restore.Namespace, Name: src.BackupName}, backup)
+		if err != nil {
+			return mylet.RestoreRequest{}, err
+		}
+		if backup.Status.Phase != databasev1.BackupSucceeded {
+			return mylet.RestoreRequest{}, fmt.Errorf("backup %s is %s", backup.Name, backup.Status.Phase)
+		}
+		src.MysqlName = backup.Spec.MysqlName
+		src.SoloId = backup.Status.SourceId
+		src.BackupTime = backup.Status.BackupTime
+		src.Incremental = pointer.IntPtr(backup.Status.Incremental)
+	}
+	if src.URL == "" && src.MysqlName == "" {
+		src.MysqlName = restore.Spec.MysqlName
+	}
+	return r.Myctl.RestoreRequest(ctx, restore)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *MysqlRestoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&databasev1.MysqlRestore{}).
+		Complete(r)
+}
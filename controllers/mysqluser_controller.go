@@ -0,0 +1,203 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	databasev1 "github.com/erda-project/mysql-operator/api/v1"
+	"github.com/erda-project/mysql-operator/pkg/myctl"
+	"github.com/erda-project/mysql-operator/pkg/mylet"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// MysqlUserReconciler reconciles a MysqlUser object
+type MysqlUserReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Myctl  *myctl.Myctl
+}
+
+//+kubebuilder:rbac:groups=database.erda.cloud,resources=mysqlusers,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=database.erda.cloud,resources=mysqlusers/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=database.erda.cloud,resources=mysqlusers/finalizers,verbs=update
+
+// Reconcile creates the user on the writer or resets its password, connection limit and grants,
+// synced again every minute, it is dropped with the resource if the deletion policy is Delete.
+func (r *MysqlUserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	user := &databasev1.MysqlUser{}
+	zeroResult := ctrl.Result{}
+
+	if err := r.Get(ctx, req.NamespacedName, user); err != nil {
+		if apierrors.IsNotFound(err) {
+			err = nil
+		} else {
+			log.Error(err, "unable to fetch MysqlUser")
+		}
+		return zeroResult, err
+	}
+
+	spec := user.Spec.DeepCopy()
+	user.Default()
+	status := user.Status.DeepCopy()
+
+	if !user.DeletionTimestamp.IsZero() {
+		return r.Finalize(ctx, user, status)
+	}
+
+	k := user.MysqlNamespacedName()
+	mysql, err := GetAccountMysql(ctx, r.Client, k)
+	if err != nil {
+		return zeroResult, err
+	}
+
+	if err := user.Validate(mysql); err != nil {
+		status.Phase = databasev1.AccountFailed
+		status.Reason = "SpecInvalid"
+		status.Message = err.Error()
+	} else {
+		// the defaults are persisted, the username shows in the list
+		if SyncFinalizer(user, user.Spec.DeletionPolicy) || !equality.Semantic.DeepEqual(spec, &user.Spec) {
+			if err := r.Update(ctx, user); err != nil {
+				return zeroResult, err
+			}
+		}
+
+		switch {
+		case mysql == nil:
+			status.Phase = databasev1.AccountPending
+			status.Reason = ""
+			status.Message = "waiting for mysql " + k.Name
+		case !mysql.DeletionTimestamp.IsZero():
+			status.Phase = databasev1.AccountPending
+			status.Reason = ""
+			status.Message = "mysql " + k.Name + " is being deleted"
+		default:
+			password, err := GetSecretKey(ctx, r.Client, user.Namespace, user.Spec.PasswordSecretRef)
+			if err != nil {
+				status.Phase = databasev1.AccountFailed
+				status.Reason = "SecretUnavailable"
+				status.Message = err.Error()
+				break
+			}
+			id, a, err := r.Myctl.ApplyUser(ctx, k, mylet.UserRequest{
+				Username:           user.Spec.Username,
+				Host:               user.Spec.Host,
+				Password:           password,
+				Grants:             user.Spec.Grants,
+				MaxUserConnections: user.Spec.MaxUserConnections,
+			})
+			if err == nil && status.AppliedName != "" &&
+				(status.AppliedName != user.Spec.Username || status.AppliedHost != user.Spec.Host) {
+				// renamed, the old user is left behind unless dropped
+				if user.Spec.DeletionPolicy == databasev1.DeletionPolicyDelete {
+					var d mylet.AccountResult
+					_, d, err = r.Myctl.ApplyUser(ctx, k, mylet.UserRequest{
+						Username: status.AppliedName,
+						Host:     status.AppliedHost,
+						Drop:     true,
+					})
+					a.Changes = append(a.Changes, d.Changes...)
+				}
+				if err == nil {
+					log.Info("old user released", "username", status.AppliedName, "host", status.AppliedHost,
+						"dropped", user.Spec.DeletionPolicy == databasev1.DeletionPolicyDelete)
+				}
+			}
+			if err == nil {
+				status.AppliedName = user.Spec.Username
+				status.AppliedHost = user.Spec.Host
+			}
+			SyncAccountStatus(status, user.Generation, id, a, err)
+			if len(a.Changes) > 0 {
+				log.Info("user synced", "changes", a.Changes)
+			}
+		}
+	}
+
+	if !equality.Semantic.DeepEqual(&user.Status, status) {
+		user.Status = *status
+		if err := r.Status().Update(ctx, user); err != nil {
+			log.Error(err, "update status failed")
+			return zeroResult, err
+		}
+	}
+
+	if status.Reason == "SpecInvalid" {
+		// wait for the next spec change
+		return zeroResult, nil
+	}
+	return ctrl.Result{RequeueAfter: AccountRequeue(status)}, nil
+}
+
+// Finalize drops the user if the mysql still holds it, then releases the resource
+func (r *MysqlUserReconciler) Finalize(ctx context.Context, user *databasev1.MysqlUser, status *databasev1.MysqlAccountStatus) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if !controllerutil.ContainsFinalizer(user, databasev1.Finalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	k := user.MysqlNamespacedName()
+	mysql := &databasev1.Mysql{}
+	err := r.Get(ctx, k, mysql)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	// the one applied, the spec may have changed since
+	username, host, valid := status.AppliedName, status.AppliedHost, true
+	if username == "" {
+		username, host, valid = user.Spec.Username, user.Spec.Host, user.Validate(mysql) == nil
+	}
+
+	// gone with the mysql otherwise
+	if err == nil && mysql.DeletionTimestamp.IsZero() &&
+		user.Spec.DeletionPolicy == databasev1.DeletionPolicyDelete && valid {
+		_, _, err = r.Myctl.ApplyUser(ctx, k, mylet.UserRequest{
+			Username: username,
+			Host:     host,
+			Drop:     true,
+		})
+		if err != nil {
+			log.Error(err, "drop user failed")
+			status.Phase = databasev1.AccountFailed
+			status.Reason = "DropFailed"
+			status.Message = err.Error()
+			user.Status = *status
+			return ctrl.Result{RequeueAfter: AccountRetry}, r.Status().Update(ctx, user)
+		}
+		log.Info("user dropped", "username", username, "host", host)
+	}
+
+	controllerutil.RemoveFinalizer(user, databasev1.Finalizer)
+	return ctrl.Result{}, r.Update(ctx, user)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *MysqlUserReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&databasev1.MysqlUser{}).
+		Complete(r)
+}
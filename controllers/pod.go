@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+
+	databasev1 "github.com/erda-project/mysql-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// SyncReadLabel labels the pods of status.readIds to be selected by the read service
+func (r *MysqlReconciler) SyncReadLabel(ctx context.Context, mysql *databasev1.Mysql) error {
+	log := log.FromContext(ctx)
+
+	read := make(map[string]bool, len(mysql.Status.ReadIds))
+	for _, id := range mysql.Status.ReadIds {
+		read[mysql.SoloName(id)] = true
+	}
+
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods, client.InNamespace(mysql.Namespace), client.MatchingLabels(mysql.NewLabels()))
+	if err != nil {
+		return err
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		v := strconv.FormatBool(read[pod.Name])
+		if pod.Labels[databasev1.ReadLabel] == v {
+			continue
+		}
+
+		patch := client.MergeFrom(pod.DeepCopy())
+		if pod.Labels == nil {
+			pod.Labels = make(map[string]string, 1)
+		}
+		pod.Labels[databasev1.ReadLabel] = v
+		if err = r.Patch(ctx, pod, patch); err != nil {
+			return err
+		}
+		log.Info("label pod succeeded", "Name", pod.Name, databasev1.ReadLabel, v)
+	}
+
+	return nil
+}
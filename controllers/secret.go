@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	databasev1 "github.com/erda-project/mysql-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// SyncSecret creates or updates the operator generated secret and resolves
+// the credentials referenced by mysql, they are never written back to the spec.
+func (r *MysqlReconciler) SyncSecret(ctx context.Context, mysql *databasev1.Mysql) error {
+	log := log.FromContext(ctx)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      mysql.BuildName(databasev1.SecretSuffix),
+			Namespace: mysql.Namespace,
+		},
+	}
+	opResult, err := ctrl.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		MutateSecret(mysql, secret)
+		return ctrl.SetControllerReference(mysql, secret, r.Scheme)
+	})
+	if err != nil {
+		log.Error(err, "CreateOrUpdate secret failed")
+		return err
+	}
+	log.Info("CreateOrUpdate secret succeeded", "OperationResult", opResult)
+
+	mysql.Spec.DeprecatedLocalPassword = ""
+	mysql.Spec.DeprecatedReplicaPassword = ""
+	mysql.Spec.DeprecatedExporterPassword = ""
+
+	return r.ResolveSecret(ctx, mysql)
+}
+
+// ResolveSecret resolves the credentials referenced by mysql without touching the secrets
+func (r *MysqlReconciler) ResolveSecret(ctx context.Context, mysql *databasev1.Mysql) (err error) {
+	mysql.Spec.GroupToken, err = r.GetSecretKey(ctx, mysql.Namespace, mysql.NewSecretKeySelector(databasev1.GroupTokenKey))
+	if err != nil {
+		return err
+	}
+
+	mysql.Spec.LocalPassword, err = r.GetSecretKey(ctx, mysql.Namespace, mysql.Spec.LocalPasswordSecretRef)
+	if err != nil {
+		return err
+	}
+	mysql.Spec.ReplicaPassword, err = r.GetSecretKey(ctx, mysql.Namespace, mysql.Spec.ReplicaPasswordSecretRef)
+	if err != nil {
+		return err
+	}
+	if mysql.Spec.EnableExporter {
+		mysql.Spec.ExporterPassword, err = r.GetSecretKey(ctx, mysql.Namespace, mysql.Spec.ExporterPasswordSecretRef)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *MysqlReconciler) GetSecretKey(ctx context.Context, namespace string, ref *corev1.SecretKeySelector) (string, error) {
+	return GetSecretKey(ctx, r.Client, namespace, ref)
+}
+
+// GetSecretKey reads the key of the secret in the namespace
+func GetSecretKey(ctx context.Context, c client.Reader, namespace string, ref *corev1.SecretKeySelector) (string, error) {
+	if ref == nil {
+		return "", fmt.Errorf("secret key selector required")
+	}
+
+	secret := &corev1.Secret{}
+	err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, secret)
+	if err != nil {
+		return "", err
+	}
+
+	b, ok := secret.Data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s", ref.Name, ref.Key)
+	}
+	return string(b), nil
+}
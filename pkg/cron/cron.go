@@ -0,0 +1,173 @@
+// Package cron parses the standard 5 field cron expressions,
+// minute hour day-of-month month day-of-week, with *, lists, ranges and steps,
+// the jan-dec and sun-sat names, and the @yearly, @monthly, @weekly, @daily and @hourly shorthands.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Schedule struct {
+	Minute, Hour, Dom, Month, Dow uint64
+
+	// A day matches both day fields if either one is *, any of them otherwise
+	DomStar, DowStar bool
+}
+
+type field struct {
+	name     string
+	min, max int
+	// The names of the values from min
+	names []string
+}
+
+var fields = [5]field{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{"day of week", 0, 7, []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// atoi parses the value or its case insensitive name
+func (f field) atoi(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	return strconv.Atoi(s)
+}
+
+var shorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if s, ok := shorthands[spec]; ok {
+		spec = s
+	}
+
+	a := strings.Fields(spec)
+	if len(a) != len(fields) {
+		return nil, fmt.Errorf("cron %q: expected %d fields, got %d", spec, len(fields), len(a))
+	}
+
+	var bits [5]uint64
+	for i, f := range fields {
+		b, err := parseField(a[i], f)
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %v", spec, err)
+		}
+		bits[i] = b
+	}
+
+	// sunday is either 0 or 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &Schedule{
+		Minute:  bits[0],
+		Hour:    bits[1],
+		Dom:     bits[2],
+		Month:   bits[3],
+		Dow:     bits[4],
+		DomStar: strings.HasPrefix(a[2], "*"),
+		DowStar: strings.HasPrefix(a[4], "*"),
+	}, nil
+}
+
+func parseField(s string, f field) (uint64, error) {
+	var bits uint64
+	for _, r := range strings.Split(s, ",") {
+		lo, hi, step := f.min, f.max, 1
+
+		if i := strings.IndexByte(r, '/'); i != -1 {
+			n, err := strconv.Atoi(r[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s step invalid: %s", f.name, r)
+			}
+			step = n
+			r = r[:i]
+		}
+
+		if r != "*" {
+			var err error
+			if i := strings.IndexByte(r, '-'); i != -1 {
+				lo, err = f.atoi(r[:i])
+				if err == nil {
+					hi, err = f.atoi(r[i+1:])
+				}
+			} else {
+				lo, err = f.atoi(r)
+				if err == nil && step == 1 {
+					hi = lo
+				}
+			}
+			if err != nil {
+				return 0, fmt.Errorf("%s invalid: %s", f.name, r)
+			}
+		}
+
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("%s out of range [%d, %d]: %s", f.name, f.min, f.max, s)
+		}
+
+		for i := lo; i <= hi; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func has(bits uint64, i int) bool {
+	return bits&(1<<uint(i)) != 0
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := has(s.Dom, t.Day())
+	dow := has(s.Dow, int(t.Weekday()))
+	if s.DomStar || s.DowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first matching minute after t, zero if none within 5 years
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+
+	for t.Before(end) {
+		if !has(s.Month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !has(s.Hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if !has(s.Minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,119 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseError(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"1-x * * * *",
+		"* * * foo *",
+		"* * * * mon-",
+		"@every",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	date := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	for _, c := range []struct {
+		spec, from, want string
+	}{
+		// every minute, strictly after
+		{"* * * * *", "2024-09-01 10:07", "2024-09-01 10:08"},
+		{"0 0 * * *", "2024-09-01 00:00", "2024-09-02 00:00"},
+
+		// lists, ranges and steps
+		{"*/15 * * * *", "2024-09-01 10:07", "2024-09-01 10:15"},
+		{"*/15 * * * *", "2024-09-01 10:45", "2024-09-01 11:00"},
+		{"5/20 * * * *", "2024-09-01 10:30", "2024-09-01 10:45"},
+		{"0 9-17/4 * * *", "2024-09-01 10:00", "2024-09-01 13:00"},
+		{"0 9-17/4 * * *", "2024-09-01 17:30", "2024-09-02 09:00"},
+		{"10,20 1,3 * * *", "2024-09-01 01:20", "2024-09-01 03:10"},
+
+		// names
+		{"0 0 1 jan,JUL *", "2024-02-01 00:00", "2024-07-01 00:00"},
+		{"0 12 * * mon-fri", "2024-09-06 12:00", "2024-09-09 12:00"},
+		{"0 0 * * Sun", "2024-09-02 00:00", "2024-09-08 00:00"},
+		{"0 0 * feb-mar/1 *", "2024-03-31 00:00", "2025-02-01 00:00"},
+
+		// sunday is 0 or 7
+		{"0 0 * * 7", "2024-09-02 00:00", "2024-09-08 00:00"},
+		{"0 0 * * 0", "2024-09-02 00:00", "2024-09-08 00:00"},
+
+		// both day fields restricted, either one matches
+		{"0 0 13 * fri", "2024-10-01 00:00", "2024-10-04 00:00"},
+		{"0 0 13 * fri", "2024-10-11 00:00", "2024-10-13 00:00"},
+		// one day field is *, both must match
+		{"0 0 * * 1", "2024-09-01 00:00", "2024-09-02 00:00"},
+		{"0 0 13 * *", "2024-10-04 00:00", "2024-10-13 00:00"},
+		{"0 0 */2 * mon", "2024-09-01 00:00", "2024-09-09 00:00"},
+
+		// month and year rollover
+		{"0 0 31 * *", "2024-01-31 00:00", "2024-03-31 00:00"},
+		{"0 0 31 * *", "2024-04-15 00:00", "2024-05-31 00:00"},
+		{"30 23 31 12 *", "2024-12-31 23:30", "2025-12-31 23:30"},
+		{"0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+
+		// shorthands
+		{"@hourly", "2024-09-01 10:00", "2024-09-01 11:00"},
+		{"@daily", "2024-09-01 10:00", "2024-09-02 00:00"},
+		{"@weekly", "2024-09-01 00:00", "2024-09-08 00:00"},
+		{"@monthly", "2024-12-15 00:00", "2025-01-01 00:00"},
+		{"@yearly", "2024-06-01 00:00", "2025-01-01 00:00"},
+	} {
+		s, err := Parse(c.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", c.spec, err)
+			continue
+		}
+		if got, want := s.Next(date(c.from)), date(c.want); !got.Equal(want) {
+			t.Errorf("%q Next(%s) = %s, want %s", c.spec, c.from, got.Format("2006-01-02 15:04"), c.want)
+		}
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	s, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("Next = %s, want zero", got)
+	}
+}
+
+func TestNextTruncates(t *testing.T) {
+	s, err := Parse("* * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2024, 9, 1, 10, 7, 59, 999, time.UTC)
+	want := time.Date(2024, 9, 1, 10, 8, 0, 0, time.UTC)
+	if got := s.Next(from); !got.Equal(want) {
+		t.Errorf("Next = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,340 @@
+// Package crypt seals the backup streams with AES-256-GCM in chunks, an archive of any size
+// streams through, and a truncated, reordered or altered stream fails to open.
+//
+// The secret, a passphrase or a random key, is stretched with scrypt,
+// each stream is sealed with its own key derived by HKDF from a random salt,
+// and the key id is an HMAC of a separate label so it tells nothing of the key.
+//
+// A sealed stream is the magic, the key id, the salt and a random nonce prefix,
+// then the chunks, each the plaintext length with the last chunk flagged and the ciphertext,
+// nothing follows the last chunk. A plain stream is refused once a key is set.
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	Magic = "MYLETENC"
+
+	idSize     = 8
+	saltSize   = 16
+	prefixSize = 7
+	headerSize = len(Magic) + idSize + saltSize + prefixSize
+
+	// ChunkSize is the plaintext of a chunk, the last one may be shorter
+	ChunkSize = 64 << 10
+
+	lastFlag = 1 << 31
+)
+
+var (
+	ErrNoKey     = errors.New("encrypted backup but no key")
+	ErrNotSealed = errors.New("backup not encrypted but a key is set")
+)
+
+var errClosed = errors.New("sealed stream closed")
+
+// scrypt parameters of the secret, the salt separates it from other uses of the same secret
+var (
+	scryptSalt         = []byte("mysql-operator/crypt/scrypt")
+	scryptN, scryptR   = 1 << 15, 8
+	scryptP, scryptLen = 1, 32
+)
+
+// Key encrypts and decrypts the streams, a nil key leaves them plain
+type Key struct {
+	// Hex of the first bytes of the HMAC of the key id label, tells the key without revealing it
+	ID     string
+	id     []byte
+	master []byte
+}
+
+// NewKey derives the master key from the secret, any length
+func NewKey(secret string) (*Key, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("encryption key required")
+	}
+	master, err := scrypt.Key([]byte(secret), scryptSalt, scryptN, scryptR, scryptP, scryptLen)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte("mysql-operator/crypt/key-id"))
+	h := mac.Sum(nil)
+	return &Key{
+		ID:     hex.EncodeToString(h[:idSize]),
+		id:     h[:idSize],
+		master: master,
+	}, nil
+}
+
+// streamAEAD derives the AES-256-GCM of a stream from its salt
+func (k *Key) streamAEAD(salt []byte) (cipher.AEAD, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, k.master, salt, []byte("mysql-operator/crypt/stream")), b); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(b)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SealedSize is the size of the plaintext once sealed
+func SealedSize(n int64) int64 {
+	chunks := (n + ChunkSize - 1) / ChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return int64(headerSize) + chunks*(4+16) + n
+}
+
+func nonce(prefix []byte, n uint32, last bool) []byte {
+	b := make([]byte, 12)
+	copy(b, prefix)
+	binary.BigEndian.PutUint32(b[prefixSize:], n)
+	if last {
+		b[11] = 1
+	}
+	return b
+}
+
+type writer struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	n      uint32
+	buf    []byte
+	err    error
+}
+
+// NewWriter seals what is written into w, the stream is complete once closed
+func (k *Key) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	random := make([]byte, saltSize+prefixSize)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	salt, prefix := random[:saltSize], random[saltSize:]
+	aead, err := k.streamAEAD(salt)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 0, headerSize)
+	header = append(header, Magic...)
+	header = append(header, k.id...)
+	header = append(header, random...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &writer{
+		w:      w,
+		aead:   aead,
+		prefix: prefix,
+		buf:    make([]byte, 0, ChunkSize),
+	}, nil
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	written := 0
+	for len(p) > 0 {
+		// a full chunk is held back as it may be the last
+		if len(w.buf) == ChunkSize {
+			if w.err = w.flush(false); w.err != nil {
+				return written, w.err
+			}
+		}
+		m := copy(w.buf[len(w.buf):ChunkSize], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+		written += m
+	}
+	return written, nil
+}
+
+func (w *writer) flush(last bool) error {
+	b := make([]byte, 4, 4+len(w.buf)+w.aead.Overhead())
+	l := uint32(len(w.buf))
+	if last {
+		l |= lastFlag
+	}
+	binary.BigEndian.PutUint32(b, l)
+	b = w.aead.Seal(b, nonce(w.prefix, w.n, last), w.buf, b[:4])
+	w.n++
+	w.buf = w.buf[:0]
+	_, err := w.w.Write(b)
+	return err
+}
+
+func (w *writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.flush(true); err != nil {
+		w.err = err
+		return err
+	}
+	w.err = errClosed
+	return nil
+}
+
+// SealReader returns the sealed stream of r, close it to stop early
+func (k *Key) SealReader(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		w, err := k.NewWriter(pw)
+		if err == nil {
+			_, err = io.Copy(w, r)
+			if e := w.Close(); err == nil {
+				err = e
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+type reader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	n      uint32
+	buf    []byte
+	last   bool
+}
+
+// Open returns the plaintext of r and the key id it is sealed with,
+// a plain stream is returned as is with an empty key id if there is no key,
+// refused otherwise as it is not authenticated
+func Open(r io.Reader, k *Key) (io.Reader, string, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(headerSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, "", err
+	}
+	if !bytes.HasPrefix(header, []byte(Magic)) {
+		if k != nil {
+			return nil, "", fmt.Errorf("%w, key id %s", ErrNotSealed, k.ID)
+		}
+		return br, "", nil
+	}
+	if len(header) < headerSize {
+		return nil, "", io.ErrUnexpectedEOF
+	}
+
+	id := hex.EncodeToString(header[len(Magic) : len(Magic)+idSize])
+	if k == nil {
+		return nil, id, fmt.Errorf("%w, key id %s", ErrNoKey, id)
+	}
+	if id != k.ID {
+		return nil, id, fmt.Errorf("encrypted with key id %s, not %s", id, k.ID)
+	}
+	salt := header[len(Magic)+idSize : len(Magic)+idSize+saltSize]
+	aead, err := k.streamAEAD(salt)
+	if err != nil {
+		return nil, id, err
+	}
+	prefix := append([]byte(nil), header[len(Magic)+idSize+saltSize:]...)
+	br.Discard(headerSize)
+
+	return &reader{
+		r:      br,
+		aead:   aead,
+		prefix: prefix,
+	}, id, nil
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.last {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *reader) next() error {
+	var l [4]byte
+	if _, err := io.ReadFull(r.r, l[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	n := binary.BigEndian.Uint32(l[:])
+	last := n&lastFlag != 0
+	n &^= lastFlag
+	if n > ChunkSize {
+		return fmt.Errorf("sealed chunk too large: %d", n)
+	}
+
+	b := make([]byte, int(n)+r.aead.Overhead())
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	b, err := r.aead.Open(b[:0], nonce(r.prefix, r.n, last), b, l[:])
+	if err != nil {
+		return fmt.Errorf("sealed chunk %d: %w", r.n, err)
+	}
+	if last {
+		var extra [1]byte
+		switch _, err = io.ReadFull(r.r, extra[:]); err {
+		case io.EOF:
+		case nil:
+			return fmt.Errorf("trailing data after the last sealed chunk %d", r.n)
+		default:
+			return err
+		}
+	}
+
+	r.n++
+	r.buf = b
+	r.last = last
+	return nil
+}
+
+// ReadKeyID returns the key id the file is sealed with, empty if plain
+func ReadKeyID(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, headerSize)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	if n < headerSize || !bytes.HasPrefix(header, []byte(Magic)) {
+		return "", nil
+	}
+	return hex.EncodeToString(header[len(Magic) : len(Magic)+idSize]), nil
+}
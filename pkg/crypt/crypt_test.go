@@ -0,0 +1,184 @@
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func newKey(t *testing.T, secret string) *Key {
+	k, err := NewKey(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func seal(t *testing.T, k *Key, plain []byte) []byte {
+	var b bytes.Buffer
+	w, err := k.NewWriter(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func open(sealed []byte, k *Key) ([]byte, error) {
+	r, _, err := Open(bytes.NewReader(sealed), k)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func random(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return b
+}
+
+func TestRoundTrip(t *testing.T) {
+	k := newKey(t, "secret")
+	for _, n := range []int{0, 1, ChunkSize - 1, ChunkSize, ChunkSize + 1, 3*ChunkSize + 5} {
+		plain := random(n)
+		sealed := seal(t, k, plain)
+		if int64(len(sealed)) != SealedSize(int64(n)) {
+			t.Errorf("%d bytes sealed to %d, SealedSize %d", n, len(sealed), SealedSize(int64(n)))
+		}
+		got, err := open(sealed, k)
+		if err != nil {
+			t.Errorf("%d bytes: %v", n, err)
+		} else if !bytes.Equal(got, plain) {
+			t.Errorf("%d bytes: plaintext differs", n)
+		}
+	}
+}
+
+func TestSealReader(t *testing.T) {
+	k := newKey(t, "secret")
+	plain := random(2*ChunkSize + 7)
+	sealed, err := io.ReadAll(k.SealReader(bytes.NewReader(plain)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := open(sealed, k)
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("open the sealed reader: %v", err)
+	}
+}
+
+func TestKeyID(t *testing.T) {
+	a, b := newKey(t, "secret"), newKey(t, "secret")
+	if a.ID != b.ID || len(a.ID) != 2*idSize {
+		t.Fatalf("key id %q and %q of the same secret", a.ID, b.ID)
+	}
+	if c := newKey(t, "other"); c.ID == a.ID {
+		t.Fatalf("key id %q of another secret", c.ID)
+	}
+	if _, err := NewKey(""); err == nil {
+		t.Fatal("empty secret accepted")
+	}
+
+	// each stream has its own salt
+	plain := random(100)
+	x, y := seal(t, a, plain), seal(t, a, plain)
+	if bytes.Equal(x[len(Magic)+idSize:], y[len(Magic)+idSize:]) {
+		t.Fatal("same salt and ciphertext twice")
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	k := newKey(t, "secret")
+	sealed := seal(t, k, random(2*ChunkSize+10))
+	for _, n := range []int{
+		0, len(Magic), headerSize - 1, headerSize, headerSize + 3,
+		headerSize + 4 + ChunkSize + 16, // after the first chunk
+		len(sealed) - 17,                // inside the tag of the last chunk
+		len(sealed) - 1,
+	} {
+		if _, err := open(sealed[:n], k); err == nil {
+			t.Errorf("truncated to %d of %d bytes opened", n, len(sealed))
+		}
+	}
+}
+
+func TestReordered(t *testing.T) {
+	k := newKey(t, "secret")
+	sealed := seal(t, k, random(3*ChunkSize))
+
+	// three full chunks of the same size, the last flagged
+	c := 4 + ChunkSize + 16
+	b := append([]byte(nil), sealed[:headerSize]...)
+	b = append(b, sealed[headerSize+c:headerSize+2*c]...)
+	b = append(b, sealed[headerSize:headerSize+c]...)
+	b = append(b, sealed[headerSize+2*c:]...)
+	if len(b) != len(sealed) {
+		t.Fatal("bad chunk layout")
+	}
+	if _, err := open(b, k); err == nil {
+		t.Fatal("reordered chunks opened")
+	}
+
+	// a chunk dropped
+	b = append(append([]byte(nil), sealed[:headerSize+c]...), sealed[headerSize+2*c:]...)
+	if _, err := open(b, k); err == nil {
+		t.Fatal("dropped chunk opened")
+	}
+}
+
+func TestTrailing(t *testing.T) {
+	k := newKey(t, "secret")
+	sealed := seal(t, k, random(ChunkSize+1))
+	if _, err := open(append(sealed, 0), k); err == nil {
+		t.Fatal("trailing byte opened")
+	}
+	if _, err := open(append(sealed, sealed[headerSize:]...), k); err == nil {
+		t.Fatal("chunks appended twice opened")
+	}
+}
+
+func TestTampered(t *testing.T) {
+	k := newKey(t, "secret")
+	sealed := seal(t, k, random(1000))
+	for _, i := range []int{len(Magic) + idSize, headerSize - 1, headerSize + 5, len(sealed) - 1} {
+		b := append([]byte(nil), sealed...)
+		b[i] ^= 1
+		if _, err := open(b, k); err == nil {
+			t.Errorf("byte %d flipped opened", i)
+		}
+	}
+}
+
+func TestWrongKey(t *testing.T) {
+	k := newKey(t, "secret")
+	sealed := seal(t, k, random(1000))
+
+	if _, err := open(sealed, newKey(t, "other")); err == nil {
+		t.Fatal("opened with another key")
+	}
+
+	// same key id but another master key
+	other := newKey(t, "other")
+	other.ID, other.id = k.ID, k.id
+	if _, err := open(sealed, other); err == nil {
+		t.Fatal("opened with another key of the same id")
+	}
+
+	if _, err := open(sealed, nil); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("opened without a key: %v", err)
+	}
+	if _, err := open([]byte("plain"), k); !errors.Is(err, ErrNotSealed) {
+		t.Fatalf("plain opened with a key: %v", err)
+	}
+	if got, err := open([]byte("plain"), nil); err != nil || string(got) != "plain" {
+		t.Fatalf("plain without a key: %q, %v", got, err)
+	}
+}
@@ -0,0 +1,124 @@
+package myctl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/cxr29/log"
+	v1 "github.com/erda-project/mysql-operator/api/v1"
+	"github.com/erda-project/mysql-operator/pkg/mylet"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Writer returns a copy of the mysql and its writer, which must be green
+func (ctl *Myctl) Writer(k types.NamespacedName) (*v1.Mysql, int, error) {
+	g := ctl.GetGroup(k)
+	if g == nil {
+		return nil, -1, ErrGroupNotFound
+	}
+
+	g.Lock()
+	m := g.Mysql.DeepCopy()
+	g.Unlock()
+
+	if m.Status.WriteId == nil {
+		return nil, -1, fmt.Errorf("mysql %s has no writer", k.Name)
+	}
+	id := *m.Status.WriteId
+	if m.Status.Solos[id].Status.Color != v1.Green {
+		return nil, -1, fmt.Errorf("writer %s is not green", m.SoloName(id))
+	}
+	return m, id, nil
+}
+
+// ApplyDatabase converges the database on the writer, returns the writer id
+func (ctl *Myctl) ApplyDatabase(ctx context.Context, k types.NamespacedName, r mylet.DatabaseRequest) (int, mylet.AccountResult, error) {
+	m, id, err := ctl.Writer(k)
+	if err != nil {
+		return -1, mylet.AccountResult{}, err
+	}
+
+	a, err := ApplyAccount(ctx, m, id, "/api/addons/mylet/apply/database", r)
+	if err == nil && len(a.Changes) > 0 {
+		log.Infoln(k.String(), "database", r.Name, m.SoloName(id), a.Changes)
+	}
+	return id, a, err
+}
+
+// ApplyUser converges the user on the writer, returns the writer id
+func (ctl *Myctl) ApplyUser(ctx context.Context, k types.NamespacedName, r mylet.UserRequest) (int, mylet.AccountResult, error) {
+	m, id, err := ctl.Writer(k)
+	if err != nil {
+		return -1, mylet.AccountResult{}, err
+	}
+
+	a, err := ApplyAccount(ctx, m, id, "/api/addons/mylet/apply/user", r)
+	if err == nil && len(a.Changes) > 0 {
+		log.Infoln(k.String(), "user", r.Username, m.SoloName(id), a.Changes)
+	}
+	return id, a, err
+}
+
+func ApplyAccount(ctx context.Context, mysql *v1.Mysql, id int, path string, r interface{}) (mylet.AccountResult, error) {
+	s := mysql.Status.Solos[id]
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return mylet.AccountResult{}, err
+	}
+
+	u := url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(s.Spec.Host, strconv.Itoa(s.Spec.MyletPort)),
+		Path:   path,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mylet.Timeout1m)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), bytes.NewReader(b))
+	if err != nil {
+		return mylet.AccountResult{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Token", mylet.SoloToken(mysql, mysql.BuildName("myctl")))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return mylet.AccountResult{}, err
+	}
+	defer res.Body.Close()
+
+	b, err = io.ReadAll(res.Body)
+	if err != nil {
+		return mylet.AccountResult{}, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return mylet.AccountResult{}, fmt.Errorf("status code %d, body: %s", res.StatusCode, string(b))
+	}
+
+	var v struct {
+		Data  mylet.AccountResult
+		Error interface{}
+	}
+
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		return mylet.AccountResult{}, err
+	}
+
+	if v.Error != nil {
+		return mylet.AccountResult{}, fmt.Errorf("return error: %s", v.Error)
+	}
+
+	return v.Data, nil
+}
@@ -0,0 +1,413 @@
+package myctl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cxr29/log"
+	v1 "github.com/erda-project/mysql-operator/api/v1"
+	"github.com/erda-project/mysql-operator/pkg/mylet"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// FinalBackup takes a full backup in background before teardown,
+// returns whether it is done, a failed backup is retried on the next call.
+func (ctl *Myctl) FinalBackup(mysql *v1.Mysql) (bool, error) {
+	g, err := ctl.GetOrNewGroup(mysql)
+	if err != nil {
+		return false, err
+	}
+
+	g.Lock()
+	defer g.Unlock()
+
+	if g.FinalBackupResult != nil {
+		return true, nil
+	}
+	if g.FinalBackupRunning {
+		return false, nil
+	}
+	if err = g.FinalBackupError; err != nil {
+		g.FinalBackupError = nil
+		return false, err
+	}
+
+	id, err := g.BackupSource(v1.BackupSourceReplica, nil)
+	if err != nil {
+		return false, err
+	}
+
+	g.FinalBackupRunning = true
+	go func(mysql *v1.Mysql) {
+		ctx, cancel := context.WithTimeout(context.Background(), mylet.Hour8)
+		defer cancel()
+
+		log.Infoln(mysql.Name, "final backup", id)
+		r, err := Backup(ctx, mysql, id, false, false, false)
+		log.ErrError(err, mysql.Name, "final backup", id)
+
+		g.Lock()
+		defer g.Unlock()
+
+		g.FinalBackupRunning = false
+		if err == nil {
+			g.FinalBackupResult = &r
+		} else {
+			g.FinalBackupError = err
+		}
+	}(g.Mysql.DeepCopy())
+
+	return false, nil
+}
+
+// BackupSource picks the solo to back up, a replica falls back to the primary
+func (g *MysqlGroup) BackupSource(source string, sourceId *int) (int, error) {
+	writeId := *g.Status.WriteId
+	switch source {
+	case v1.BackupSourceReplica, "":
+		id := *g.Status.ReadId
+		if g.Status.Solos[id].Status.Color != v1.Green {
+			id = writeId
+		}
+		return id, nil
+	case v1.BackupSourcePrimary:
+		return writeId, nil
+	case v1.BackupSourceSolo:
+		if sourceId == nil || !v1.Between(*sourceId, 0, g.Spec.Size()-1) {
+			return 0, fmt.Errorf("source id out of range")
+		}
+		if c := g.Status.Solos[*sourceId].Status.Color; c != v1.Green {
+			return 0, fmt.Errorf("%s is %s", g.SoloName(*sourceId), c)
+		}
+		return *sourceId, nil
+	default:
+		return 0, fmt.Errorf("backup source invalid: %s", source)
+	}
+}
+
+type BackupJob struct {
+	Id        int
+	StartTime time.Time
+	Running   bool
+	Result    *mylet.BackupResult
+	Error     error
+}
+
+var ErrGroupNotFound = errors.New("mysql group not found")
+
+// StartBackup runs the on-demand backup in background once,
+// returns a copy of the job
+func (ctl *Myctl) StartBackup(backup *v1.MysqlBackup) (BackupJob, error) {
+	g := ctl.GetGroup(backup.MysqlNamespacedName())
+	if g == nil {
+		return BackupJob{}, ErrGroupNotFound
+	}
+
+	k := backup.NamespacedName()
+
+	ctl.Lock()
+	job, ok := ctl.Backups[k]
+	if ok {
+		defer ctl.Unlock()
+		return *job, nil
+	}
+	ctl.Unlock()
+
+	g.Lock()
+	id, err := g.BackupSource(backup.Spec.Source, backup.Spec.SourceId)
+	m := g.Mysql.DeepCopy()
+	g.Unlock()
+	if err != nil {
+		return BackupJob{}, err
+	}
+
+	ctl.Lock()
+	defer ctl.Unlock()
+	if job, ok = ctl.Backups[k]; ok {
+		return *job, nil
+	}
+	job = &BackupJob{
+		Id:        id,
+		StartTime: time.Now(),
+		Running:   true,
+	}
+	ctl.Backups[k] = job
+
+	incremental := backup.Spec.Type == v1.BackupIncremental
+	compress := backup.Spec.Compress
+	verify := backup.Spec.Verify
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mylet.Hour8)
+		defer cancel()
+
+		log.Infoln(k.String(), "backup", m.SoloName(id), "incremental", incremental, "verify", verify)
+		r, err := Backup(ctx, m, id, incremental, compress, verify)
+		log.ErrError(err, k.String(), "backup", m.SoloName(id))
+
+		ctl.Lock()
+		defer ctl.Unlock()
+
+		job.Running = false
+		if err == nil {
+			job.Result = &r
+		} else {
+			job.Error = err
+		}
+	}()
+
+	return *job, nil
+}
+
+// GetBackup returns a copy of the job if any
+func (ctl *Myctl) GetBackup(k types.NamespacedName) (BackupJob, bool) {
+	ctl.Lock()
+	defer ctl.Unlock()
+
+	job, ok := ctl.Backups[k]
+	if !ok {
+		return BackupJob{}, false
+	}
+	return *job, true
+}
+
+// ForgetBackup drops the finished job once its result is recorded
+func (ctl *Myctl) ForgetBackup(k types.NamespacedName) {
+	ctl.Lock()
+	defer ctl.Unlock()
+
+	if job, ok := ctl.Backups[k]; ok && !job.Running {
+		delete(ctl.Backups, k)
+	}
+}
+
+// SetBackupCondition records the last finished backup on the mysql,
+// the status of the mysql is served from the group so it is set there
+func (ctl *Myctl) SetBackupCondition(k types.NamespacedName, failed bool, reason, message string) error {
+	g := ctl.GetGroup(k)
+	if g == nil {
+		return ErrGroupNotFound
+	}
+
+	status := metav1.ConditionFalse
+	if failed {
+		status = metav1.ConditionTrue
+	}
+
+	g.Lock()
+	change := g.SetCondition(v1.ConditionBackupFailed, status, reason, message)
+	m := g.Mysql
+	g.Unlock()
+
+	if change {
+		g.C <- event.GenericEvent{Object: m}
+	}
+	return nil
+}
+
+func Backup(ctx context.Context, mysql *v1.Mysql, id int, incremental, compress, verify bool) (mylet.BackupResult, error) {
+	s := mysql.Status.Solos[id]
+
+	u := url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(s.Spec.Host, strconv.Itoa(s.Spec.MyletPort)),
+		Path:   "/api/addons/mylet/backup",
+	}
+	q := make(url.Values, 3)
+	q.Set("incremental", strconv.FormatBool(incremental))
+	q.Set("compress", strconv.FormatBool(compress))
+	q.Set("verify", strconv.FormatBool(verify))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), nil)
+	if err != nil {
+		return mylet.BackupResult{}, err
+	}
+
+	req.Header.Set("Token", mylet.SoloToken(mysql, mysql.BuildName("myctl")))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return mylet.BackupResult{}, err
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return mylet.BackupResult{}, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return mylet.BackupResult{}, fmt.Errorf("status code %d, body: %s", res.StatusCode, string(b))
+	}
+
+	var v struct {
+		Data  mylet.BackupResult
+		Error interface{}
+	}
+
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		return mylet.BackupResult{}, err
+	}
+
+	if v.Error != nil {
+		return mylet.BackupResult{}, fmt.Errorf("return error: %s", v.Error)
+	}
+
+	return v.Data, nil
+}
+
+// PruneChains removes the given chains of each solo by their backup time
+func (ctl *Myctl) PruneChains(ctx context.Context, k types.NamespacedName, chains map[int][]string) (map[int]mylet.PruneResult, error) {
+	g := ctl.GetGroup(k)
+	if g == nil {
+		return nil, ErrGroupNotFound
+	}
+
+	g.Lock()
+	m := g.Mysql.DeepCopy()
+	g.Unlock()
+
+	removed := make(map[int]mylet.PruneResult)
+	var errs []string
+	for id, a := range chains {
+		if !v1.Between(id, 0, len(m.Status.Solos)-1) || len(a) == 0 {
+			continue
+		}
+		r, err := PruneBackup(ctx, m, id, mylet.Retention{Chains: a})
+		if err != nil {
+			log.Errorln(k.String(), "prune chains", m.SoloName(id), err)
+			errs = append(errs, m.SoloName(id)+": "+err.Error())
+			continue
+		}
+		if len(r.Removed) > 0 || len(r.Binlogs) > 0 {
+			log.Infoln(k.String(), "pruned chains", m.SoloName(id), r.Removed, "reclaimed", r.Reclaimed)
+			removed[id] = r
+		}
+	}
+
+	if len(errs) > 0 {
+		return removed, errors.New(strings.Join(errs, "; "))
+	}
+	return removed, nil
+}
+
+func PruneBackup(ctx context.Context, mysql *v1.Mysql, id int, r mylet.Retention) (mylet.PruneResult, error) {
+	s := mysql.Status.Solos[id]
+
+	u := url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(s.Spec.Host, strconv.Itoa(s.Spec.MyletPort)),
+		Path:   "/api/addons/mylet/prune/backups",
+	}
+	q := make(url.Values, 3)
+	q.Set("keep", strconv.Itoa(r.Keep))
+	q.Set("maxAge", strconv.FormatInt(int64(r.MaxAge/time.Second), 10))
+	q.Set("maxBytes", strconv.FormatInt(r.MaxBytes, 10))
+	q["chain"] = r.Chains
+	u.RawQuery = q.Encode()
+
+	ctx, cancel := context.WithTimeout(ctx, mylet.Timeout1m)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), nil)
+	if err != nil {
+		return mylet.PruneResult{}, err
+	}
+
+	req.Header.Set("Token", mylet.SoloToken(mysql, mysql.BuildName("myctl")))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return mylet.PruneResult{}, err
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return mylet.PruneResult{}, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return mylet.PruneResult{}, fmt.Errorf("status code %d, body: %s", res.StatusCode, string(b))
+	}
+
+	var v struct {
+		Data  mylet.PruneResult
+		Error interface{}
+	}
+
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		return mylet.PruneResult{}, err
+	}
+
+	if v.Error != nil {
+		return mylet.PruneResult{}, fmt.Errorf("return error: %s", v.Error)
+	}
+
+	return v.Data, nil
+}
+
+// ListBackups returns the chains of the solo, local or in the backup storage, oldest first
+func ListBackups(ctx context.Context, mysql *v1.Mysql, id int) ([]mylet.BackupInfo, error) {
+	s := mysql.Status.Solos[id]
+
+	u := url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(s.Spec.Host, strconv.Itoa(s.Spec.MyletPort)),
+		Path:   "/api/addons/mylet/backups",
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mylet.Timeout1m)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Token", mylet.SoloToken(mysql, mysql.BuildName("myctl")))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code %d, body: %s", res.StatusCode, string(b))
+	}
+
+	var v struct {
+		Data  []mylet.BackupInfo
+		Error interface{}
+	}
+
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.Error != nil {
+		return nil, fmt.Errorf("return error: %s", v.Error)
+	}
+
+	return v.Data, nil
+}
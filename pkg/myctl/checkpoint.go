@@ -0,0 +1,196 @@
+package myctl
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/cxr29/log"
+	v1 "github.com/erda-project/mysql-operator/api/v1"
+	"github.com/erda-project/mysql-operator/pkg/mylet"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	CheckpointSuffix   = "myctl"
+	CheckpointKey      = "checkpoint"
+	CheckpointInterval = 30 * time.Second
+)
+
+// Checkpoint is the in-memory group state that must survive an operator restart
+type Checkpoint struct {
+	PrimaryId   int
+	WriteId     int
+	ReadId      int
+	SwitchTime  time.Time
+	SwitchCount int
+	Color       string
+	Colors      []string
+	States      []*mylet.MysqlState
+	SaveTime    time.Time
+	// The primary id of the mysql spec when saved, nil in older checkpoints
+	SpecPrimaryId *int
+}
+
+func (g *MysqlGroup) NewCheckpoint(now time.Time) *Checkpoint {
+	c := &Checkpoint{
+		PrimaryId:   *g.Spec.PrimaryId,
+		WriteId:     *g.Status.WriteId,
+		ReadId:      *g.Status.ReadId,
+		SwitchTime:  g.SwitchTime,
+		SwitchCount: g.SwitchCount,
+		Color:       g.Status.Color,
+		Colors:      make([]string, len(g.Status.Solos)),
+		States:      make([]*mylet.MysqlState, 0, len(g.States)),
+		SaveTime:    now,
+
+		SpecPrimaryId: pointer.IntPtr(g.SpecPrimaryId),
+	}
+	for i, s := range g.Status.Solos {
+		c.Colors[i] = s.Status.Color
+	}
+	for _, s := range g.States {
+		// saved outside the lock
+		v := *s
+		c.States = append(c.States, &v)
+	}
+	return c
+}
+
+// Restore applies a checkpoint to a new group, out of range ids are ignored.
+// The checkpointed primary id is applied only if the spec lags behind it,
+// a primary id the user set since the checkpoint is kept and switched to by the check.
+func (g *MysqlGroup) Restore(c *Checkpoint) {
+	n := g.Spec.Size()
+
+	if v1.Between(c.WriteId, 0, n-1) {
+		g.Status.WriteId = pointer.IntPtr(c.WriteId)
+		changed := c.SpecPrimaryId != nil && *c.SpecPrimaryId != *g.Spec.PrimaryId
+		if changed {
+			log.Infoln(g.Name, "primary id set to", *g.Spec.PrimaryId, "since the checkpoint")
+		} else if v1.Between(c.PrimaryId, 0, n-1) {
+			g.Spec.PrimaryId = pointer.IntPtr(c.PrimaryId)
+		}
+	}
+	if v1.Between(c.ReadId, 0, n-1) {
+		g.Status.ReadId = pointer.IntPtr(c.ReadId)
+	}
+
+	g.SwitchTime = c.SwitchTime
+	g.SwitchCount = c.SwitchCount
+
+	if len(c.Colors) == n {
+		g.Status.Color = c.Color
+		for i := range g.Status.Solos {
+			g.Status.Solos[i].Status.Color = c.Colors[i]
+		}
+	}
+
+	for _, s := range c.States {
+		if v1.Between(s.FromId, -1, n-1) && v1.Between(s.ToId, 0, n-1) {
+			g.States[s.StateKey] = s
+		}
+	}
+
+	g.CheckpointTime = c.SaveTime
+}
+
+func (ctl *Myctl) LoadCheckpoint(ctx context.Context, mysql *v1.Mysql) (*Checkpoint, error) {
+	if ctl.APIReader == nil {
+		return nil, nil
+	}
+
+	cm := &corev1.ConfigMap{}
+	err := ctl.APIReader.Get(ctx, client.ObjectKey{
+		Namespace: mysql.Namespace,
+		Name:      mysql.BuildName(CheckpointSuffix),
+	}, cm)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s, ok := cm.Data[CheckpointKey]
+	if !ok {
+		return nil, nil
+	}
+
+	c := new(Checkpoint)
+	if err = json.Unmarshal([]byte(s), c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (ctl *Myctl) SaveCheckpoint(ctx context.Context, mysql *v1.Mysql, c *Checkpoint) error {
+	if ctl.Client == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      mysql.BuildName(CheckpointSuffix),
+			Namespace: mysql.Namespace,
+		},
+	}
+	_, err = controllerutil.CreateOrUpdate(ctx, ctl.Client, cm, func() error {
+		cm.Labels = mysql.NewLabels()
+		cm.Data = map[string]string{
+			CheckpointKey: string(b),
+		}
+		return controllerutil.SetControllerReference(mysql, cm, ctl.Client.Scheme())
+	})
+	return err
+}
+
+// Checkpoint queues the group state to be saved, must be called with the lock held,
+// it is written outside the lock so a slow api server does not stall the group
+func (g *MysqlGroup) Checkpoint(now time.Time) {
+	g.PendingCheckpoint = g.NewCheckpoint(now)
+	if g.CheckpointSaving {
+		return
+	}
+	g.CheckpointSaving = true
+	go g.SaveCheckpoints(g.Mysql.DeepCopy())
+}
+
+// SaveCheckpoints saves the pending checkpoints until none is left, the newest replaces the unsaved ones
+func (g *MysqlGroup) SaveCheckpoints(mysql *v1.Mysql) {
+	for {
+		g.Lock()
+		c := g.PendingCheckpoint
+		g.PendingCheckpoint = nil
+		if c == nil {
+			g.CheckpointSaving = false
+			g.Unlock()
+			return
+		}
+		g.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout5s)
+		err := g.SaveCheckpoint(ctx, mysql, c)
+		cancel()
+		if err != nil {
+			log.Errorln(g.Name, "save checkpoint", err)
+			continue
+		}
+
+		g.Lock()
+		if c.SaveTime.After(g.CheckpointTime) {
+			g.CheckpointTime = c.SaveTime
+		}
+		g.Unlock()
+	}
+}
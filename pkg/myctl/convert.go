@@ -0,0 +1,292 @@
+package myctl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/cxr29/log"
+	v1 "github.com/erda-project/mysql-operator/api/v1"
+	"github.com/erda-project/mysql-operator/pkg/mylet"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+// Ask the solo again if it is not converted in time, the actions are idempotent
+const ConvertRetry = 2 * time.Minute
+
+type ConversionStep struct {
+	Id    int
+	Phase string
+	mylet.ConvertRequest
+}
+
+// ConversionPlan orders the steps, from Classic the primary bootstraps the group
+// and the other members join it, to Classic the other members leave the group first
+// and the group primary is promoted last, the replicas are repointed at the end.
+// In the same group mode the new members join or the old ones leave, the last first
+func ConversionPlan(from, to v1.MysqlTopology) []ConversionStep {
+	n := from.Primaries + from.Replicas
+	var a []ConversionStep
+	add := func(id int, phase, action string, bootstrap bool) {
+		a = append(a, ConversionStep{
+			Id:    id,
+			Phase: phase,
+			ConvertRequest: mylet.ConvertRequest{
+				Action:    action,
+				Bootstrap: bootstrap,
+			},
+		})
+	}
+
+	if from.PrimaryMode == to.PrimaryMode {
+		for i := from.Primaries; i < to.Primaries; i++ {
+			add(i, v1.ConversionJoining, mylet.ConvertMember, false)
+		}
+		for i := from.Primaries - 1; i >= to.Primaries; i-- {
+			add(i, v1.ConversionDetaching, mylet.ConvertAsync, false)
+		}
+		r := from.Primaries
+		if r < to.Primaries {
+			r = to.Primaries
+		}
+		for i := r; i < n; i++ {
+			add(i, v1.ConversionRepointing, mylet.ConvertAsync, false)
+		}
+	} else if to.PrimaryMode != v1.ModeClassic {
+		p := from.PrimaryId
+		add(p, v1.ConversionPreparing, mylet.ConvertCheck, false)
+		add(p, v1.ConversionBootstrapping, mylet.ConvertMember, true)
+		for i := 0; i < to.Primaries; i++ {
+			if i != p {
+				add(i, v1.ConversionJoining, mylet.ConvertMember, false)
+			}
+		}
+		for i := to.Primaries; i < n; i++ {
+			add(i, v1.ConversionRepointing, mylet.ConvertAsync, false)
+		}
+	} else {
+		q := to.PrimaryId
+		for i := 0; i < from.Primaries; i++ {
+			if i != q {
+				add(i, v1.ConversionDetaching, mylet.ConvertAsync, false)
+			}
+		}
+		add(q, v1.ConversionPromoting, mylet.ConvertAsync, false)
+		for i := from.Primaries; i < n; i++ {
+			add(i, v1.ConversionRepointing, mylet.ConvertAsync, false)
+		}
+	}
+	return a
+}
+
+// StartConversion records a new conversion, a conversion in progress
+// is replaced and its converted solos are converted back
+func (g *MysqlGroup) StartConversion(from, to v1.MysqlTopology) {
+	if c := g.Status.Conversion; c != nil {
+		log.Infoln(g.Name, "roll back conversion", c.From.PrimaryMode, "to", c.To.PrimaryMode, "converted", c.ConvertedIds)
+	}
+	log.Infoln(g.Name, "convert", from.PrimaryMode, from.Primaries, "to", to.PrimaryMode, to.Primaries)
+
+	g.Status.Conversion = &v1.MysqlConversionStatus{
+		From:      from,
+		To:        to,
+		Phase:     v1.ConversionPreparing,
+		Total:     len(ConversionPlan(from, to)),
+		StartTime: &metav1.Time{Time: time.Now()},
+	}
+}
+
+// Bootstrapped reports whether the group may be bootstrapped by GroupAction,
+// not before the conversion bootstraps it on the old primary
+func (g *MysqlGroup) Bootstrapped() bool {
+	c := g.Status.Conversion
+	if c == nil || c.To.PrimaryMode == v1.ModeClassic || c.From.PrimaryMode != v1.ModeClassic {
+		return true
+	}
+	for _, id := range c.ConvertedIds {
+		if id == c.From.PrimaryId {
+			return true
+		}
+	}
+	return false
+}
+
+// IsConverted reports whether the solo reported the target spec and got there
+func (g *MysqlGroup) IsConverted(s ConversionStep, now time.Time) bool {
+	if ss, ok := g.SoloSizeSpecs[s.Id]; !ok || ss != mylet.NewSizeSpec(g.Mysql) {
+		return false
+	}
+
+	switch s.Action {
+	case mylet.ConvertMember:
+		r := g.FreshMember(s.Id, now)
+		return r != nil && r.State == mylet.MemberOnline
+	case mylet.ConvertAsync:
+		status := g.Status.Solos[s.Id].Status
+		return status.Color == v1.Green && status.Lag != nil && *status.Lag >= 0
+	}
+	return false
+}
+
+// NextConversion advances the conversion, returns the step to request if any
+func (g *MysqlGroup) NextConversion(now time.Time) (*ConversionStep, bool) {
+	c := g.Status.Conversion
+	if c == nil {
+		return nil, true
+	}
+
+	plan := ConversionPlan(c.From, c.To)
+	for c.Step < len(plan) {
+		s := plan[c.Step]
+		if s.Action == mylet.ConvertCheck || !g.IsConverted(s, now) {
+			break
+		}
+		log.Infoln(g.Name, "converted", g.SoloName(s.Id), s.Phase)
+		c.ConvertedIds = append(c.ConvertedIds, s.Id)
+		c.Step++
+		c.CurrentId = nil
+		c.RequestTime = nil
+		c.Message = ""
+	}
+
+	if c.Step >= len(plan) {
+		log.Infoln(g.Name, "conversion completed", c.From.PrimaryMode, "to", c.To.PrimaryMode)
+		g.Status.Conversion = nil
+		return nil, true
+	}
+
+	s := plan[c.Step]
+	if c.Phase != v1.ConversionFailed {
+		c.Phase = s.Phase
+	}
+	if e := g.ConvertErrors[s.Id]; e != "" && c.CurrentId != nil && *c.CurrentId == s.Id {
+		c.Phase = v1.ConversionFailed
+		c.Message = g.SoloName(s.Id) + " " + e
+	}
+
+	if c.CurrentId != nil && *c.CurrentId == s.Id && c.RequestTime != nil && now.Sub(c.RequestTime.Time) < ConvertRetry {
+		// waiting for the solo
+		return nil, false
+	}
+
+	c.CurrentId = pointer.IntPtr(s.Id)
+	c.RequestTime = &metav1.Time{Time: now}
+	return &s, false
+}
+
+// Convert requests the next conversion step, returns whether no conversion is in progress
+func (ctl *Myctl) Convert(ctx context.Context, mysql *v1.Mysql) (bool, error) {
+	if ctl.Client == nil {
+		return true, nil
+	}
+
+	g, err := ctl.GetOrNewGroup(mysql)
+	if err != nil {
+		return false, err
+	}
+
+	g.Lock()
+	s, done := g.NextConversion(time.Now())
+	c := g.Status.Conversion
+	var m *v1.Mysql
+	if s != nil {
+		m = g.Mysql.DeepCopy()
+		delete(g.ConvertErrors, s.Id)
+	}
+	g.Unlock()
+
+	if s == nil {
+		return done, nil
+	}
+
+	log.Infoln(mysql.Name, "convert", m.SoloName(s.Id), s.Phase, s.Action)
+	err = ConvertSolo(ctx, m, s.Id, s.ConvertRequest)
+
+	g.Lock()
+	defer g.Unlock()
+
+	if g.Status.Conversion != c {
+		// rolled back meanwhile
+		return false, nil
+	}
+	if err != nil {
+		log.Errorln(mysql.Name, "convert", m.SoloName(s.Id), err)
+		c.Phase = v1.ConversionFailed
+		c.Message = m.SoloName(s.Id) + " " + s.Action + ": " + err.Error()
+		return false, nil
+	}
+	c.Phase = s.Phase
+	c.Message = s.Action + " " + m.SoloName(s.Id)
+	if s.Action == mylet.ConvertCheck {
+		// the check is answered synchronously
+		c.Step++
+		c.CurrentId = nil
+		c.RequestTime = nil
+	}
+	return false, nil
+}
+
+func ConvertSolo(ctx context.Context, mysql *v1.Mysql, id int, r mylet.ConvertRequest) error {
+	s := mysql.Status.Solos[id]
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	u := url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(s.Spec.Host, strconv.Itoa(s.Spec.MyletPort)),
+		Path:   "/api/addons/mylet/convert",
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mylet.Timeout1m)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Token", mylet.SoloToken(mysql, mysql.BuildName("myctl")))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	b, err = io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code %d, body: %s", res.StatusCode, string(b))
+	}
+
+	var v struct {
+		Data  json.RawMessage
+		Error interface{}
+	}
+
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+
+	if v.Error != nil {
+		return fmt.Errorf("return error: %s", v.Error)
+	}
+
+	return nil
+}
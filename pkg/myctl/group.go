@@ -18,6 +18,33 @@ type MysqlGroup struct {
 	SwitchTime  time.Time
 	Running     bool
 	ExitChan    chan struct{}
+
+	CheckpointTime time.Time
+	StartTime      time.Time
+	UpgradeTime    time.Time
+
+	// The primary id of the mysql spec last seen, a different one is set by the user
+	SpecPrimaryId int
+
+	// The newest checkpoint not saved yet, and whether it is being saved
+	PendingCheckpoint *Checkpoint
+	CheckpointSaving  bool
+
+	// Group replication members, bootstrap decision
+	Members       map[int]*GroupMemberReport
+	BootstrapId   *int
+	BootstrapTime time.Time
+	OutageTime    time.Time
+
+	// The last size spec and conversion error reported by each solo
+	SoloSizeSpecs map[int]mylet.SizeSpec
+	ConvertErrors map[int]string
+	// The last restore report of each solo
+	Restores map[int]mylet.RestoreReport
+
+	FinalBackupRunning bool
+	FinalBackupResult  *mylet.BackupResult
+	FinalBackupError   error
 }
 
 func (g *MysqlGroup) Start() {
@@ -100,7 +127,13 @@ func (g *MysqlGroup) Start() {
 }
 
 func (g *MysqlGroup) Diff(mysql *v1.Mysql) error {
+	// in case the webhook is not deployed
+	if err := mysql.ValidateChange(g.Mysql); err != nil {
+		return err
+	}
+
 	changed := 0
+	g.SpecPrimaryId = *mysql.Spec.PrimaryId
 
 	// Reload changes
 	if g.Spec.PrimaryMode != mysql.Spec.PrimaryMode ||
@@ -110,6 +143,10 @@ func (g *MysqlGroup) Diff(mysql *v1.Mysql) error {
 		*g.Spec.AutoSwitch != *mysql.Spec.AutoSwitch {
 		changed++
 
+		if g.Spec.PrimaryMode != mysql.Spec.PrimaryMode || g.Spec.Primaries != mysql.Spec.Primaries {
+			g.StartConversion(g.Spec.Topology(), mysql.Spec.Topology())
+		}
+
 		g.Spec.PrimaryMode = mysql.Spec.PrimaryMode
 		g.Spec.Primaries = mysql.Spec.Primaries
 		g.Spec.PrimaryId = pointer.Int(*mysql.Spec.PrimaryId)
@@ -119,7 +156,8 @@ func (g *MysqlGroup) Diff(mysql *v1.Mysql) error {
 		primaryId := *g.Spec.PrimaryId
 		red, yellow, green := g.Color(primaryId)
 		writeId := *g.Status.WriteId
-		if primaryId != writeId {
+		// the group primary is followed by SyncGroupPrimary
+		if g.Spec.PrimaryMode == v1.ModeClassic && primaryId != writeId {
 			if red+yellow > green {
 				log.Infoln("can not change primary", writeId, "to", primaryId)
 				g.Spec.PrimaryId = pointer.Int(writeId)
@@ -154,8 +192,39 @@ func (g *MysqlGroup) Diff(mysql *v1.Mysql) error {
 		g.Spec.ExporterPassword = mysql.Spec.ExporterPassword
 	}
 
-	// 同步 image 字段，确保 CRD 变更能生效
-	g.Spec.Image = mysql.Spec.Image
+	// Secret changes
+	if g.Spec.LocalPassword != mysql.Spec.LocalPassword ||
+		g.Spec.ReplicaPassword != mysql.Spec.ReplicaPassword ||
+		g.Spec.GroupToken != mysql.Spec.GroupToken {
+		changed++
+
+		g.Spec.LocalPassword = mysql.Spec.LocalPassword
+		g.Spec.ReplicaPassword = mysql.Spec.ReplicaPassword
+		g.Spec.GroupToken = mysql.Spec.GroupToken
+	}
+
+	// Storage changes, claims are expanded by ExpandStorage
+	if g.Spec.StorageSize.Cmp(mysql.Spec.StorageSize) != 0 {
+		changed++
+
+		g.Spec.StorageSize = mysql.Spec.StorageSize.DeepCopy()
+	}
+
+	// Config changes, applied by mylet or restarted by Upgrade
+	if v1.HashConfig(g.Spec.MysqlConfig) != v1.HashConfig(mysql.Spec.MysqlConfig) {
+		changed++
+
+		g.Spec.MysqlConfig = mysql.Spec.DeepCopy().MysqlConfig
+	}
+
+	// Upgrade changes, pods are restarted by Upgrade
+	if g.Spec.Version != mysql.Spec.Version ||
+		g.Spec.Image != mysql.Spec.Image {
+		changed++
+
+		g.Spec.Version = mysql.Spec.Version
+		g.Spec.Image = mysql.Spec.Image
+	}
 
 	//TODO other changes
 
@@ -167,6 +236,16 @@ func (g *MysqlGroup) Diff(mysql *v1.Mysql) error {
 	g.Spec.Resources = spec.Resources
 	g.Spec.EnvFrom = spec.EnvFrom
 	g.Spec.Env = spec.Env
+	g.Spec.LocalPasswordSecretRef = spec.LocalPasswordSecretRef
+	g.Spec.ReplicaPasswordSecretRef = spec.ReplicaPasswordSecretRef
+	g.Spec.ExporterPasswordSecretRef = spec.ExporterPasswordSecretRef
+	g.Spec.DeletionPolicy = spec.DeletionPolicy
+	g.Spec.FinalBackup = spec.FinalBackup
+	g.Spec.VolumeSnapshotClassName = spec.VolumeSnapshotClassName
+	g.Spec.BackupStorage = spec.BackupStorage
+	g.Spec.BackupEncryption = spec.BackupEncryption
+	g.Spec.BackupRetention = spec.BackupRetention
+	g.Spec.SeedStrategy = spec.SeedStrategy
 
 	if changed > 0 {
 		if err := g.Validate(); err != nil {
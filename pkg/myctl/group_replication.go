@@ -0,0 +1,259 @@
+package myctl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cxr29/log"
+	v1 "github.com/erda-project/mysql-operator/api/v1"
+	"github.com/erda-project/mysql-operator/pkg/mylet"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+const (
+	// A member report older than this is ignored
+	GroupReportTimeout = 25 * time.Second
+	// Decide again if the chosen member is not online in time
+	GroupBootstrapTimeout = time.Minute
+	// Bootstrap with a majority if some members never report
+	GroupQuorumTimeout = 5 * time.Minute
+	// A member with a longer certification queue is yellow
+	GroupMaxQueue = 1000
+)
+
+type GroupMemberReport struct {
+	mylet.GroupMember
+	ReportTime time.Time
+}
+
+// IsMember reports whether the solo is a group replication member
+func (g *MysqlGroup) IsMember(id int) bool {
+	return g.Spec.PrimaryMode != v1.ModeClassic && v1.Between(id, 0, g.Spec.Primaries-1)
+}
+
+func (g *MysqlGroup) RecordMember(id int, m *mylet.GroupMember, now time.Time) {
+	if g.Members == nil {
+		g.Members = make(map[int]*GroupMemberReport, g.Spec.Primaries)
+	}
+	g.Members[id] = &GroupMemberReport{
+		GroupMember: *m,
+		ReportTime:  now,
+	}
+}
+
+// FreshMember returns the member report if it is recent enough
+func (g *MysqlGroup) FreshMember(id int, now time.Time) *GroupMemberReport {
+	r, ok := g.Members[id]
+	if !ok || !g.IsMember(id) || now.Sub(r.ReportTime) >= GroupReportTimeout {
+		return nil
+	}
+	return r
+}
+
+// MemberColor folds the member state into the solo color,
+// empty if the solo is not a member or the report is stale
+func (g *MysqlGroup) MemberColor(id int, now time.Time) string {
+	r := g.FreshMember(id, now)
+	if r == nil {
+		return ""
+	}
+	switch r.State {
+	case mylet.MemberOnline:
+		if r.TransactionsInQueue > GroupMaxQueue {
+			return v1.Yellow
+		}
+		return v1.Green
+	case mylet.MemberRecovering:
+		return v1.Yellow
+	default:
+		return v1.Red
+	}
+}
+
+// SyncMembers copies the member reports into the solo status, returns the number of changes
+func (g *MysqlGroup) SyncMembers(now time.Time) int {
+	change := 0
+	for i := range g.Status.Solos {
+		s := &g.Status.Solos[i].Status
+		var state, role string
+		var queue int64
+		if r := g.FreshMember(i, now); r != nil {
+			state, role, queue = r.State, r.Role, r.TransactionsInQueue
+		}
+		if s.MemberState != state || s.MemberRole != role {
+			log.Infoln(g.Name, g.SoloName(i), "member", s.MemberState, s.MemberRole, "to", state, role)
+			change++
+		}
+		s.MemberState, s.MemberRole, s.TransactionsInQueue = state, role, queue
+	}
+	return change
+}
+
+// SyncGroupPrimary points the write id at the online group primary,
+// in multi primary mode it stays unless its member is no longer online,
+// returns the number of changes
+func (g *MysqlGroup) SyncGroupPrimary(now time.Time) int {
+	if g.Spec.PrimaryMode == v1.ModeClassic {
+		return 0
+	}
+
+	writeId := *g.Status.WriteId
+	newId := -1
+	for i := 0; i < g.Spec.Primaries; i++ {
+		r := g.FreshMember(i, now)
+		if r == nil || r.State != mylet.MemberOnline || r.Role != mylet.RolePrimary {
+			continue
+		}
+		if i == writeId {
+			return 0
+		}
+		if newId == -1 {
+			newId = i
+		}
+	}
+	if newId == -1 {
+		return 0
+	}
+
+	log.Infoln(g.Name, "group primary", writeId, "to", newId)
+	g.SetCondition(v1.ConditionFailoverInProgress, metav1.ConditionTrue, "GroupPrimary",
+		fmt.Sprintf("group primary %d to %d", writeId, newId))
+	g.Status.WriteId = pointer.IntPtr(newId)
+	g.SwitchTime = now
+	return 1
+}
+
+// BlockBootstrap surfaces why the group is not bootstrapped, an empty reason clears it
+func (g *MysqlGroup) BlockBootstrap(reason, message string) {
+	change := false
+	if reason != "" {
+		change = g.SetCondition(v1.ConditionBootstrapBlocked, metav1.ConditionTrue, reason, message)
+	} else if meta.FindStatusCondition(g.Status.Conditions, v1.ConditionBootstrapBlocked) != nil {
+		change = g.SetCondition(v1.ConditionBootstrapBlocked, metav1.ConditionFalse, "Bootstrapped", "")
+	}
+	if change {
+		g.C <- event.GenericEvent{Object: g.Mysql}
+	}
+}
+
+// GroupAction decides the member action from the recorded reports,
+// the group is bootstrapped on exactly one member at a time,
+// the one whose gtid set contains those of all the others,
+// never while a member is still recovering.
+func (g *MysqlGroup) GroupAction(id int, now time.Time) string {
+	m := g.Members[id]
+
+	if !g.Bootstrapped() {
+		// the conversion bootstraps the group on the old primary
+		return ""
+	}
+
+	switch m.State {
+	case mylet.MemberOnline, mylet.MemberRecovering:
+		if g.BootstrapId != nil && *g.BootstrapId == id {
+			log.Infoln(g.Name, "group bootstrapped on", g.SoloName(id))
+			g.BootstrapId = nil
+		}
+		g.OutageTime = time.Time{}
+		if m.State == mylet.MemberOnline {
+			g.BlockBootstrap("", "")
+		}
+		return ""
+	}
+
+	fresh := make(map[int]*GroupMemberReport, len(g.Members))
+	for i := range g.Members {
+		if r := g.FreshMember(i, now); r != nil {
+			fresh[i] = r
+		}
+	}
+
+	for _, r := range fresh {
+		if r.State == mylet.MemberOnline {
+			return mylet.GroupActionJoin
+		}
+	}
+	for i, r := range fresh {
+		if r.State == mylet.MemberRecovering {
+			// its gtid set is partial and it holds a place in the quorum, wait for it to fail or go online
+			g.BlockBootstrap("MemberRecovering", g.SoloName(i)+" is recovering without an online donor")
+			return ""
+		}
+	}
+
+	// no member is online, the first bootstrap or a full group outage
+	if g.BootstrapId != nil {
+		if now.Sub(g.BootstrapTime) < GroupBootstrapTimeout {
+			if *g.BootstrapId == id {
+				return mylet.GroupActionBootstrap
+			}
+			return ""
+		}
+		log.Errorln(g.Name, "group bootstrap timeout on", g.SoloName(*g.BootstrapId))
+		g.BootstrapId = nil
+	}
+
+	if g.OutageTime.IsZero() {
+		g.OutageTime = now
+	}
+
+	n := g.Spec.Primaries
+	if len(fresh) < n {
+		// bootstrapping without every member may lose transactions
+		if 2*len(fresh) <= n || now.Sub(g.OutageTime) < GroupQuorumTimeout {
+			return ""
+		}
+		log.Errorln(g.Name, "group bootstrap with", len(fresh), "of", n, "members")
+	}
+
+	best := -1
+	var bestSet mylet.GtidSet
+	sets := make(map[int]mylet.GtidSet, len(fresh))
+	for i, r := range fresh {
+		s, err := mylet.ParseGtidSet(r.GtidExecuted)
+		if err != nil {
+			log.Errorln(g.Name, g.SoloName(i), err)
+			return ""
+		}
+		sets[i] = s
+	}
+	for i := 0; i < n; i++ {
+		s, ok := sets[i]
+		if !ok {
+			continue
+		}
+		if best == -1 || s.Count() > bestSet.Count() {
+			best, bestSet = i, s
+		}
+	}
+	var diverged []string
+	for i, s := range sets {
+		if !bestSet.Contains(s) {
+			diverged = append(diverged, g.SoloName(i))
+		}
+	}
+	if len(diverged) > 0 {
+		// no member has all the transactions, any choice loses some
+		sort.Strings(diverged)
+		msg := fmt.Sprintf("gtid set of %s diverged from %s, no member contains all the others", strings.Join(diverged, ", "), g.SoloName(best))
+		log.Errorln(g.Name, msg)
+		g.BlockBootstrap("GtidDiverged", msg)
+		return ""
+	}
+	g.BlockBootstrap("", "")
+
+	log.Infoln(g.Name, "group bootstrap on", g.SoloName(best), "gtid executed", fresh[best].GtidExecuted)
+	g.BootstrapId = &best
+	g.BootstrapTime = now
+	g.OutageTime = time.Time{}
+
+	if best == id {
+		return mylet.GroupActionBootstrap
+	}
+	return ""
+}
@@ -0,0 +1,131 @@
+package myctl
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"github.com/cxr29/log"
+	"github.com/cxr29/tiny"
+	v1 "github.com/erda-project/mysql-operator/api/v1"
+	"github.com/erda-project/mysql-operator/pkg/mylet"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const (
+	LeaderName      = "myctl-leader"
+	LeaderAddrKey   = "addr"
+	LeaderTTL       = Timeout5s
+	ForwardedHeader = "X-Myctl-Forwarded"
+)
+
+// StartGrace suppresses switching until every mylet has reported twice to a new leader,
+// mylets report every 10s
+const StartGrace = 25 * time.Second
+
+// Leader is run by the manager once elected, the groups are only
+// created by the controller on the leader, followers forward to it.
+func (ctl *Myctl) Leader() manager.Runnable {
+	return manager.RunnableFunc(func(ctx context.Context) error {
+		_, port, err := net.SplitHostPort(mylet.HttpAddr)
+		if err != nil {
+			return err
+		}
+		addr := net.JoinHostPort(v1.PodIp, port)
+		log.Infoln("elected leader", v1.PodName, addr)
+
+		ctl.Lock()
+		ctl.IsLeader = true
+		ctl.Unlock()
+
+		if ctl.Client != nil {
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      LeaderName,
+					Namespace: v1.Namespace,
+				},
+			}
+			_, err = controllerutil.CreateOrUpdate(ctx, ctl.Client, cm, func() error {
+				cm.Data = map[string]string{
+					LeaderAddrKey: addr,
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		<-ctx.Done()
+		return nil
+	})
+}
+
+// LeaderAddr returns the published leader address, cached for a while
+func (ctl *Myctl) LeaderAddr(ctx context.Context) (string, error) {
+	ctl.Lock()
+	if time.Since(ctl.leaderTime) < LeaderTTL {
+		addr := ctl.leaderAddr
+		ctl.Unlock()
+		return addr, nil
+	}
+	ctl.Unlock()
+
+	cm := &corev1.ConfigMap{}
+	err := ctl.APIReader.Get(ctx, client.ObjectKey{
+		Namespace: v1.Namespace,
+		Name:      LeaderName,
+	}, cm)
+	if err != nil {
+		return "", err
+	}
+
+	ctl.Lock()
+	ctl.leaderAddr = cm.Data[LeaderAddrKey]
+	ctl.leaderTime = time.Now()
+	ctl.Unlock()
+
+	return cm.Data[LeaderAddrKey], nil
+}
+
+// Forward proxies the mylet calls to the leader when running as a follower
+func (ctl *Myctl) Forward(ctx *tiny.Context) {
+	ctl.Lock()
+	leader := ctl.IsLeader || ctl.APIReader == nil
+	ctl.Unlock()
+	if leader {
+		return
+	}
+
+	if ctx.Request.Header.Get(ForwardedHeader) != "" {
+		ctx.WriteError("leader not ready")
+		return
+	}
+
+	c, cancel := context.WithTimeout(ctx.Request.Context(), Timeout5s)
+	defer cancel()
+	addr, err := ctl.LeaderAddr(c)
+	if err != nil || addr == "" {
+		log.ErrError(err, "leader addr")
+		ctx.WriteError("leader not found")
+		return
+	}
+
+	p := httputil.NewSingleHostReverseProxy(&url.URL{
+		Scheme: "http",
+		Host:   addr,
+	})
+	p.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Errorln("forward to leader", addr, err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	ctx.Request.Header.Set(ForwardedHeader, v1.PodName)
+	p.ServeHTTP(ctx, ctx.Request)
+}
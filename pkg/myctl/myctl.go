@@ -1,12 +1,18 @@
 package myctl
 
 import (
+	"context"
 	"sync"
+	"time"
+
+	"github.com/cxr29/log"
 
 	v1 "github.com/erda-project/mysql-operator/api/v1"
 	"github.com/erda-project/mysql-operator/pkg/mylet"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 )
 
@@ -16,15 +22,30 @@ type Myctl struct {
 	C chan event.GenericEvent
 	M map[types.NamespacedName]*MysqlGroup
 
+	// On-demand backups by the MysqlBackup key
+	Backups map[types.NamespacedName]*BackupJob
+
+	// Checkpoint the group state, optional
+	Client    client.Client
+	APIReader client.Reader
+
+	// Only the leader runs the groups, followers forward
+	IsLeader   bool
+	leaderAddr string
+	leaderTime time.Time
+
 	ReadinessProbe bool
 	LivenessProbe  bool
 	StartupProbe   bool
 }
 
-func NewMyctl() *Myctl {
+func NewMyctl(c client.Client, r client.Reader) *Myctl {
 	ctl := &Myctl{
-		C: make(chan event.GenericEvent),
-		M: make(map[types.NamespacedName]*MysqlGroup, 10),
+		C:         make(chan event.GenericEvent),
+		M:         make(map[types.NamespacedName]*MysqlGroup, 10),
+		Backups:   make(map[types.NamespacedName]*BackupJob, 10),
+		Client:    c,
+		APIReader: r,
 	}
 	go ctl.Run()
 	return ctl
@@ -57,6 +78,8 @@ func (ctl *Myctl) GetOrNewGroup(mysql *v1.Mysql) (*MysqlGroup, error) {
 		Myctl:    ctl,
 		Mysql:    mysql.DeepCopy(),
 		ExitChan: make(chan struct{}, 1),
+
+		StartTime: time.Now(),
 	}
 
 	if err := g.Validate(); err != nil {
@@ -73,6 +96,7 @@ func (ctl *Myctl) GetOrNewGroup(mysql *v1.Mysql) (*MysqlGroup, error) {
 		writeId = 0
 	}
 	g.Status.WriteId = pointer.IntPtr(writeId)
+	g.SpecPrimaryId = *g.Spec.PrimaryId
 
 	readId := g.Spec.Primaries
 	if *g.Spec.Replicas == 0 {
@@ -83,6 +107,18 @@ func (ctl *Myctl) GetOrNewGroup(mysql *v1.Mysql) (*MysqlGroup, error) {
 	n := g.Spec.Size() + 1
 	g.States = make(map[mylet.StateKey]*mylet.MysqlState, n*n)
 
+	// restore before the first check, the spec may lag behind a switch
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout5s)
+	defer cancel()
+	c, err := ctl.LoadCheckpoint(ctx, g.Mysql)
+	if err != nil {
+		log.Errorln(g.Name, "load checkpoint", err)
+	} else if c != nil {
+		log.Infoln(g.Name, "restore checkpoint", c.SaveTime, "write id", c.WriteId)
+		g.Restore(c)
+	}
+	g.SyncReadIds()
+
 	ctl.M[k] = g
 
 	go g.Start()
@@ -93,15 +129,28 @@ func (ctl *Myctl) GetOrNewGroup(mysql *v1.Mysql) (*MysqlGroup, error) {
 	return g, nil
 }
 
+// GetGroup returns the running group, nil if the mysql is not reconciled yet
+func (ctl *Myctl) GetGroup(k types.NamespacedName) *MysqlGroup {
+	ctl.Lock()
+	defer ctl.Unlock()
+
+	return ctl.M[k]
+}
+
 func (ctl *Myctl) SyncSpec(mysql *v1.Mysql) error {
 	g, err := ctl.GetOrNewGroup(mysql)
-	if err == nil {
-		err = g.Diff(mysql)
-	}
 	if err != nil {
 		return err
 	}
 
+	g.Generation = mysql.Generation
+	if err = g.Diff(mysql); err != nil {
+		g.SetCondition(v1.ConditionSpecInvalid, metav1.ConditionTrue, "ValidateFailed", err.Error())
+		return err
+	}
+	g.SetCondition(v1.ConditionSpecInvalid, metav1.ConditionFalse, "Validated", "")
+	g.Status.ObservedGeneration = mysql.Generation
+
 	mysql.Spec = *g.Spec.DeepCopy()
 	mysql.Status = *g.Status.DeepCopy()
 
@@ -0,0 +1,292 @@
+package myctl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/cxr29/log"
+	v1 "github.com/erda-project/mysql-operator/api/v1"
+	"github.com/erda-project/mysql-operator/pkg/mylet"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RestoreRequest resolves the archive to stage, a backup served by the mylet of the source solo,
+// the latest one within a day if no backup time is given, or the external url.
+// A point in time restore picks the nearest backup finished before the time and not containing the gtid,
+// the same rule the mylet applies to the chain, and stages the binlogs after it.
+func (ctl *Myctl) RestoreRequest(ctx context.Context, restore *v1.MysqlRestore) (mylet.RestoreRequest, error) {
+	src := restore.Spec.Source
+	pitr := restore.Spec.PointInTime
+	r := mylet.RestoreRequest{
+		Name:        restore.Name,
+		Action:      mylet.RestoreStage,
+		URL:         src.URL,
+		Incremental: src.Incremental,
+	}
+	if src.URL != "" {
+		if pitr != nil {
+			return r, fmt.Errorf("point in time restore needs a mylet source")
+		}
+		return r, nil
+	}
+
+	g := ctl.GetGroup(types.NamespacedName{
+		Namespace: restore.Namespace,
+		Name:      src.MysqlName,
+	})
+	if g == nil {
+		return r, ErrGroupNotFound
+	}
+
+	g.Lock()
+	source := v1.BackupSourceSolo
+	if src.SoloId == nil {
+		source = v1.BackupSourceReplica
+	}
+	id, err := g.BackupSource(source, src.SoloId)
+	mysql := g.Mysql.DeepCopy()
+	g.Unlock()
+	if err != nil {
+		return r, err
+	}
+	s := mysql.Status.Solos[id]
+
+	datetime := src.BackupTime
+	if datetime == "" && pitr != nil {
+		var target mylet.GtidSet
+		if pitr.Gtid != "" {
+			if target, err = mylet.ParseGtidSet(pitr.Gtid); err != nil {
+				return r, err
+			}
+		}
+		a, err := ListBackups(ctx, mysql, id)
+		if err != nil {
+			return r, err
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			t, err := time.ParseInLocation(mylet.DatetimeLayout, a[i].BackupTime, time.Local)
+			// the duration of a chain only in the backup storage is not known
+			if err != nil || (pitr.Time != nil && !t.Add(a[i].Duration).Before(pitr.Time.Time)) {
+				continue
+			}
+			// the gtid of a chain only in the backup storage is not known
+			if target != nil && a[i].Gtid != "" {
+				if set, err := mylet.ParseGtidSet(a[i].Gtid); err == nil && set.Contains(target) {
+					continue
+				}
+			}
+			datetime = a[i].BackupTime
+			break
+		}
+		if datetime == "" {
+			return r, fmt.Errorf("no backup of %s before the point in time", mysql.SoloName(id))
+		}
+	}
+	if datetime == "" {
+		datetime = "replication"
+	}
+
+	u := url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(s.Spec.Host, strconv.Itoa(s.Spec.MyletPort)),
+		Path:   "/api/addons/mylet/download/backup",
+	}
+	q := make(url.Values, 1)
+	q.Set("datetime", datetime)
+	u.RawQuery = q.Encode()
+
+	r.URL = u.String()
+	r.Token = mylet.SoloToken(mysql, mysql.BuildName("myctl"))
+
+	if pitr != nil {
+		u.Path = "/api/addons/mylet/download/binlogs"
+		q = make(url.Values, 1)
+		q.Set("since", datetime)
+		u.RawQuery = q.Encode()
+
+		r.BinlogURL = u.String()
+		r.StopGtid = pitr.Gtid
+		if pitr.Time != nil {
+			t := pitr.Time.Time
+			r.StopTime = &t
+		}
+	}
+	return r, nil
+}
+
+// StartRestore marks the mysql restoring, failover is held until FinishRestore
+func (ctl *Myctl) StartRestore(k types.NamespacedName, name string) error {
+	g := ctl.GetGroup(k)
+	if g == nil {
+		return ErrGroupNotFound
+	}
+
+	g.Lock()
+	defer g.Unlock()
+
+	switch {
+	case g.Status.Restoring == name:
+		return nil
+	case g.Status.Restoring != "":
+		return fmt.Errorf("restoring %s", g.Status.Restoring)
+	case g.Status.Conversion != nil:
+		return fmt.Errorf("converting to %s", g.Status.Conversion.To.PrimaryMode)
+	case g.Spec.PrimaryMode != v1.ModeClassic:
+		return fmt.Errorf("%s mysql is not restored in place", g.Spec.PrimaryMode)
+	}
+
+	log.Infoln(g.Name, "restore", name)
+	g.Status.Restoring = name
+	return nil
+}
+
+// FinishRestore resumes failover
+func (ctl *Myctl) FinishRestore(k types.NamespacedName, name string) {
+	g := ctl.GetGroup(k)
+	if g == nil {
+		return
+	}
+
+	g.Lock()
+	defer g.Unlock()
+
+	if g.Status.Restoring == name {
+		log.Infoln(g.Name, "restore finished", name)
+		g.Status.Restoring = ""
+	}
+}
+
+// ForgetRestore finishes the deleted restore on any mysql of the namespace
+func (ctl *Myctl) ForgetRestore(k types.NamespacedName) {
+	ctl.Lock()
+	var a []types.NamespacedName
+	for gk := range ctl.M {
+		if gk.Namespace == k.Namespace {
+			a = append(a, gk)
+		}
+	}
+	ctl.Unlock()
+
+	for _, gk := range a {
+		ctl.FinishRestore(gk, k.Name)
+	}
+}
+
+// RestoreReports returns a copy of the restore reports by solo
+func (ctl *Myctl) RestoreReports(k types.NamespacedName) map[int]mylet.RestoreReport {
+	g := ctl.GetGroup(k)
+	if g == nil {
+		return nil
+	}
+
+	g.Lock()
+	defer g.Unlock()
+
+	m := make(map[int]mylet.RestoreReport, len(g.Restores))
+	for id, r := range g.Restores {
+		m[id] = r
+	}
+	return m
+}
+
+// RequestRestore sends the restore action to the solo
+func (ctl *Myctl) RequestRestore(ctx context.Context, k types.NamespacedName, id int, r mylet.RestoreRequest) error {
+	g := ctl.GetGroup(k)
+	if g == nil {
+		return ErrGroupNotFound
+	}
+
+	g.Lock()
+	m := g.Mysql.DeepCopy()
+	g.Unlock()
+
+	log.Infoln(k.String(), "restore", r.Name, r.Action, m.SoloName(id))
+	return RestoreSolo(ctx, m, id, r)
+}
+
+// RestartSolo deletes the pod, the statefulset recreates it
+func (ctl *Myctl) RestartSolo(ctx context.Context, mysql *v1.Mysql, id int) error {
+	pod := &corev1.Pod{}
+	err := ctl.Client.Get(ctx, types.NamespacedName{
+		Namespace: mysql.Namespace,
+		Name:      mysql.SoloName(id),
+	}, pod)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	log.Infoln(mysql.Name, "restart", pod.Name)
+	err = ctl.Client.Delete(ctx, pod, client.Preconditions{UID: &pod.UID})
+	if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+		err = nil
+	}
+	return err
+}
+
+func RestoreSolo(ctx context.Context, mysql *v1.Mysql, id int, r mylet.RestoreRequest) error {
+	s := mysql.Status.Solos[id]
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	u := url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(s.Spec.Host, strconv.Itoa(s.Spec.MyletPort)),
+		Path:   "/api/addons/mylet/restore",
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mylet.Timeout1m)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Token", mylet.SoloToken(mysql, mysql.BuildName("myctl")))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	b, err = io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code %d, body: %s", res.StatusCode, string(b))
+	}
+
+	var v struct {
+		Data  json.RawMessage
+		Error interface{}
+	}
+
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+
+	if v.Error != nil {
+		return fmt.Errorf("return error: %s", v.Error)
+	}
+
+	return nil
+}
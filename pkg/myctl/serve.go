@@ -2,6 +2,8 @@ package myctl
 
 import (
 	"encoding/json"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cxr29/log"
@@ -9,6 +11,8 @@ import (
 	"github.com/cxr29/tiny/alog"
 	v1 "github.com/erda-project/mysql-operator/api/v1"
 	"github.com/erda-project/mysql-operator/pkg/mylet"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/event"
@@ -51,7 +55,7 @@ func (ctl *Myctl) Route(r *tiny.Router) {
 	})
 
 	r.Group("/<ns>", func(r *tiny.Router) {
-		r.Use(mylet.PushToken, ctl.PushMysqlGroup)
+		r.Use(ctl.Forward, mylet.PushToken, ctl.PushMysqlGroup)
 		r.GET("/mysql", ctl._Mysql)
 		r.POST("/report", ctl._Report)
 	})
@@ -117,6 +121,10 @@ func (ctl *Myctl) _Report(ctx *tiny.Context) {
 	}
 
 	g := ctl.PullMysqlGroup(ctx)
+
+	g.Lock()
+	defer g.Unlock()
+
 	n := g.Spec.Size()
 
 	now := time.Now()
@@ -149,14 +157,34 @@ func (ctl *Myctl) _Report(ctx *tiny.Context) {
 		log.Infof("[_Report] 收到上报: FromId=%d ToId=%d ErrorCount=%d GreenTime=%v RedTime=%v LastError=%s", s.FromId, s.ToId, s.ErrorCount, s.GreenTime, s.RedTime, s.LastError)
 	}
 
+	g.Status.Solos[t.Id].Status.Lag = v.Lag
+	g.Status.Solos[t.Id].Status.ConfigHash = v.ConfigHash
+
 	sizeSpec := mylet.NewSizeSpec(g.Mysql)
 	if sizeSpec != v.SizeSpec {
 		log.Infoln(v.Name, "size spec out of sync")
 	}
 
+	if g.SoloSizeSpecs == nil {
+		g.SoloSizeSpecs = make(map[int]mylet.SizeSpec, n)
+		g.ConvertErrors = make(map[int]string, n)
+		g.Restores = make(map[int]mylet.RestoreReport, n)
+	}
+	g.SoloSizeSpecs[t.Id] = v.SizeSpec
+	g.ConvertErrors[t.Id] = v.ConvertError
+	g.Restores[t.Id] = v.Restore
+
+	var action string
+	if v.Group != nil && g.IsMember(t.Id) {
+		g.RecordMember(t.Id, v.Group, now)
+		action = g.GroupAction(t.Id, now)
+	}
+
 	ctx.WriteData(mylet.ReportResult{
 		ReceiveTime: now,
 		SizeSpec:    sizeSpec,
+		ConfigHash:  g.Status.ConfigHash,
+		GroupAction: action,
 	})
 }
 
@@ -176,9 +204,19 @@ func (g *MysqlGroup) Check() error {
 		c := v1.Green
 		if red+yellow > green {
 			c = v1.Red
-			nRed++
 		} else if red+yellow > 0 {
 			c = v1.Yellow
+		}
+		// reachable is not enough for a member, it must be online in the group
+		switch mc := g.MemberColor(i, now); {
+		case mc == v1.Red:
+			c = v1.Red
+		case mc == v1.Yellow && c == v1.Green:
+			c = v1.Yellow
+		}
+		if c == v1.Red {
+			nRed++
+		} else if c == v1.Yellow {
 			nYellow++
 		}
 		if g.Status.Solos[i].Status.Color != c {
@@ -199,6 +237,15 @@ func (g *MysqlGroup) Check() error {
 		change++
 	}
 
+	change += g.SyncMembers(now)
+	change += g.SyncGroupPrimary(now)
+	change += g.SyncConditions(now)
+	change += g.SyncReadIds()
+
+	if change > 0 || now.Sub(g.CheckpointTime) > CheckpointInterval {
+		g.Checkpoint(now)
+	}
+
 	if change > 0 {
 		g.C <- event.GenericEvent{Object: g.Mysql}
 	}
@@ -207,6 +254,18 @@ func (g *MysqlGroup) Check() error {
 		return nil
 	}
 
+	// states are incomplete right after a restart or leader handover
+	if now.Sub(g.StartTime) < StartGrace {
+		g.SwitchCount = 0
+		return nil
+	}
+
+	// the solos restart onto the restored data, a failover would lose it
+	if g.Status.Restoring != "" {
+		g.SwitchCount = 0
+		return nil
+	}
+
 	primaryId := *g.Spec.PrimaryId
 	red, yellow, green := g.Color(primaryId)
 	if red+yellow > 0 {
@@ -257,3 +316,86 @@ func (g *MysqlGroup) Check() error {
 
 	return nil
 }
+
+// SyncConditions derives the conditions from colors, returns the number of changes
+func (g *MysqlGroup) SyncConditions(now time.Time) int {
+	change := 0
+
+	status, reason := metav1.ConditionFalse, "NotGreen"
+	if g.Status.Color == v1.Green {
+		status, reason = metav1.ConditionTrue, "Green"
+	}
+	if g.SetCondition(v1.ConditionReady, status, reason, "color "+g.Status.Color) {
+		change++
+	}
+
+	writeId := *g.Status.WriteId
+	var a []string
+	for i, s := range g.Status.Solos {
+		if i != writeId && s.Status.Color != v1.Green {
+			a = append(a, g.SoloName(i)+" "+s.Status.Color)
+		}
+	}
+	status, reason = metav1.ConditionTrue, "AllGreen"
+	if len(a) > 0 {
+		status, reason = metav1.ConditionFalse, "NotGreen"
+	}
+	if g.SetCondition(v1.ConditionReplicating, status, reason, strings.Join(a, ", ")) {
+		change++
+	}
+
+	if !g.IsConditionTrue(v1.ConditionFailoverInProgress) {
+		if meta.FindStatusCondition(g.Status.Conditions, v1.ConditionFailoverInProgress) == nil {
+			g.SetCondition(v1.ConditionFailoverInProgress, metav1.ConditionFalse, "Stable", "")
+			change++
+		}
+	} else if now.Sub(g.SwitchTime) > Timeout15s && g.Status.Solos[writeId].Status.Color == v1.Green {
+		if g.SetCondition(v1.ConditionFailoverInProgress, metav1.ConditionFalse, "Completed", "write id "+strconv.Itoa(writeId)) {
+			change++
+		}
+	}
+
+	return change
+}
+
+// ReadMaxLag is the max seconds behind the source to serve reads
+const ReadMaxLag = 10
+
+// SyncReadIds selects the green and caught up replicas for the read service,
+// falls back to the primary, returns the number of changes
+func (g *MysqlGroup) SyncReadIds() int {
+	writeId := *g.Status.WriteId
+	var a []int
+	for i, s := range g.Status.Solos {
+		if i == writeId || s.Status.Color != v1.Green {
+			continue
+		}
+		if s.Status.Lag != nil && (*s.Status.Lag < 0 || *s.Status.Lag > ReadMaxLag) {
+			continue
+		}
+		a = append(a, i)
+	}
+	if len(a) == 0 {
+		a = append(a, writeId)
+	}
+
+	if EqInts(g.Status.ReadIds, a) {
+		return 0
+	}
+	log.Infoln(g.Name, "read ids", g.Status.ReadIds, "to", a)
+	g.Status.ReadIds = a
+	g.Status.ReadId = pointer.IntPtr(a[0])
+	return 1
+}
+
+func EqInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, v := range a {
+		if v != b[i] {
+			return false
+		}
+	}
+	return true
+}
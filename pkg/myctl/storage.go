@@ -0,0 +1,155 @@
+package myctl
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/cxr29/log"
+	v1 "github.com/erda-project/mysql-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// ExpandStorage patches the claims smaller than the storage size,
+// returns whether there is nothing to wait for, all claims expanded and their filesystems resized,
+// or the rest blocked by a storage class not allowing expansion until the spec changes.
+func (ctl *Myctl) ExpandStorage(ctx context.Context, mysql *v1.Mysql) (bool, error) {
+	if ctl.Client == nil {
+		return true, nil
+	}
+
+	g, err := ctl.GetOrNewGroup(mysql)
+	if err != nil {
+		return false, err
+	}
+
+	g.Lock()
+	size := g.Spec.StorageSize.DeepCopy()
+	n := g.Spec.Size()
+	g.Unlock()
+
+	s := &v1.MysqlStorageStatus{
+		Size:  size,
+		Total: n,
+	}
+	var pending []string
+	blocked := 0
+
+	for i := 0; i < n; i++ {
+		pvc := &corev1.PersistentVolumeClaim{}
+		err = ctl.Client.Get(ctx, client.ObjectKey{
+			Namespace: mysql.Namespace,
+			Name:      "mydir-" + mysql.Name + "-" + strconv.Itoa(i),
+		}, pvc)
+		if apierrors.IsNotFound(err) {
+			// not created by the statefulset yet
+			pending = append(pending, "mydir-"+mysql.Name+"-"+strconv.Itoa(i))
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+
+		request := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+		if request.Cmp(size) < 0 {
+			ok, err := ctl.AllowVolumeExpansion(ctx, pvc)
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				s.Phase = v1.StorageUnsupported
+				pending = append(pending, pvc.Name)
+				blocked++
+				continue
+			}
+
+			patch := client.MergeFrom(pvc.DeepCopy())
+			pvc.Spec.Resources.Requests[corev1.ResourceStorage] = size
+			if err = ctl.Client.Patch(ctx, pvc, patch); err != nil {
+				return false, err
+			}
+			log.Infoln(mysql.Name, "expand", pvc.Name, request.String(), "to", size.String())
+
+			if s.Phase != v1.StorageUnsupported {
+				s.Phase = v1.StorageExpanding
+			}
+			pending = append(pending, pvc.Name)
+			continue
+		}
+
+		capacity := pvc.Status.Capacity[corev1.ResourceStorage]
+		if capacity.Cmp(size) < 0 || IsResizing(pvc) {
+			if s.Phase == "" {
+				s.Phase = v1.StorageResizing
+			}
+			pending = append(pending, pvc.Name)
+			continue
+		}
+
+		s.Expanded++
+	}
+
+	done := s.Expanded == n
+	if !done {
+		s.Message = "pending " + strings.Join(pending, ", ")
+		if s.Phase == v1.StorageUnsupported {
+			s.Message = "storage class does not allow volume expansion, " + s.Message
+		}
+	}
+
+	g.Lock()
+	if done {
+		g.Status.Storage = nil
+	} else {
+		g.Status.Storage = s
+	}
+	change := false
+	if blocked > 0 {
+		change = g.SetCondition(v1.ConditionStorageBlocked, metav1.ConditionTrue, "ExpansionNotAllowed", s.Message)
+	} else if meta.FindStatusCondition(g.Status.Conditions, v1.ConditionStorageBlocked) != nil {
+		change = g.SetCondition(v1.ConditionStorageBlocked, metav1.ConditionFalse, "Expandable", "")
+	}
+	m := g.Mysql
+	g.Unlock()
+
+	if change {
+		// flush the status, it is not requeued while blocked
+		g.C <- event.GenericEvent{Object: m}
+	}
+
+	return s.Expanded+blocked == n, nil
+}
+
+func (ctl *Myctl) AllowVolumeExpansion(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (bool, error) {
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+		return false, nil
+	}
+
+	sc := &storagev1.StorageClass{}
+	err := ctl.Client.Get(ctx, client.ObjectKey{Name: *pvc.Spec.StorageClassName}, sc)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return sc.AllowVolumeExpansion != nil && *sc.AllowVolumeExpansion, nil
+}
+
+func IsResizing(pvc *corev1.PersistentVolumeClaim) bool {
+	for _, c := range pvc.Status.Conditions {
+		if (c.Type == corev1.PersistentVolumeClaimResizing ||
+			c.Type == corev1.PersistentVolumeClaimFileSystemResizePending) &&
+			c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package myctl
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -15,15 +16,15 @@ import (
 	"github.com/cxr29/log"
 	v1 "github.com/erda-project/mysql-operator/api/v1"
 	"github.com/erda-project/mysql-operator/pkg/mylet"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 )
 
 const ( //TODO Spec
-	Timeout5s     = 5 * time.Second
-	Timeout15s    = 15 * time.Second
-	SwitchCount   = 2
-	MyctlReplicas = 1
+	Timeout5s   = 5 * time.Second
+	Timeout15s  = 15 * time.Second
+	SwitchCount = 2
 )
 
 func (g *MysqlGroup) Color(id int) (red, yellow, green int) {
@@ -55,14 +56,19 @@ func (g *MysqlGroup) SwitchPrimary(newId int) error {
 	}
 
 	log.Infoln(g.Name, "switch primary", *g.Status.WriteId, "to", newId)
+	g.SetCondition(v1.ConditionFailoverInProgress, metav1.ConditionTrue, "SwitchPrimary",
+		fmt.Sprintf("switch primary %d to %d", *g.Status.WriteId, newId))
 
 	g.Spec.PrimaryId = pointer.IntPtr(newId)
 	g.Status.WriteId = pointer.IntPtr(newId)
-	//TODO readId
+	g.SyncReadIds()
 
 	g.SwitchTime = now
 	g.SwitchCount = 0
 
+	// queue the decision to be persisted before telling the mylets
+	g.Checkpoint(now)
+
 	g.C <- event.GenericEvent{Object: g.Mysql}
 
 	f := func() bool {
@@ -86,6 +92,110 @@ func (g *MysqlGroup) SwitchPrimary(newId int) error {
 	return nil
 }
 
+// PlannedSwitch fences the writer and waits for the new primary to apply
+// its GTID set before switching, so no commit in flight is lost
+func (g *MysqlGroup) PlannedSwitch(newId int) error {
+	if newId < 0 || newId >= g.Spec.Size() {
+		return fmt.Errorf("primary id out of range")
+	}
+	if time.Since(g.SwitchTime) < Timeout15s {
+		return fmt.Errorf("too frequently")
+	}
+
+	oldId := *g.Status.WriteId
+	ctx := context.Background()
+
+	r, err := Fence(ctx, g.Mysql, oldId, true)
+	if err != nil {
+		err = fmt.Errorf("fence %d: %w", oldId, err)
+	} else if err = WaitGtid(ctx, g.Mysql, newId, r.GtidExecuted); err != nil {
+		err = fmt.Errorf("wait gtid on %d: %w", newId, err)
+	} else {
+		err = g.SwitchPrimary(newId)
+	}
+
+	if err != nil {
+		if _, e := Fence(ctx, g.Mysql, oldId, false); e != nil {
+			log.Errorln(g.Name, oldId, "unfence", e)
+		}
+	}
+	return err
+}
+
+// Fence sets the read only of the solo, returns its executed GTID set
+func Fence(ctx context.Context, mysql *v1.Mysql, id int, readOnly bool) (mylet.FenceResult, error) {
+	var r mylet.FenceResult
+	err := PostMylet(ctx, mysql, id, "fence", mylet.FenceRequest{ReadOnly: readOnly}, &r)
+	return r, err
+}
+
+// WaitGtid waits for the solo to apply the GTID set
+func WaitGtid(ctx context.Context, mysql *v1.Mysql, id int, gtid string) error {
+	var ok bool
+	return PostMylet(ctx, mysql, id, "wait/gtid", mylet.WaitGtidRequest{
+		Gtid:    gtid,
+		Timeout: int(Timeout5s / time.Second),
+	}, &ok)
+}
+
+// PostMylet posts the request to the mylet of the solo and decodes the returned data
+func PostMylet(ctx context.Context, mysql *v1.Mysql, id int, path string, in, out interface{}) error {
+	s := mysql.Status.Solos[id]
+
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	u := url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(s.Spec.Host, strconv.Itoa(s.Spec.MyletPort)),
+		Path:   "/api/addons/mylet/" + path,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, Timeout15s)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Token", mylet.SoloToken(mysql, mysql.BuildName("myctl")))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	b, err = io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code %d, body: %s", res.StatusCode, string(b))
+	}
+
+	var v struct {
+		Data  json.RawMessage
+		Error interface{}
+	}
+
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+
+	if v.Error != nil {
+		return fmt.Errorf("return error: %s", v.Error)
+	}
+
+	return json.Unmarshal(v.Data, out)
+}
+
 func SwitchPrimary(ctx context.Context, mysql *v1.Mysql, id int) error {
 	s := mysql.Status.Solos[id]
 
@@ -0,0 +1,202 @@
+package myctl
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cxr29/log"
+	v1 "github.com/erda-project/mysql-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Max seconds behind the source to be caught up
+	UpgradeMaxLag = 1
+	// Wait the colors to settle after each step
+	UpgradeSettle = Timeout15s
+)
+
+// Upgrade rolls the outdated pods of the OnDelete statefulset one at a time,
+// replicas first, then switches over and restarts the old primary last.
+// It returns whether all pods are up to date.
+func (ctl *Myctl) Upgrade(ctx context.Context, mysql *v1.Mysql, sts *appsv1.StatefulSet) (bool, error) {
+	if ctl.Client == nil {
+		return true, nil
+	}
+
+	g, err := ctl.GetOrNewGroup(mysql)
+	if err != nil {
+		return false, err
+	}
+
+	revision := sts.Status.UpdateRevision
+	if revision == "" || sts.Status.ObservedGeneration < sts.Generation {
+		// wait for the statefulset controller
+		return false, nil
+	}
+
+	pods := &corev1.PodList{}
+	err = ctl.Client.List(ctx, pods, client.InNamespace(mysql.Namespace), client.MatchingLabels(mysql.NewLabels()))
+	if err != nil {
+		return false, err
+	}
+
+	n := mysql.Spec.Size()
+	m := make(map[int]*corev1.Pod, n)
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		j := strings.LastIndexByte(pod.Name, '-')
+		id, err := strconv.Atoi(pod.Name[j+1:])
+		if err != nil || !v1.Between(id, 0, n-1) {
+			continue
+		}
+		m[id] = pod
+	}
+
+	pod, done := g.NextUpgrade(revision, m)
+	if pod == nil {
+		return done, nil
+	}
+
+	log.Infoln(mysql.Name, "upgrade restart", pod.Name, "to", revision)
+	err = ctl.Client.Delete(ctx, pod, client.Preconditions{UID: &pod.UID})
+	if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+		err = nil
+	}
+	return false, err
+}
+
+// NextUpgrade decides the next step, returns the pod to restart if any
+func (g *MysqlGroup) NextUpgrade(revision string, m map[int]*corev1.Pod) (*corev1.Pod, bool) {
+	g.Lock()
+	defer g.Unlock()
+
+	n := g.Spec.Size()
+	var outdated []int
+	for id := 0; id < n; id++ {
+		if pod, ok := m[id]; ok && pod.Labels[appsv1.ControllerRevisionHashLabelKey] != revision {
+			outdated = append(outdated, id)
+		}
+	}
+
+	if len(outdated) == 0 && len(m) == n {
+		if g.Status.Upgrade != nil {
+			log.Infoln(g.Name, "upgrade completed", revision)
+			g.Status.Upgrade = nil
+		}
+		return nil, true
+	}
+
+	u := g.Status.Upgrade
+	if u == nil || u.Revision != revision {
+		u = &v1.MysqlUpgradeStatus{
+			Revision:  revision,
+			StartTime: &metav1.Time{Time: time.Now()},
+		}
+		g.Status.Upgrade = u
+	}
+	u.Total = n
+	u.Updated = len(m) - len(outdated)
+
+	wait := func(format string, a ...interface{}) (*corev1.Pod, bool) {
+		u.Phase = v1.UpgradeWaiting
+		u.Message = fmt.Sprintf(format, a...)
+		return nil, false
+	}
+
+	if time.Since(g.UpgradeTime) < UpgradeSettle || time.Since(g.SwitchTime) < UpgradeSettle {
+		return wait("settling")
+	}
+	if g.IsConditionTrue(v1.ConditionFailoverInProgress) {
+		return wait("failover in progress")
+	}
+	if g.Status.Conversion != nil {
+		return wait("conversion in progress")
+	}
+
+	// every pod must be ready, green and caught up before the next restart
+	writeId := *g.Status.WriteId
+	var unhealthy []int
+	var reason []string
+	for id := 0; id < n; id++ {
+		pod, ok := m[id]
+		s := g.Status.Solos[id].Status
+		if !ok || !IsPodReady(pod) {
+			unhealthy, reason = append(unhealthy, id), append(reason, "ready")
+		} else if s.Color != v1.Green {
+			unhealthy, reason = append(unhealthy, id), append(reason, "green")
+		} else if s.Lag != nil && (*s.Lag < 0 || *s.Lag > UpgradeMaxLag) {
+			unhealthy, reason = append(unhealthy, id), append(reason, fmt.Sprintf("caught up, lag %d", *s.Lag))
+		}
+	}
+	if len(unhealthy) == 1 {
+		// the new revision may be the fix of the only unhealthy pod, restart it first
+		id := unhealthy[0]
+		if pod, ok := m[id]; ok && pod.DeletionTimestamp.IsZero() && pod.Labels[appsv1.ControllerRevisionHashLabelKey] != revision {
+			u.Phase = v1.UpgradeRestartingReplica
+			if id == writeId {
+				u.Phase = v1.UpgradeRestartingPrimary
+			}
+			u.CurrentId = pointer.IntPtr(id)
+			u.Message = "restart unhealthy " + g.SoloName(id)
+			g.UpgradeTime = time.Now()
+			return pod, false
+		}
+	}
+	if len(unhealthy) > 0 {
+		return wait("waiting for %s %s", g.SoloName(unhealthy[0]), reason[0])
+	}
+
+	for _, id := range outdated {
+		if id != writeId {
+			u.Phase = v1.UpgradeRestartingReplica
+			u.CurrentId = pointer.IntPtr(id)
+			u.Message = "restart " + g.SoloName(id)
+			g.UpgradeTime = time.Now()
+			return m[id], false
+		}
+	}
+
+	// only the primary is outdated, switch over to an upgraded one if possible
+	if g.Spec.PrimaryMode == v1.ModeClassic {
+		for id := 0; id < n; id++ {
+			if id == writeId {
+				continue
+			}
+			u.Phase = v1.UpgradeSwitchover
+			u.CurrentId = pointer.IntPtr(id)
+			u.Message = fmt.Sprintf("switch primary %d to %d", writeId, id)
+			if err := g.PlannedSwitch(id); err != nil {
+				u.Message += ": " + err.Error()
+			}
+			g.UpgradeTime = time.Now()
+			return nil, false
+		}
+	}
+
+	u.Phase = v1.UpgradeRestartingPrimary
+	u.CurrentId = pointer.IntPtr(writeId)
+	u.Message = "restart " + g.SoloName(writeId)
+	g.UpgradeTime = time.Now()
+	return m[writeId], false
+}
+
+func IsPodReady(pod *corev1.Pod) bool {
+	if !pod.DeletionTimestamp.IsZero() {
+		return false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,389 @@
+package mylet
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "github.com/erda-project/mysql-operator/api/v1"
+	log "github.com/sirupsen/logrus"
+)
+
+// DatabaseRequest is the schema a MysqlDatabase declares
+type DatabaseRequest struct {
+	Name      string
+	Charset   string
+	Collation string
+	Drop      bool
+}
+
+// UserRequest is the account a MysqlUser declares, the password resolved from its secret
+type UserRequest struct {
+	Username           string
+	Host               string
+	Password           string
+	Grants             []v1.MysqlGrant
+	MaxUserConnections int
+	Drop               bool
+}
+
+// AccountResult is what was changed to converge, empty if nothing drifted
+type AccountResult struct {
+	Changes []string
+}
+
+// OpenWriter opens the local mysqld, refused unless writable,
+// the changes are binlogged so they reach the others
+func (mylet *Mylet) OpenWriter(ctx context.Context) (*sql.DB, error) {
+	dsn := fmt.Sprintf("%s:%s%d@tcp(localhost:%d)/mysql",
+		mylet.Mysql.Spec.LocalUsername, mylet.Mysql.Spec.LocalPassword, mylet.Spec.Id, mylet.Spec.Port)
+	db, err := Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ro := 0
+	err = db.QueryRowContext(ctx, "SELECT @@GLOBAL.read_only;").Scan(&ro)
+	if err == nil && ro != 0 {
+		err = fmt.Errorf("%s is not the writer: read only", mylet.Spec.Name)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// ApplyDatabase creates the schema or alters its defaults, the existing tables keep theirs
+func (mylet *Mylet) ApplyDatabase(r DatabaseRequest) (AccountResult, error) {
+	var result AccountResult
+	if err := v1.ValidateDatabaseName(r.Name); err != nil {
+		return result, err
+	}
+	if !r.Drop && (!v1.IsWord(r.Charset) || !v1.IsWord(r.Collation)) {
+		return result, fmt.Errorf("charset or collation invalid: %s %s", r.Charset, r.Collation)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout1m)
+	defer cancel()
+
+	db, err := mylet.OpenWriter(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer db.Close()
+
+	var charset, collation string
+	err = db.QueryRowContext(ctx, "SELECT DEFAULT_CHARACTER_SET_NAME, DEFAULT_COLLATION_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?;", r.Name).Scan(&charset, &collation)
+	exists := err == nil
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	if err != nil {
+		return result, err
+	}
+
+	var q, change string
+	switch {
+	case r.Drop && exists:
+		q = "DROP DATABASE " + QuoteName(r.Name) + ";"
+		change = "drop database " + r.Name
+	case r.Drop:
+	case !exists:
+		q = fmt.Sprintf("CREATE DATABASE %s DEFAULT CHARACTER SET '%s' COLLATE '%s';", QuoteName(r.Name), r.Charset, r.Collation)
+		change = "create database " + r.Name
+	case !strings.EqualFold(charset, r.Charset) || !strings.EqualFold(collation, r.Collation):
+		q = fmt.Sprintf("ALTER DATABASE %s DEFAULT CHARACTER SET '%s' COLLATE '%s';", QuoteName(r.Name), r.Charset, r.Collation)
+		change = fmt.Sprintf("alter database %s from %s %s", r.Name, charset, collation)
+	}
+	if q == "" {
+		return result, nil
+	}
+
+	log.Info(change)
+	if _, err = db.ExecContext(ctx, q); err != nil {
+		return result, err
+	}
+	result.Changes = append(result.Changes, change)
+	return result, nil
+}
+
+// ApplyUser creates the user or resets what drifted, the password, the connection limit and the grants,
+// the privileges not declared are revoked
+func (mylet *Mylet) ApplyUser(r UserRequest) (AccountResult, error) {
+	var result AccountResult
+	if r.Username == "" || r.Host == "" || v1.HasQuote(r.Username, r.Host) || strings.Contains(r.Username+r.Host, "\\") {
+		return result, fmt.Errorf("username or host invalid: %s@%s", r.Username, r.Host)
+	}
+	switch r.Username {
+	case mylet.Mysql.Spec.LocalUsername, mylet.Mysql.Spec.ReplicaUsername, mylet.Mysql.Spec.ExporterUsername, CloneUsername:
+		return result, fmt.Errorf("username reserved by the operator: %s", r.Username)
+	}
+	for _, g := range r.Grants {
+		if err := g.Validate(); err != nil {
+			return result, err
+		}
+	}
+	if !r.Drop && r.Password == "" {
+		return result, fmt.Errorf("password required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout1m)
+	defer cancel()
+
+	db, err := mylet.OpenWriter(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer db.Close()
+
+	user := fmt.Sprintf("'%s'@'%s'", r.Username, r.Host)
+	exec := func(q, change string) error {
+		log.Info(change)
+		if _, err := db.ExecContext(ctx, q); err != nil {
+			return fmt.Errorf("%s: %w", change, err)
+		}
+		result.Changes = append(result.Changes, change)
+		return nil
+	}
+
+	var plugin, auth string
+	var conns int
+	err = db.QueryRowContext(ctx, "SELECT plugin, authentication_string, max_user_connections FROM mysql.user WHERE user = ? AND host = ?;", r.Username, r.Host).Scan(&plugin, &auth, &conns)
+	exists := err == nil
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	if err != nil {
+		return result, err
+	}
+
+	if r.Drop {
+		if exists {
+			err = exec("DROP USER "+user+";", "drop user "+user)
+		}
+		return result, err
+	}
+
+	password := QuoteString(r.Password)
+	if !exists {
+		q := fmt.Sprintf("CREATE USER %s IDENTIFIED WITH mysql_native_password BY %s WITH MAX_USER_CONNECTIONS %d;", user, password, r.MaxUserConnections)
+		if err = exec(q, "create user "+user); err != nil {
+			return result, err
+		}
+	} else {
+		if plugin != "mysql_native_password" || auth != NativePassword(r.Password) {
+			q := fmt.Sprintf("ALTER USER %s IDENTIFIED WITH mysql_native_password BY %s;", user, password)
+			if err = exec(q, "reset password of "+user); err != nil {
+				return result, err
+			}
+		}
+		if conns != r.MaxUserConnections {
+			q := fmt.Sprintf("ALTER USER %s WITH MAX_USER_CONNECTIONS %d;", user, r.MaxUserConnections)
+			if err = exec(q, fmt.Sprintf("limit connections of %s from %d to %d", user, conns, r.MaxUserConnections)); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	have, err := ShowGrants(ctx, db, user)
+	if err != nil {
+		return result, err
+	}
+	want := WantGrants(r.Grants)
+
+	for _, on := range sortedKeys(have) {
+		var revoke []string
+		for p := range have[on] {
+			if !want[on][p] {
+				revoke = append(revoke, p)
+			}
+		}
+		if len(revoke) == 0 {
+			continue
+		}
+		sort.Strings(revoke)
+		s := strings.Join(revoke, ", ")
+		if err = exec(fmt.Sprintf("REVOKE %s ON %s FROM %s;", s, on, user), fmt.Sprintf("revoke %s on %s from %s", s, on, user)); err != nil {
+			return result, err
+		}
+	}
+
+	for _, on := range sortedKeys(want) {
+		var grant []string
+		option := false
+		missing := false
+		for p := range want[on] {
+			if p == GrantOption {
+				option = true
+			} else {
+				grant = append(grant, p)
+			}
+			if !have[on][p] {
+				missing = true
+			}
+		}
+		if !missing {
+			continue
+		}
+		sort.Strings(grant)
+		s := strings.Join(grant, ", ")
+		q := fmt.Sprintf("GRANT %s ON %s TO %s", s, on, user)
+		change := fmt.Sprintf("grant %s on %s to %s", s, on, user)
+		if option {
+			q += " WITH GRANT OPTION"
+			change += " with grant option"
+		}
+		if err = exec(q+";", change); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// GrantOption is held like a privilege of the object
+const GrantOption = "GRANT OPTION"
+
+// Grants are the privileges by object, `db`.* or `db`.`table` as SHOW GRANTS prints them
+type Grants map[string]map[string]bool
+
+func (g Grants) add(on, p string) {
+	if g[on] == nil {
+		g[on] = make(map[string]bool)
+	}
+	g[on][p] = true
+}
+
+// WantGrants are the privileges declared, ALL absorbs the others
+func WantGrants(a []v1.MysqlGrant) Grants {
+	g := make(Grants)
+	for _, v := range a {
+		on := QuoteName(v.Database) + ".*"
+		if v.Table != "" {
+			on = QuoteName(v.Database) + "." + QuoteName(v.Table)
+		}
+		for _, p := range v.Privileges {
+			g.add(on, NormalizePrivilege(p))
+		}
+		if v.GrantOption {
+			g.add(on, GrantOption)
+		}
+	}
+	for _, m := range g {
+		if m["ALL PRIVILEGES"] {
+			for p := range m {
+				if p != "ALL PRIVILEGES" && p != GrantOption {
+					delete(m, p)
+				}
+			}
+		}
+	}
+	return g
+}
+
+// NormalizePrivilege upper cases and spaces the privilege like SHOW GRANTS
+func NormalizePrivilege(p string) string {
+	p = strings.ToUpper(strings.Join(strings.Fields(p), " "))
+	if p == "ALL" {
+		p = "ALL PRIVILEGES"
+	}
+	return p
+}
+
+// ShowGrants parses the privileges of the user on the global and schema objects,
+// USAGE, proxies, roles and routines are left out
+func ShowGrants(ctx context.Context, db *sql.DB, user string) (Grants, error) {
+	rows, err := db.QueryContext(ctx, "SHOW GRANTS FOR "+user+";")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	g := make(Grants)
+	for rows.Next() {
+		var s string
+		if err = rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(s, "GRANT ") {
+			continue
+		}
+		s = s[len("GRANT "):]
+
+		i := strings.Index(s, " ON ")
+		if i == -1 {
+			// a role granted
+			continue
+		}
+		privileges := s[:i]
+		s = s[i+len(" ON "):]
+
+		i = strings.Index(s, " TO ")
+		if i == -1 {
+			continue
+		}
+		on := s[:i]
+		if on != "*.*" && !strings.HasPrefix(on, "`") {
+			// PROCEDURE or FUNCTION, or a proxy
+			continue
+		}
+
+		for _, p := range splitPrivileges(privileges) {
+			p = NormalizePrivilege(p)
+			if p != "USAGE" && p != "PROXY" {
+				g.add(on, p)
+			}
+		}
+		if strings.HasSuffix(s, " WITH GRANT OPTION") {
+			g.add(on, GrantOption)
+		}
+	}
+	return g, rows.Err()
+}
+
+// splitPrivileges splits at the commas outside the column lists
+func splitPrivileges(s string) []string {
+	var a []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				a = append(a, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(a, strings.TrimSpace(s[start:]))
+}
+
+func sortedKeys(g Grants) []string {
+	a := make([]string, 0, len(g))
+	for k := range g {
+		a = append(a, k)
+	}
+	sort.Strings(a)
+	return a
+}
+
+// NativePassword is the authentication string of mysql_native_password
+func NativePassword(password string) string {
+	h := sha1.Sum([]byte(password))
+	h = sha1.Sum(h[:])
+	return "*" + strings.ToUpper(hex.EncodeToString(h[:]))
+}
+
+// QuoteString quotes the string literal with single quotes
+func QuoteString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -3,7 +3,10 @@ package mylet
 import (
 	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/fs"
 	"io/ioutil"
 	"os"
@@ -15,6 +18,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/erda-project/mysql-operator/pkg/crypt"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -25,8 +29,85 @@ const (
 	BackupFilename = "mylet_backup"
 	DatetimeLayout = "20060102.150405"
 	CompressExt    = ".tar.gz"
+	// The sha256 manifest beside each archive, in the sha256sum format
+	ManifestExt = ".sha256"
 )
 
+type BackupResult struct {
+	BackupTime  string
+	Incremental int
+	Compress    bool
+	// Size in bytes of the backup taken, or of the tarball if compressed
+	Size int64
+	// Where the backup is shipped, empty if no backup storage
+	Location string
+	// Id of the key sealing the backup once off the volume, empty if plain
+	KeyId string
+	// The chain restored in a throwaway mysqld, nil if not asked
+	Verification *VerifyResult
+	// The chains removed by the retention after the backup, and the bytes freed
+	Pruned    []string
+	Reclaimed int64
+}
+
+// DirSize sums the regular file sizes under the path
+func DirSize(path string) (n int64, err error) {
+	err = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			n += fi.Size()
+		}
+		return nil
+	})
+	return
+}
+
+// BackupKey returns the key sealing the backups, nil if plain
+func (mylet *Mylet) BackupKey() (*crypt.Key, error) {
+	be := mylet.Mysql.Spec.BackupEncryption
+	if be == nil {
+		return nil, nil
+	}
+	return crypt.NewKey(be.Key)
+}
+
+// runArchive runs the command with its stdout into the file, sealed if a key is given,
+// returns the sha256 of the file
+func runArchive(cmd *exec.Cmd, name string, k *crypt.Key) (string, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	var w io.WriteCloser = nopWriteCloser{io.MultiWriter(f, h)}
+	if k != nil {
+		w, err = k.NewWriter(w)
+	}
+	if err == nil {
+		cmd.Stdout = w
+		err = cmd.Run()
+		if e := w.Close(); err == nil {
+			err = e
+		}
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return hex.EncodeToString(h.Sum(nil)), err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
 /*
 name.date.time/
 
@@ -203,6 +284,210 @@ func (mylet *Mylet) UnlockBackup() {
 	mylet.Unlock()
 }
 
+// ReadBackup marks the chain, or the binlog archive, by its base name as being read,
+// it is not pruned until the returned function is called
+func (mylet *Mylet) ReadBackup(name string) func() {
+	mylet.Lock()
+	if mylet.reading == nil {
+		mylet.reading = make(map[string]int)
+	}
+	mylet.reading[name]++
+	mylet.Unlock()
+
+	return func() {
+		mylet.Lock()
+		if mylet.reading[name]--; mylet.reading[name] <= 0 {
+			delete(mylet.reading, name)
+		}
+		mylet.Unlock()
+	}
+}
+func (mylet *Mylet) IsReading(name string) bool {
+	mylet.Lock()
+	defer mylet.Unlock()
+	return mylet.reading[name] > 0
+}
+
+// Retention is the limits of the local backups, zero for no limit
+type Retention struct {
+	Keep     int
+	MaxAge   time.Duration
+	MaxBytes int64
+	// The chains to remove by their backup time, instead of the limits above
+	Chains []string
+}
+
+func (r Retention) IsZero() bool {
+	return r.Keep <= 0 && r.MaxAge <= 0 && r.MaxBytes <= 0 && len(r.Chains) == 0
+}
+
+func (r Retention) hasChain(t time.Time) bool {
+	dt := t.Format(DatetimeLayout)
+	for _, s := range r.Chains {
+		if s == dt {
+			return true
+		}
+	}
+	return false
+}
+
+// SpecRetention is the retention of the mysql spec
+func (mylet *Mylet) SpecRetention() Retention {
+	var r Retention
+	if br := mylet.Mysql.Spec.BackupRetention; br != nil {
+		r.Keep = br.KeepChains
+		if br.MaxAge != nil {
+			r.MaxAge = br.MaxAge.Duration
+		}
+		if br.MaxBytes != nil {
+			r.MaxBytes = br.MaxBytes.Value()
+		}
+	}
+	return r
+}
+
+type PruneResult struct {
+	// The chains removed
+	Removed []string
+	// The archived binlogs removed
+	Binlogs []string
+	// Bytes freed on the volume
+	Reclaimed int64
+}
+
+// PruneBackups removes the chains, a full backup with its incrementals and tarball,
+// oldest first while beyond the newest keep ones, older than maxAge
+// or the backup directory larger than maxBytes, or only the chains given.
+// The newest chain and the chains being read are always kept.
+// The archived binlogs closed before the oldest chain kept are removed as well.
+func (mylet *Mylet) PruneBackups(r Retention) (PruneResult, error) {
+	var result PruneResult
+	if r.IsZero() {
+		return result, nil
+	}
+
+	o := mylet.LockBackup("prune backups")
+	if o != "" {
+		return result, fmt.Errorf("backing: %s", o)
+	}
+	defer mylet.UnlockBackup()
+
+	a, err := mylet.GetBackups()
+	if err != nil {
+		return result, err
+	}
+	b, err := mylet.GetCompresses()
+	if err != nil {
+		return result, err
+	}
+	for _, t := range b {
+		i := sort.Search(len(a), func(i int) bool { return !a[i].Before(t) })
+		if i == len(a) || !a[i].Equal(t) {
+			a = append(a, time.Time{})
+			copy(a[i+1:], a[i:])
+			a[i] = t
+		}
+	}
+
+	var total int64
+	if r.MaxBytes > 0 {
+		total, err = DirSize(mylet.BackupDir())
+		if err != nil {
+			return result, err
+		}
+	}
+
+	now := time.Now()
+	var oldest time.Time
+	for i, t := range a {
+		n := len(a) - i // newer chains including this one
+		dir := mylet.GetBackupDir(t)
+		name := filepath.Base(dir)
+		if len(r.Chains) > 0 {
+			if n == 1 || !r.hasChain(t) {
+				if oldest.IsZero() {
+					oldest = t
+				}
+				continue
+			}
+		} else if n == 1 || (r.Keep <= 0 || n <= r.Keep) &&
+			(r.MaxAge <= 0 || now.Sub(t) <= r.MaxAge) &&
+			(r.MaxBytes <= 0 || total <= r.MaxBytes) {
+			if oldest.IsZero() {
+				oldest = t
+			}
+			break
+		}
+		if mylet.IsReading(name) {
+			log.Info("prune backup skipped, being read", mylet.Spec.Name, name)
+			if oldest.IsZero() {
+				oldest = t
+			}
+			continue
+		}
+
+		size, err := DirSize(dir)
+		if os.IsNotExist(err) {
+			size, err = 0, nil
+		}
+		if err == nil {
+			if fi, e := os.Stat(dir + CompressExt); e == nil {
+				size += fi.Size()
+			}
+		}
+
+		log.Info("prune backup", mylet.Spec.Name, name)
+		if err == nil {
+			err = os.RemoveAll(dir)
+		}
+		if err == nil {
+			err = os.Remove(dir + CompressExt)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		}
+		if err == nil {
+			err = os.Remove(dir + CompressExt + ManifestExt)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Removed = append(result.Removed, name)
+		result.Reclaimed += size
+		total -= size
+	}
+
+	if !oldest.IsZero() && !mylet.IsReading(filepath.Base(mylet.BinlogDir())) {
+		binlogs, size, err := mylet.PruneBinlogs(oldest)
+		if len(binlogs) > 0 {
+			log.Info("prune binlogs", mylet.Spec.Name, len(binlogs))
+		}
+		result.Binlogs = binlogs
+		result.Reclaimed += size
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// EnforceRetention prunes the backups by the retention of the mysql spec,
+// after each backup, a failure is logged only as the backup is taken
+func (mylet *Mylet) EnforceRetention() PruneResult {
+	r := mylet.SpecRetention()
+	result, err := mylet.PruneBackups(r)
+	if err != nil {
+		log.Error("enforce retention", mylet.Spec.Name, err)
+	} else if len(result.Removed) > 0 || len(result.Binlogs) > 0 {
+		log.Info("enforce retention", mylet.Spec.Name, result.Removed, "reclaimed", result.Reclaimed)
+	}
+	return result
+}
+
 func (mylet *Mylet) FullBackup() (time.Time, error) {
 	o := mylet.LockBackup("full backup")
 	if o != "" {
@@ -337,6 +622,11 @@ func (mylet *Mylet) CompressBackup(dir string) (string, error) {
 	}
 	defer mylet.UnlockBackup()
 
+	k, err := mylet.BackupKey()
+	if err != nil {
+		return "", err
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), Hour8)
 	defer cancel()
 
@@ -345,22 +635,120 @@ func (mylet *Mylet) CompressBackup(dir string) (string, error) {
 	f := d + CompressExt
 	t := "cxrtmp." + f
 
-	cmd := exec.CommandContext(ctx, "tar", "-czf", t, d)
+	cmd := exec.CommandContext(ctx, "tar", "-czf", "-", d)
 	cmd.Dir = p
-	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
 	f = filepath.Join(p, f)
 	t = filepath.Join(p, t)
 
-	err := cmd.Run()
+	sum, err := runArchive(cmd, t, k)
 	if err == nil {
 		err = os.Rename(t, f)
 	}
+	if err == nil {
+		err = WriteManifest(f, sum)
+	}
 
 	return f, err
 }
 
+// SealArchive seals in place the archive made before the encryption, and its manifest
+func (mylet *Mylet) SealArchive(name string, k *crypt.Key) error {
+	o := mylet.LockBackup("seal backup")
+	if o != "" {
+		return fmt.Errorf("backing: %s", o)
+	}
+	defer mylet.UnlockBackup()
+
+	// sealed by another download meanwhile
+	id, err := crypt.ReadKeyID(name)
+	if err != nil || id != "" {
+		return err
+	}
+
+	r, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	t := filepath.Join(filepath.Dir(name), "cxrtmp."+filepath.Base(name))
+	f, err := os.OpenFile(t, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(t)
+
+	h := sha256.New()
+	w, err := k.NewWriter(io.MultiWriter(f, h))
+	if err == nil {
+		_, err = io.Copy(w, r)
+		if e := w.Close(); err == nil {
+			err = e
+		}
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(t, name)
+	}
+	if err == nil {
+		err = WriteManifest(name, hex.EncodeToString(h.Sum(nil)))
+	}
+	return err
+}
+
+// WriteManifest records the sha256 of the archive beside it
+func WriteManifest(name, sum string) error {
+	t := filepath.Join(filepath.Dir(name), "cxrtmp."+filepath.Base(name)+ManifestExt)
+	err := os.WriteFile(t, []byte(sum+"  "+filepath.Base(name)+"\n"), 0644)
+	if err == nil {
+		err = os.Rename(t, name+ManifestExt)
+	}
+	return err
+}
+
+// ReadManifest returns the sha256 of the archive, computed and recorded if missing
+// or older than the archive
+func ReadManifest(name string) (string, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return "", err
+	}
+	if mi, err := os.Stat(name + ManifestExt); err == nil && !mi.ModTime().Before(fi.ModTime()) {
+		b, err := os.ReadFile(name + ManifestExt)
+		if err != nil {
+			return "", err
+		}
+		if a := strings.Fields(string(b)); len(a) == 2 && a[1] == filepath.Base(name) && len(a[0]) == sha256.Size*2 {
+			return a[0], nil
+		}
+	}
+
+	sum, err := FileSum(name)
+	if err == nil {
+		err = WriteManifest(name, sum)
+	}
+	return sum, err
+}
+
+// FileSum returns the hex sha256 of the file
+func FileSum(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 func (mylet *Mylet) PrepareLastBackup() error {
 	a, err := mylet.GetBackups()
 	if err != nil {
@@ -375,6 +763,11 @@ func (mylet *Mylet) PrepareLastBackup() error {
 }
 
 func (mylet *Mylet) PrepareBackup(id int, dir string) error {
+	return mylet.PrepareBackupUpTo(id, dir, -1)
+}
+
+// PrepareBackupUpTo applies the incrementals up to the index, all if negative
+func (mylet *Mylet) PrepareBackupUpTo(id int, dir string, last int) error {
 	o := mylet.LockBackup("prepare backup")
 	if o != "" {
 		return fmt.Errorf("backing: %s", o)
@@ -385,6 +778,10 @@ func (mylet *Mylet) PrepareBackup(id int, dir string) error {
 	if err != nil {
 		return err
 	}
+	if last >= 0 {
+		i := sort.SearchInts(a, last+1)
+		a = a[:i]
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
 	defer cancel()
@@ -576,7 +973,12 @@ func (mylet *Mylet) adjustBackup(id int, gtid string) error {
 }
 
 func (mylet *Mylet) ReadGtid() (gtid string, err error) {
-	b, err := ioutil.ReadFile(filepath.Join(mylet.DataDir(), "xtrabackup_info"))
+	return ReadBackupGtid(mylet.DataDir())
+}
+
+// ReadBackupGtid reads the GTID of the last change from the xtrabackup_info of the directory
+func ReadBackupGtid(dir string) (gtid string, err error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "xtrabackup_info"))
 	if err != nil {
 		return
 	}
@@ -586,7 +988,7 @@ func (mylet *Mylet) ReadGtid() (gtid string, err error) {
 	i := strings.Index(s, p)
 	if i == -1 {
 		// return "", fmt.Errorf("no gtid prefix")
-		return mylet.Read_binlog_pos()
+		return readBinlogPos(dir)
 	}
 	s = s[i+len(p):]
 	i = strings.IndexByte(s, '\'')
@@ -612,7 +1014,11 @@ func (mylet *Mylet) ReadGtid() (gtid string, err error) {
 
 // TODO: multiline
 func (mylet *Mylet) Read_binlog_pos() (gtid string, err error) {
-	f, err := os.Open(filepath.Join(mylet.DataDir(), "xtrabackup_info"))
+	return readBinlogPos(mylet.DataDir())
+}
+
+func readBinlogPos(dir string) (gtid string, err error) {
+	f, err := os.Open(filepath.Join(dir, "xtrabackup_info"))
 	if err != nil {
 		return
 	}
@@ -0,0 +1,562 @@
+package mylet
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/erda-project/mysql-operator/pkg/crypt"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	BinlogArchiveInterval = time.Minute
+	// The active binlog is rotated once written and older than it,
+	// so the archive lags behind at most that long
+	BinlogFlushInterval = 5 * time.Minute
+)
+
+// Serializes the archive writers, the loop and the downloads
+var archiveMu sync.Mutex
+
+/*
+binlog/
+
+	date.time.name-bin.000001
+	date.time.name-bin.000002
+	...
+
+closed time and the binlog name, the numbers start over after a restore
+*/
+func (mylet *Mylet) BinlogDir() string {
+	return filepath.Join(mylet.BackupDir(), "binlog")
+}
+
+// BinlogIndex returns the binlogs of the datadir, the last one is active
+func (mylet *Mylet) BinlogIndex() ([]string, error) {
+	dir := mylet.DataDir()
+	f, err := os.Open(filepath.Join(dir, mylet.Spec.Name+"-bin.index"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var a []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" {
+			continue
+		}
+		if !filepath.IsAbs(s) {
+			s = filepath.Join(dir, s)
+		}
+		a = append(a, s)
+	}
+	return a, scanner.Err()
+}
+
+// ArchivedBinlog is a closed binlog in the archive
+type ArchivedBinlog struct {
+	Name       string
+	ClosedTime time.Time
+}
+
+// GetArchivedBinlogs lists the archive, oldest first
+func (mylet *Mylet) GetArchivedBinlogs() ([]ArchivedBinlog, error) {
+	entries, err := os.ReadDir(mylet.BinlogDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var a []ArchivedBinlog
+	for _, e := range entries {
+		s := e.Name()
+		if e.IsDir() || len(s) <= len(DatetimeLayout) || s[len(DatetimeLayout)] != '.' {
+			continue
+		}
+		t, err := time.ParseInLocation(DatetimeLayout, s[:len(DatetimeLayout)], time.Local)
+		if err == nil {
+			a = append(a, ArchivedBinlog{s, t})
+		}
+	}
+	sort.Slice(a, func(i, j int) bool {
+		return a[i].Name < a[j].Name
+	})
+	return a, nil
+}
+
+// FlushBinlogs rotates the active binlog, the statement is not written to the binlog
+func (mylet *Mylet) FlushBinlogs() error {
+	dsn := fmt.Sprintf("%s:%s%d@tcp(localhost:%d)/mysql",
+		mylet.Mysql.Spec.LocalUsername, mylet.Mysql.Spec.LocalPassword, mylet.Spec.Id, mylet.Spec.Port)
+	db, err := Open(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout5s)
+	defer cancel()
+
+	_, err = db.ExecContext(ctx, "FLUSH BINARY LOGS;")
+	return err
+}
+
+// ArchiveBinlogs copies the closed binlogs next to the backups, hard linked if possible,
+// then ships them to the backup storage if any
+func (mylet *Mylet) ArchiveBinlogs(flush bool) error {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+
+	if flush {
+		if err := mylet.FlushBinlogs(); err != nil {
+			return err
+		}
+	}
+
+	a, err := mylet.BinlogIndex()
+	if err != nil || len(a) == 0 {
+		return err
+	}
+
+	dir := mylet.BinlogDir()
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	for _, f := range a[:len(a)-1] {
+		fi, err := os.Stat(f)
+		if os.IsNotExist(err) {
+			// purged
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		name := fi.ModTime().Format(DatetimeLayout) + "." + filepath.Base(f)
+		dst := filepath.Join(dir, name)
+		if o, err := os.Stat(dst); err == nil && o.Size() == fi.Size() {
+			continue
+		}
+
+		tmp := filepath.Join(dir, "cxrtmp."+name)
+		os.Remove(tmp)
+		if err = os.Link(f, tmp); err != nil {
+			err = copyFile(f, tmp, fi)
+		}
+		if err == nil {
+			err = os.Rename(tmp, dst)
+		}
+		if err != nil {
+			return err
+		}
+		log.Info("archive binlog", name)
+	}
+
+	return mylet.UploadBinlogs()
+}
+
+func copyFile(src, dst string, fi os.FileInfo) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	if e := w.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Chtimes(dst, fi.ModTime(), fi.ModTime())
+	}
+	return err
+}
+
+func (mylet *Mylet) RemoteBinlogPrefix() string {
+	return mylet.RemotePrefix() + "binlog/"
+}
+
+// UploadBinlogs ships the archived binlogs missing in the backup storage, sealed if encrypted
+func (mylet *Mylet) UploadBinlogs() error {
+	c, err := mylet.Storage()
+	if c == nil || err != nil {
+		return err
+	}
+	k, err := mylet.BackupKey()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), Hour8)
+	defer cancel()
+
+	prefix := mylet.RemoteBinlogPrefix()
+	objects, err := c.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	m := make(map[string]int64, len(objects))
+	for _, o := range objects {
+		m[strings.TrimPrefix(o.Key, prefix)] = o.Size
+	}
+
+	a, err := mylet.GetArchivedBinlogs()
+	if err != nil {
+		return err
+	}
+	for _, b := range a {
+		f := filepath.Join(mylet.BinlogDir(), b.Name)
+		fi, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+		want := fi.Size()
+		if k != nil {
+			want = crypt.SealedSize(want)
+		}
+		if size, ok := m[b.Name]; ok && size == want {
+			continue
+		}
+
+		err = func() error {
+			file, err := os.Open(f)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			var r io.Reader = file
+			if k != nil {
+				sr := k.SealReader(file)
+				defer sr.Close()
+				r = sr
+			}
+			_, err = c.Upload(ctx, prefix+b.Name, r)
+			return err
+		}()
+		if err != nil {
+			return err
+		}
+		log.Info("upload binlog", b.Name)
+	}
+	return nil
+}
+
+// FetchRemoteBinlogs brings back the binlogs closed since the time missing in the archive,
+// a lost volume keeps them in the backup storage
+func (mylet *Mylet) FetchRemoteBinlogs(since time.Time) error {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+
+	c, err := mylet.Storage()
+	if c == nil || err != nil {
+		return err
+	}
+	k, err := mylet.BackupKey()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), Hour8)
+	defer cancel()
+
+	prefix := mylet.RemoteBinlogPrefix()
+	objects, err := c.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	dir := mylet.BinlogDir()
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	for _, o := range objects {
+		name := strings.TrimPrefix(o.Key, prefix)
+		if len(name) <= len(DatetimeLayout) || strings.Contains(name, "/") {
+			continue
+		}
+		t, err := time.ParseInLocation(DatetimeLayout, name[:len(DatetimeLayout)], time.Local)
+		if err != nil || t.Before(since) {
+			continue
+		}
+		dst := filepath.Join(dir, name)
+		if fi, err := os.Stat(dst); err == nil && (fi.Size() == o.Size || crypt.SealedSize(fi.Size()) == o.Size) {
+			continue
+		}
+
+		err = func() error {
+			body, err := c.Get(ctx, o.Key)
+			if err != nil {
+				return err
+			}
+			defer body.Close()
+			r, _, err := crypt.Open(body, k)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+
+			tmp := filepath.Join(dir, "cxrtmp."+name)
+			w, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(w, r)
+			if e := w.Close(); err == nil {
+				err = e
+			}
+			if err == nil {
+				err = os.Rename(tmp, dst)
+			}
+			return err
+		}()
+		if err != nil {
+			return err
+		}
+		log.Info("fetch remote binlog", name)
+	}
+	return nil
+}
+
+// PruneBinlogs removes the archived binlogs closed before the oldest backup kept,
+// they are of no use without a backup, returns the removed ones and their bytes
+func (mylet *Mylet) PruneBinlogs(before time.Time) ([]string, int64, error) {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+
+	a, err := mylet.GetArchivedBinlogs()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var removed []string
+	var size int64
+	for _, b := range a {
+		if !b.ClosedTime.Before(before) {
+			break
+		}
+		f := filepath.Join(mylet.BinlogDir(), b.Name)
+		fi, err := os.Stat(f)
+		if err == nil {
+			err = os.Remove(f)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return removed, size, err
+		}
+		if fi != nil {
+			size += fi.Size()
+		}
+		removed = append(removed, b.Name)
+	}
+	return removed, size, nil
+}
+
+// ArchiveBinlogsLoop archives the binlogs while mysqld is ready,
+// the active binlog is rotated once written and older than the flush interval
+func (mylet *Mylet) ArchiveBinlogsLoop() {
+	ticker := time.NewTicker(BinlogArchiveInterval)
+	defer ticker.Stop()
+
+	var flushed time.Time
+	for range ticker.C {
+		if !mylet.ReadinessProbe {
+			continue
+		}
+
+		flush := false
+		if time.Since(flushed) >= BinlogFlushInterval {
+			a, err := mylet.BinlogIndex()
+			if err == nil && len(a) > 0 {
+				fi, err := os.Stat(a[len(a)-1])
+				flush = err == nil && fi.ModTime().After(flushed)
+			}
+		}
+
+		if err := mylet.ArchiveBinlogs(flush); err != nil {
+			log.Errorf("[Binlog] archive: %v", err)
+			continue
+		}
+		if flush {
+			flushed = time.Now()
+		}
+	}
+}
+
+// BinlogStopPosition finds where the GTID event starts in the binlog, -1 if not found
+func BinlogStopPosition(ctx context.Context, f, gtid string) (int64, error) {
+	cmd := exec.CommandContext(ctx, "mysqlbinlog", f)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return -1, err
+	}
+	if err = cmd.Start(); err != nil {
+		return -1, err
+	}
+	defer cmd.Wait()
+	defer stdout.Close()
+
+	target := "GTID_NEXT= '" + strings.ToLower(gtid) + "'"
+	at := int64(-1)
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64<<10), 64<<20)
+	for scanner.Scan() {
+		s := scanner.Text()
+		if strings.HasPrefix(s, "# at ") {
+			at, _ = strconv.ParseInt(s[len("# at "):], 10, 64)
+		} else if strings.Contains(strings.ToLower(s), target) {
+			return at, nil
+		}
+	}
+	return -1, scanner.Err()
+}
+
+// ReplayBinlogs applies the binlogs of the directory on top of the restored data,
+// the transactions of the backup are skipped, the replay stops before the time or the GTID
+func (mylet *Mylet) ReplayBinlogs(dir string, stopTime *time.Time, stopGtid string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	// by closed time
+	sort.Strings(files)
+	if len(files) == 0 {
+		log.Warn("[Restore] no binlogs to replay")
+		return nil
+	}
+
+	gtid, err := mylet.ReadGtid()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), Hour8)
+	defer cancel()
+
+	var args []string
+	if gtid != "" {
+		args = append(args, "--exclude-gtids="+gtid)
+	}
+	if stopTime != nil {
+		args = append(args, "--stop-datetime="+stopTime.Local().Format("2006-01-02 15:04:05"))
+	}
+	if stopGtid != "" {
+		found := false
+		for i, f := range files {
+			pos, err := BinlogStopPosition(ctx, f, stopGtid)
+			if err != nil {
+				return err
+			}
+			if pos >= 0 {
+				// applies to the last file
+				files = files[:i+1]
+				args = append(args, "--stop-position="+strconv.FormatInt(pos, 10))
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("gtid %s not found in the binlogs", stopGtid)
+		}
+	}
+	args = append(args, files...)
+
+	socket := mylet.Socket()
+	cmd := mylet.Mysqld(ctx,
+		"--skip-networking",
+		"--super_read_only=OFF",
+		"--read_only=OFF",
+	)
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	defer func() {
+		err := cmd.Process.Signal(syscall.SIGTERM)
+		if err != nil {
+			log.Error("stop local mysqld", err)
+		}
+		err = cmd.Wait()
+		if err != nil {
+			log.Error("wait local mysqld", err)
+		}
+	}()
+
+	dsn := fmt.Sprintf("%s:%s%d@unix(%s)/mysql", mylet.Mysql.Spec.LocalUsername, mylet.Mysql.Spec.LocalPassword, mylet.Spec.Id, socket)
+	db, err := Open(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for i := 1; i <= 10; i++ {
+		log.Info("ping local mysqld sleep 5 seconds", i)
+		time.Sleep(Timeout5s)
+
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout5s)
+		err = db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Infof("[Restore] replay %d binlogs %v", len(files), args[:len(args)-len(files)])
+
+	binlog := exec.CommandContext(ctx, "mysqlbinlog", args...)
+	binlog.Stderr = os.Stderr
+	stdout, err := binlog.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	client := exec.CommandContext(ctx, "mysql",
+		"--socket="+socket,
+		"--user="+mylet.Mysql.Spec.LocalUsername,
+		"--password="+mylet.Mysql.Spec.LocalPassword+strconv.Itoa(mylet.Spec.Id),
+		"--binary-mode",
+	)
+	client.Stdin = stdout
+	client.Stdout = os.Stdout
+	client.Stderr = os.Stderr
+
+	if err = binlog.Start(); err != nil {
+		return err
+	}
+	if err = client.Run(); err != nil {
+		binlog.Process.Kill()
+		binlog.Wait()
+		return err
+	}
+	return binlog.Wait()
+}
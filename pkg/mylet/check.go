@@ -2,6 +2,7 @@ package mylet
 
 import (
 	"context"
+	"database/sql"
 	"net"
 	"strconv"
 	"sync"
@@ -21,6 +22,42 @@ func (mylet *Mylet) SelfCheck() error {
 	return nil
 }
 
+// ReplicaLag returns the seconds behind the source, -1 if replication is not running
+func ReplicaLag(ctx context.Context, q Querier) (int, error) {
+	rows, err := q.QueryContext(ctx, "SHOW SLAVE STATUS;")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	lag := -1
+	if rows.Next() {
+		values := make([]sql.RawBytes, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return 0, err
+		}
+		for i, c := range columns {
+			if c == "Seconds_Behind_Master" && values[i] != nil {
+				lag, err = strconv.Atoi(string(values[i]))
+				if err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+
+	return lag, rows.Err()
+}
+
 // TODO more check
 func DailCheck(ctx context.Context, addr string) error {
 	var d net.Dialer
@@ -0,0 +1,377 @@
+package mylet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	v1 "github.com/erda-project/mysql-operator/api/v1"
+	"github.com/go-sql-driver/mysql"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// The user a recipient clones with, on the donor only, its password is the replica one
+	CloneUsername = v1.CloneUsername
+
+	// ER_CLONE_RESTART, the clone is done but mysqld is not supervised to restart itself
+	errCloneRestart = 3707
+)
+
+// ErrCloneUnsupported is a donor not preparing clones, an older mylet
+var ErrCloneUnsupported = errors.New("clone unsupported")
+
+// CloneSeeding tells whether an empty datadir is seeded by the clone plugin
+func (mylet *Mylet) CloneSeeding() bool {
+	if mylet.Mysql.Spec.SeedStrategy != v1.SeedStrategyClone {
+		return false
+	}
+	if mylet.Mysql.Status.Version.LT(8, 0, 17) {
+		log.Info("clone requires mysql 8.0.17, seeding with xtrabackup", mylet.Mysql.Spec.Version)
+		return false
+	}
+	return true
+}
+
+// PrepareDonor installs the clone plugin and grants the clone user, kept out of the binlog,
+// the read only of a replica is restored after, ErrCloneUnsupported before mysql 8.0.17
+func (mylet *Mylet) PrepareDonor() error {
+	if mylet.Mysql.Status.Version.LT(8, 0, 17) {
+		return ErrCloneUnsupported
+	}
+
+	dsn := fmt.Sprintf("%s:%s%d@tcp(localhost:%d)/mysql",
+		mylet.Mysql.Spec.LocalUsername, mylet.Mysql.Spec.LocalPassword, mylet.Spec.Id, mylet.Spec.Port)
+	db, err := Open(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout5s)
+	defer cancel()
+
+	var sro, ro, n int
+	err = db.QueryRowContext(ctx, "SELECT @@GLOBAL.super_read_only, @@GLOBAL.read_only, "+
+		"(SELECT COUNT(*) FROM information_schema.PLUGINS WHERE PLUGIN_NAME = 'clone' AND PLUGIN_STATUS = 'ACTIVE');").Scan(&sro, &ro, &n)
+	if err != nil {
+		return err
+	}
+
+	query := []string{
+		"SET SESSION sql_log_bin = OFF;",
+		"SET GLOBAL read_only = OFF;",
+		"SET GLOBAL super_read_only = OFF;",
+	}
+
+	if n == 0 {
+		query = append(query, "INSTALL PLUGIN clone SONAME 'mysql_clone.so';")
+	}
+
+	q := fmt.Sprintf("CREATE USER IF NOT EXISTS '%s'@'%%' IDENTIFIED WITH mysql_native_password BY '%s%d';", CloneUsername, mylet.Mysql.Spec.ReplicaPassword, mylet.Spec.Id)
+	query = append(query, q)
+
+	q = fmt.Sprintf("ALTER USER '%s'@'%%' IDENTIFIED BY '%s%d';", CloneUsername, mylet.Mysql.Spec.ReplicaPassword, mylet.Spec.Id)
+	query = append(query, q)
+
+	q = fmt.Sprintf("GRANT BACKUP_ADMIN, CLONE_ADMIN ON *.* TO '%s'@'%%';", CloneUsername)
+	query = append(query, q)
+
+	query = append(query,
+		"FLUSH PRIVILEGES;",
+
+		"SET GLOBAL super_read_only = "+OnOff(sro)+";",
+		"SET GLOBAL read_only = "+OnOff(ro)+";",
+		"SET SESSION sql_log_bin = ON;",
+	)
+
+	_, err = db.ExecContext(ctx, strings.Join(query, "\n"))
+	return err
+}
+
+func OnOff(i int) string {
+	if i == 0 {
+		return "OFF"
+	}
+	return "ON"
+}
+
+// RequestDonor asks the mylet of the donor to prepare the clone
+func RequestDonor(ctx context.Context, u, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, Timeout1m)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Token", token)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return ErrCloneUnsupported
+	}
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code %d, body: %s", res.StatusCode, string(b))
+	}
+
+	var v struct {
+		Error interface{}
+	}
+
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+
+	if v.Error != nil {
+		return fmt.Errorf("return error: %s", v.Error)
+	}
+	return nil
+}
+
+// CloneFrom seeds the empty datadir with CLONE INSTANCE from the solo,
+// ErrCloneUnsupported is returned before the datadir is touched,
+// a failed clone leaves the datadir empty to seed again
+func (mylet *Mylet) CloneFrom(id int) (err error) {
+	s := mylet.Mysql.Status.Solos[id]
+
+	u := url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(s.Spec.Host, strconv.Itoa(s.Spec.MyletPort)),
+		Path:   "/api/addons/mylet/clone/donor",
+	}
+	err = RequestDonor(context.Background(), u.String(), SoloToken(mylet.Mysql, mylet.Spec.Name))
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			if e := os.RemoveAll(mylet.DataDir()); e != nil {
+				log.Error("remove cloned datadir", e)
+			}
+		}
+	}()
+
+	// the recipient needs a running mysqld to clone into
+	dir := mylet.DataDir()
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout1m)
+	defer cancel()
+
+	cmd := mylet.Mysqld(ctx, "--initialize-insecure")
+	if err = cmd.Run(); err != nil {
+		return err
+	}
+
+	if err = mylet.RenameRoot(); err != nil {
+		return err
+	}
+	if err = mylet.ChangeLocalPassword(); err != nil {
+		return err
+	}
+
+	log.Info("clone instance from", s.Spec.Host)
+	if err = mylet.CloneInstance(id); err != nil {
+		return err
+	}
+	log.Info("cloned instance from", s.Spec.Host)
+
+	return mylet.AdjustClone(id)
+}
+
+// CloneInstance runs CLONE INSTANCE on a local mysqld, which replaces the datadir and stops
+func (mylet *Mylet) CloneInstance(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), Hour8)
+	defer cancel()
+
+	socket := mylet.Socket()
+	// the clone connects out to the donor, no one connects in
+	cmd := mylet.Mysqld(ctx,
+		"--skip-networking",
+	)
+
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	exited := false
+	defer func() {
+		if exited {
+			return
+		}
+		err := cmd.Process.Signal(syscall.SIGTERM)
+		if err != nil {
+			log.Error("stop local mysqld", err)
+		}
+		err = cmd.Wait()
+		if err != nil {
+			log.Error("wait local mysqld", err)
+		}
+	}()
+
+	dsn := fmt.Sprintf("%s:%s%d@unix(%s)/mysql", mylet.Mysql.Spec.LocalUsername, mylet.Mysql.Spec.LocalPassword, mylet.Spec.Id, socket)
+	db, err := Open(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	donor := fmt.Sprintf("%s:%d", mylet.Mysql.SoloShortHost(id), mylet.Mysql.Spec.Port)
+	query := []string{
+		"SET SESSION sql_log_bin = OFF;",
+		"SET GLOBAL read_only = OFF;",
+		"SET GLOBAL super_read_only = OFF;",
+
+		"INSTALL PLUGIN clone SONAME 'mysql_clone.so';",
+		fmt.Sprintf("SET GLOBAL clone_valid_donor_list = '%s';", donor),
+	}
+
+	// a failed clone is seeded again, not fatal
+	pinged := false
+	for i := 1; i <= 10 && !pinged; i++ {
+		log.Info("ping local mysqld sleep 5 seconds", i)
+		time.Sleep(Timeout5s)
+
+		func() {
+			ctx, cancel := context.WithTimeout(ctx, Timeout5s)
+			defer cancel()
+
+			err = db.PingContext(ctx)
+			if err != nil {
+				return
+			}
+			pinged = true
+
+			_, err = db.ExecContext(ctx, strings.Join(query, "\n"))
+		}()
+	}
+	if err != nil {
+		return fmt.Errorf("install clone plugin: %w", err)
+	}
+
+	q := fmt.Sprintf("CLONE INSTANCE FROM '%s'@'%s':%d IDENTIFIED BY '%s%d';",
+		CloneUsername, mylet.Mysql.SoloShortHost(id), mylet.Mysql.Spec.Port, mylet.Mysql.Spec.ReplicaPassword, id)
+	_, err = db.ExecContext(ctx, q)
+	var me *mysql.MySQLError
+	if err != nil && !(errors.As(err, &me) && me.Number == errCloneRestart) {
+		return fmt.Errorf("clone instance: %w", err)
+	}
+
+	// not supervised, mysqld stops once cloned
+	exited = true
+	err = cmd.Wait()
+	if err != nil {
+		log.Error("wait cloned mysqld", err)
+	}
+	return nil
+}
+
+// AdjustClone changes the passwords of the users cloned from the solo to the ones of this solo
+func (mylet *Mylet) AdjustClone(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout1m)
+	defer cancel()
+
+	socket := mylet.Socket()
+	cmd := mylet.Mysqld(ctx,
+		"--skip-networking",
+		// "--socket="+socket,
+	)
+
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := cmd.Process.Signal(syscall.SIGTERM)
+		if err != nil {
+			log.Error("stop local mysqld", err)
+		}
+		err = cmd.Wait()
+		if err != nil {
+			log.Error("wait local mysqld", err)
+		}
+	}()
+
+	dsn := fmt.Sprintf("%s:%s%d@unix(%s)/mysql", mylet.Mysql.Spec.LocalUsername, mylet.Mysql.Spec.LocalPassword, id, socket)
+	db, err := Open(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	query := []string{
+		"SET SESSION sql_log_bin = OFF;",
+		"SET GLOBAL read_only = OFF;",
+		"SET GLOBAL super_read_only = OFF;",
+	}
+
+	q := fmt.Sprintf("ALTER USER '%s'@'%%' IDENTIFIED BY '%s%d';", mylet.Mysql.Spec.ReplicaUsername, mylet.Mysql.Spec.ReplicaPassword, mylet.Spec.Id)
+	query = append(query, q)
+
+	q = fmt.Sprintf("ALTER USER '%s'@'%%' IDENTIFIED BY '%s%d';", CloneUsername, mylet.Mysql.Spec.ReplicaPassword, mylet.Spec.Id)
+	query = append(query, q)
+
+	q = fmt.Sprintf("ALTER USER '%s'@'localhost' IDENTIFIED BY '%s%d';", mylet.Mysql.Spec.LocalUsername, mylet.Mysql.Spec.LocalPassword, mylet.Spec.Id)
+	query = append(query, q)
+
+	query = append(query,
+		"FLUSH PRIVILEGES;",
+
+		"SET GLOBAL super_read_only = ON;",
+		"SET GLOBAL read_only = ON;",
+		"SET SESSION sql_log_bin = ON;",
+	)
+
+	// a failed clone is seeded again, not fatal
+	pinged := false
+	for i := 1; i <= 10 && !pinged; i++ {
+		log.Info("ping local mysqld sleep 5 seconds", i)
+		time.Sleep(Timeout5s)
+
+		func() {
+			ctx, cancel := context.WithTimeout(ctx, Timeout5s)
+			defer cancel()
+
+			err = db.PingContext(ctx)
+			if err != nil {
+				return
+			}
+			pinged = true
+
+			_, err = db.ExecContext(ctx, strings.Join(query, "\n"))
+		}()
+	}
+	if err != nil {
+		return fmt.Errorf("adjust clone: %w", err)
+	}
+	return nil
+}
@@ -1,10 +1,19 @@
 package mylet
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"text/template"
 	"time"
+
+	v1 "github.com/erda-project/mysql-operator/api/v1"
+	log "github.com/sirupsen/logrus"
 )
 
 func (mylet *Mylet) BackupFile(src string) error {
@@ -46,8 +55,159 @@ func (mylet *Mylet) Configure() error {
 	if err == nil {
 		err = t.Execute(f, mylet)
 	}
+	if err != nil {
+		return err
+	}
+
+	err = mylet.WriteMysqlConfig(MergeMysqlConfig(mylet.Mysql.Spec.MysqlConfig))
+	if err != nil {
+		return err
+	}
+	mylet.ConfigHash = v1.HashConfig(mylet.Mysql.Spec.MysqlConfig)
 
-	return err
+	return nil
+}
+
+const MysqlConfigFile = "mysql-config.cnf"
+
+// MergeMysqlConfig merges the spec config over the defaults, names are normalized
+func MergeMysqlConfig(m map[string]string) map[string]string {
+	a := make(map[string]string, len(DefaultMysqlConfig)+len(m))
+	for k, v := range DefaultMysqlConfig {
+		a[k] = v
+	}
+	for k, v := range m {
+		a[v1.NormalizeVariable(k)] = v
+	}
+	return a
+}
+
+func (mylet *Mylet) WriteMysqlConfig(m map[string]string) error {
+	dir := filepath.Join(mylet.Spec.Mydir, "my.cnf.d")
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("# generated by mylet from spec.mysqlConfig, do not edit\n[mysqld]\n")
+	for _, k := range keys {
+		b.WriteString(k + " = " + m[k] + "\n")
+	}
+
+	return os.WriteFile(filepath.Join(dir, MysqlConfigFile), []byte(b.String()), 0644)
+}
+
+// ReloadConfig fetches the config from myctl, rewrites the file and applies the dynamic variables,
+// the others take effect after the restart coordinated by myctl
+func (mylet *Mylet) ReloadConfig() error {
+	m, err := Fetch(mylet.Mysql.Spec.MyctlAddr, mylet.Spec.Name, GroupToken(mylet.Mysql))
+	if err != nil {
+		return err
+	}
+	config := m.Mysql.Spec.MysqlConfig
+	hash := v1.HashConfig(config)
+
+	older := MergeMysqlConfig(mylet.Mysql.Spec.MysqlConfig)
+	newer := MergeMysqlConfig(config)
+
+	if err = mylet.WriteMysqlConfig(newer); err != nil {
+		return err
+	}
+
+	restart := false
+	set := make(map[string]string, len(newer))
+	for k, v := range newer {
+		if older[k] == v {
+			continue
+		}
+		if v1.IsDynamicVariable(k) {
+			set[k] = v
+		} else {
+			restart = true
+		}
+	}
+	for k := range older {
+		if _, ok := newer[k]; ok {
+			continue
+		}
+		if v1.IsDynamicVariable(k) {
+			set[k] = "DEFAULT"
+		} else {
+			restart = true
+		}
+	}
+
+	if err = mylet.SetGlobal(set); err != nil {
+		return err
+	}
+
+	mylet.fetchedConfigHash = hash
+	mylet.Mysql.Spec.MysqlConfig = config
+	if restart {
+		log.Infof("[ReloadConfig] %s waiting for restart", hash)
+	} else {
+		mylet.ConfigHash = hash
+		log.Infof("[ReloadConfig] %s applied", hash)
+	}
+	return nil
+}
+
+func (mylet *Mylet) SetGlobal(m map[string]string) error {
+	if len(m) == 0 {
+		return nil
+	}
+
+	dsn := fmt.Sprintf("%s:%s%d@tcp(localhost:%d)/mysql",
+		mylet.Mysql.Spec.LocalUsername, mylet.Mysql.Spec.LocalPassword, mylet.Spec.Id, mylet.Spec.Port)
+	db, err := Open(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout1m)
+	defer cancel()
+
+	for k, v := range m {
+		q := "SET GLOBAL " + k + " = " + SqlValue(v) + ";"
+		if _, err = db.ExecContext(ctx, q); err != nil {
+			return fmt.Errorf("%s: %w", q, err)
+		}
+		log.Infof("[SetGlobal] %s", q)
+	}
+	return nil
+}
+
+var numberRegexp = regexp.MustCompile(`^([0-9]+)([KkMmGg]?)$`)
+
+// SqlValue converts a my.cnf value into a SET GLOBAL value
+func SqlValue(v string) string {
+	if a := numberRegexp.FindStringSubmatch(v); a != nil {
+		i, err := strconv.ParseInt(a[1], 10, 64)
+		if err == nil {
+			switch strings.ToUpper(a[2]) {
+			case "K":
+				i <<= 10
+			case "M":
+				i <<= 20
+			case "G":
+				i <<= 30
+			}
+			return strconv.FormatInt(i, 10)
+		}
+	}
+	switch strings.ToUpper(v) {
+	case "DEFAULT", "ON", "OFF", "TRUE", "FALSE":
+		return v
+	}
+	return "'" + v + "'"
 }
 
 // TODO
@@ -0,0 +1,255 @@
+package mylet
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	v1 "github.com/erda-project/mysql-operator/api/v1"
+	log "github.com/sirupsen/logrus"
+)
+
+// Conversion actions requested by myctl, each one is idempotent
+const (
+	// Check the group replication requirements
+	ConvertCheck = "check"
+	// Stop the async channel, enable group replication, then bootstrap or join
+	ConvertMember = "member"
+	// Leave the group if any, then set up as the async primary or replica
+	ConvertAsync = "async"
+)
+
+type ConvertRequest struct {
+	Action    string
+	Bootstrap bool
+}
+
+// Refetch replaces the local mysql with the one served by myctl,
+// the topology of the solo may change
+func (mylet *Mylet) Refetch() error {
+	m, err := Fetch(mylet.Mysql.Spec.MyctlAddr, mylet.Spec.Name, GroupToken(mylet.Mysql))
+	if err != nil {
+		return err
+	}
+	mylet.Mysql = m.Mysql
+	mylet.MysqlSolo = m.MysqlSolo
+	mylet.Spec = m.Spec
+	return nil
+}
+
+// Convert runs a conversion action, the outcome is observed by myctl from the reports
+func (mylet *Mylet) Convert(r ConvertRequest) (err error) {
+	mylet.Lock()
+	o := mylet.Converting
+	if o == "" {
+		mylet.Converting = r.Action
+		mylet.ConvertError = ""
+	}
+	mylet.Unlock()
+	if o != "" {
+		return fmt.Errorf("converting: %s", o)
+	}
+
+	defer func() {
+		mylet.Lock()
+		mylet.Converting = ""
+		mylet.ConvertError = ""
+		if err != nil {
+			mylet.ConvertError = r.Action + ": " + err.Error()
+		}
+		mylet.Unlock()
+	}()
+
+	log.Infof("[Convert] %s %s, bootstrap %v", mylet.Spec.Name, r.Action, r.Bootstrap)
+
+	switch r.Action {
+	case ConvertCheck:
+		return mylet.CheckGroupReplication()
+	case ConvertMember:
+		if err = mylet.Refetch(); err != nil {
+			return err
+		}
+		if !mylet.IsMember() {
+			return fmt.Errorf("%s is not a member", mylet.Spec.Name)
+		}
+		if err = mylet.StopAsync(); err != nil {
+			return err
+		}
+		if err = mylet.EnableGroupReplication(); err != nil {
+			return err
+		}
+		if err = mylet.SetupMember(); err != nil {
+			return err
+		}
+		if err = mylet.Configure(); err != nil {
+			return err
+		}
+		action := GroupActionJoin
+		if r.Bootstrap {
+			action = GroupActionBootstrap
+		}
+		return mylet.GroupAction(action)
+	case ConvertAsync:
+		if err = mylet.Refetch(); err != nil {
+			return err
+		}
+		if mylet.IsMember() {
+			return fmt.Errorf("%s is a member", mylet.Spec.Name)
+		}
+		if err = mylet.StopGroupReplication(); err != nil {
+			return err
+		}
+		if err = mylet.Configure(); err != nil {
+			return err
+		}
+		if mylet.IsPrimary() {
+			return mylet.SetupPrimary()
+		}
+		if err = mylet.StopReplica(); err != nil {
+			return err
+		}
+		return mylet.SetupReplica()
+	default:
+		return fmt.Errorf("convert action invalid: %s", r.Action)
+	}
+}
+
+// CheckGroupReplication checks the tables are all innodb with a primary key
+func (mylet *Mylet) CheckGroupReplication() error {
+	db, err := mylet.localDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout1m)
+	defer cancel()
+
+	query := "SELECT CONCAT(t.TABLE_SCHEMA, '.', t.TABLE_NAME) FROM information_schema.TABLES t" +
+		" LEFT JOIN information_schema.TABLE_CONSTRAINTS c ON c.TABLE_SCHEMA = t.TABLE_SCHEMA AND c.TABLE_NAME = t.TABLE_NAME AND c.CONSTRAINT_TYPE = 'PRIMARY KEY'" +
+		" WHERE t.TABLE_TYPE = 'BASE TABLE' AND t.TABLE_SCHEMA NOT IN ('mysql', 'sys', 'information_schema', 'performance_schema')" +
+		" AND (t.ENGINE <> 'InnoDB' OR c.CONSTRAINT_NAME IS NULL) LIMIT 10;"
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var a []string
+	for rows.Next() {
+		var s string
+		if err = rows.Scan(&s); err != nil {
+			return err
+		}
+		a = append(a, s)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if len(a) > 0 {
+		return fmt.Errorf("tables must be innodb with a primary key: %s", strings.Join(a, ", "))
+	}
+	return nil
+}
+
+// StopAsync stops the async channel and forgets its source
+func (mylet *Mylet) StopAsync() error {
+	db, err := mylet.localDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout1m)
+	defer cancel()
+
+	query := []string{
+		"STOP REPLICA;",
+		"RESET REPLICA ALL;",
+	}
+	if mylet.Mysql.Status.Version.Major == 5 {
+		query = []string{
+			"STOP SLAVE;",
+			"RESET SLAVE ALL;",
+		}
+	}
+
+	_, err = db.ExecContext(ctx, strings.Join(query, "\n"))
+	return err
+}
+
+// EnableGroupReplication installs the plugin and sets the variables my.cnf would set,
+// the group is not started
+func (mylet *Mylet) EnableGroupReplication() error {
+	db, err := mylet.localDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout1m)
+	defer cancel()
+
+	var status string
+	err = db.QueryRowContext(ctx, "SELECT PLUGIN_STATUS FROM information_schema.PLUGINS WHERE PLUGIN_NAME = 'group_replication';").Scan(&status)
+	if err == sql.ErrNoRows {
+		if _, err = db.ExecContext(ctx, "INSTALL PLUGIN group_replication SONAME 'group_replication.so';"); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	var query []string
+	if mylet.Mysql.Status.Version.Major == 5 {
+		query = append(query,
+			"SET GLOBAL binlog_checksum = NONE;",
+			"SET GLOBAL transaction_write_set_extraction = 'XXHASH64';",
+			"SET GLOBAL master_info_repository = 'TABLE';",
+		)
+	}
+
+	singlePrimary, updateEverywhere := "ON", "OFF"
+	if mylet.Mysql.Spec.PrimaryMode == v1.ModeMulti {
+		singlePrimary, updateEverywhere = "OFF", "ON"
+	}
+	query = append(query,
+		fmt.Sprintf("SET GLOBAL group_replication_group_name = '%s';", mylet.Mysql.Spec.GroupName),
+		"SET GLOBAL group_replication_start_on_boot = OFF;",
+		fmt.Sprintf("SET GLOBAL group_replication_local_address = '%s';", mylet.MysqlSolo.GroupReplicationLocalAddress()),
+		fmt.Sprintf("SET GLOBAL group_replication_group_seeds = '%s';", mylet.Mysql.GroupReplicationGroupSeeds()),
+		"SET GLOBAL group_replication_bootstrap_group = OFF;",
+		"SET GLOBAL group_replication_single_primary_mode = "+singlePrimary+";",
+		"SET GLOBAL group_replication_enforce_update_everywhere_checks = "+updateEverywhere+";",
+	)
+
+	_, err = db.ExecContext(ctx, strings.Join(query, "\n"))
+	return err
+}
+
+// StopGroupReplication leaves the group if the plugin is running
+func (mylet *Mylet) StopGroupReplication() error {
+	m, err := mylet.CollectGroupMember()
+	if err != nil {
+		return err
+	}
+	if m.State == MemberOffline {
+		return nil
+	}
+
+	db, err := mylet.localDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout1m)
+	defer cancel()
+
+	log.Infof("[Convert] %s leave the group, state %s", mylet.Spec.Name, m.State)
+	_, err = db.ExecContext(ctx, "STOP GROUP_REPLICATION;")
+	return err
+}
@@ -0,0 +1,187 @@
+package mylet
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// The sha256 of the archive served, sha-256=base64
+	DigestHeader = "Digest"
+
+	// Attempts of a download, each one resumes where the last stopped
+	DownloadRetries = 10
+
+	// The validator of the partial archive, so a restart resumes the same one
+	ValidatorExt = ".validator"
+)
+
+// errRetry is an interrupted download to resume
+type errRetry struct {
+	error
+}
+
+// DownloadArchive downloads the archive into the file, resumed with ranges where it stopped,
+// even across restarts, then checked against the sha256 the server tells if any
+func DownloadArchive(ctx context.Context, u, token, name string) error {
+	var err error
+	for i := 1; i <= DownloadRetries; i++ {
+		err = downloadArchive(ctx, u, token, name)
+		var retry errRetry
+		if err == nil || !errors.As(err, &retry) || ctx.Err() != nil {
+			break
+		}
+		log.Error("download archive", i, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(i) * Timeout5s):
+		}
+	}
+	if err == nil {
+		os.Remove(name + ValidatorExt)
+	}
+	return err
+}
+
+func downloadArchive(ctx context.Context, u, token, name string) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	validator, _ := os.ReadFile(name + ValidatorExt)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Token", token)
+	}
+	// the bytes as stored, the checksum is of them
+	req.Header.Set("Accept-Encoding", "identity")
+	if offset > 0 && len(validator) > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+		req.Header.Set("If-Range", string(validator))
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errRetry{err}
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		// the whole archive, a new one or no range asked
+		offset = 0
+		if err = f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	case http.StatusPartialContent:
+		start, err := contentRangeStart(res.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			os.Remove(name + ValidatorExt)
+			return errRetry{fmt.Errorf("content range unexpected: %s", res.Header.Get("Content-Range"))}
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// complete already
+		return checkArchive(name, res.Header.Get(DigestHeader))
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return errRetry{fmt.Errorf("status code %d", res.StatusCode)}
+	default:
+		if res.StatusCode >= 500 {
+			return errRetry{fmt.Errorf("status code %d", res.StatusCode)}
+		}
+		return fmt.Errorf("status code %d", res.StatusCode)
+	}
+
+	v := res.Header.Get("Etag")
+	if v == "" || strings.HasPrefix(v, "W/") {
+		v = res.Header.Get("Last-Modified")
+	}
+	if res.StatusCode == http.StatusOK && res.Header.Get("Accept-Ranges") != "bytes" {
+		v = ""
+	}
+	if v == "" {
+		os.Remove(name + ValidatorExt)
+	} else if string(validator) != v {
+		if err = os.WriteFile(name+ValidatorExt, []byte(v), 0644); err != nil {
+			return err
+		}
+	}
+
+	log.Info("download archive", name, "from", offset, res.Header.Get("Content-Disposition"))
+	if _, err = io.Copy(f, res.Body); err != nil {
+		if v == "" {
+			// not resumable, started over
+			f.Truncate(0)
+		}
+		return errRetry{err}
+	}
+
+	return checkArchive(name, res.Header.Get(DigestHeader))
+}
+
+// contentRangeStart parses bytes start-end/size
+func contentRangeStart(s string) (int64, error) {
+	s = strings.TrimPrefix(s, "bytes ")
+	i := strings.IndexByte(s, '-')
+	if i == -1 {
+		return 0, fmt.Errorf("content range invalid: %s", s)
+	}
+	return strconv.ParseInt(s[:i], 10, 64)
+}
+
+// checkArchive compares the sha256 of the file with the digest, sha-256=base64, if any,
+// a corrupted archive is removed to start over
+func checkArchive(name, digest string) error {
+	want := ""
+	for _, s := range strings.Split(digest, ",") {
+		s = strings.TrimSpace(s)
+		if i := strings.IndexByte(s, '='); i != -1 && strings.EqualFold(s[:i], "sha-256") {
+			b, err := base64.StdEncoding.DecodeString(s[i+1:])
+			if err != nil {
+				return fmt.Errorf("digest invalid: %s", digest)
+			}
+			want = hex.EncodeToString(b)
+		}
+	}
+	if want == "" {
+		log.Info("download archive no checksum", name)
+		return nil
+	}
+
+	sum, err := FileSum(name)
+	if err != nil {
+		return err
+	}
+	if sum != want {
+		os.Remove(name)
+		os.Remove(name + ValidatorExt)
+		return errRetry{fmt.Errorf("archive checksum mismatch, %s not %s", sum, want)}
+	}
+	log.Info("download archive verified", name, sum)
+	return nil
+}
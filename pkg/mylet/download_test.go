@@ -0,0 +1,206 @@
+package mylet
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// archiveServer serves the archive the way _DownloadBackup does, with its digest
+type archiveServer struct {
+	sync.Mutex
+	data []byte
+	etag string
+	// the digest told, of the data if empty
+	digest string
+	// answers the ranges from the start
+	ignoreRange bool
+
+	ranges, ifRanges []string
+	codes            []int
+}
+
+func digestOf(b []byte) string {
+	h := sha256.Sum256(b)
+	return "sha-256=" + base64.StdEncoding.EncodeToString(h[:])
+}
+
+func (as *archiveServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	as.Lock()
+	defer as.Unlock()
+
+	as.ranges = append(as.ranges, r.Header.Get("Range"))
+	as.ifRanges = append(as.ifRanges, r.Header.Get("If-Range"))
+
+	digest := as.digest
+	if digest == "" {
+		digest = digestOf(as.data)
+	}
+	w.Header().Set(DigestHeader, digest)
+	w.Header().Set("Etag", as.etag)
+
+	rw := &codeWriter{ResponseWriter: w}
+	if as.ignoreRange && r.Header.Get("Range") != "" {
+		w.Header().Set("Content-Range", "bytes 0-"+strconv.Itoa(len(as.data)-1)+"/"+strconv.Itoa(len(as.data)))
+		rw.WriteHeader(http.StatusPartialContent)
+		rw.Write(as.data)
+	} else {
+		http.ServeContent(rw, r, "archive", time.Time{}, bytes.NewReader(as.data))
+	}
+	as.codes = append(as.codes, rw.code)
+}
+
+type codeWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (cw *codeWriter) WriteHeader(code int) {
+	cw.code = code
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func newArchiveServer(t *testing.T, size int) (*archiveServer, string, string) {
+	as := &archiveServer{
+		data: bytes.Repeat([]byte("0123456789abcdef"), size/16),
+		etag: `"v1"`,
+	}
+	server := httptest.NewServer(as)
+	t.Cleanup(server.Close)
+	return as, server.URL + "/archive", filepath.Join(t.TempDir(), "archive.tar.gz")
+}
+
+func isRetry(err error) bool {
+	var retry errRetry
+	return errors.As(err, &retry)
+}
+
+func readFile(t *testing.T, name string) []byte {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDownloadResume(t *testing.T) {
+	as, u, name := newArchiveServer(t, 1<<20)
+	half := len(as.data) / 2
+	os.WriteFile(name, as.data[:half], 0644)
+	os.WriteFile(name+ValidatorExt, []byte(as.etag), 0644)
+
+	if err := downloadArchive(context.Background(), u, "", name); err != nil {
+		t.Fatal(err)
+	}
+	if as.ranges[0] != "bytes="+strconv.Itoa(half)+"-" || as.ifRanges[0] != as.etag || as.codes[0] != http.StatusPartialContent {
+		t.Fatalf("range %q, if-range %q, status %d", as.ranges[0], as.ifRanges[0], as.codes[0])
+	}
+	if !bytes.Equal(readFile(t, name), as.data) {
+		t.Fatal("resumed archive differs")
+	}
+}
+
+func TestDownloadIfRangeChanged(t *testing.T) {
+	as, u, name := newArchiveServer(t, 1<<20)
+	// the partial archive of a previous backup
+	os.WriteFile(name, bytes.Repeat([]byte("x"), 1000), 0644)
+	os.WriteFile(name+ValidatorExt, []byte(`"v0"`), 0644)
+
+	if err := downloadArchive(context.Background(), u, "", name); err != nil {
+		t.Fatal(err)
+	}
+	if as.ifRanges[0] != `"v0"` || as.codes[0] != http.StatusOK {
+		t.Fatalf("if-range %q, status %d, want the whole archive", as.ifRanges[0], as.codes[0])
+	}
+	if !bytes.Equal(readFile(t, name), as.data) {
+		t.Fatal("archive not started over")
+	}
+	if v := readFile(t, name+ValidatorExt); string(v) != as.etag {
+		t.Fatalf("validator %s, want %s", v, as.etag)
+	}
+}
+
+func TestDownloadRangeStartMismatch(t *testing.T) {
+	as, u, name := newArchiveServer(t, 1<<20)
+	as.ignoreRange = true
+	half := len(as.data) / 2
+	os.WriteFile(name, as.data[:half], 0644)
+	os.WriteFile(name+ValidatorExt, []byte(as.etag), 0644)
+
+	err := downloadArchive(context.Background(), u, "", name)
+	if !isRetry(err) {
+		t.Fatalf("error %v, want a retry", err)
+	}
+	if _, err = os.Stat(name + ValidatorExt); !os.IsNotExist(err) {
+		t.Fatalf("validator kept: %v", err)
+	}
+	if len(readFile(t, name)) != half {
+		t.Fatal("partial archive appended with the wrong range")
+	}
+
+	// no validator, the retry asks the whole archive
+	if err = downloadArchive(context.Background(), u, "", name); err != nil {
+		t.Fatal(err)
+	}
+	if as.ranges[1] != "" || !bytes.Equal(readFile(t, name), as.data) {
+		t.Fatalf("retry range %q", as.ranges[1])
+	}
+}
+
+func TestDownloadComplete(t *testing.T) {
+	as, u, name := newArchiveServer(t, 1<<20)
+	os.WriteFile(name, as.data, 0644)
+	os.WriteFile(name+ValidatorExt, []byte(as.etag), 0644)
+
+	if err := downloadArchive(context.Background(), u, "", name); err != nil {
+		t.Fatal(err)
+	}
+	if as.codes[0] != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("status %d, want %d", as.codes[0], http.StatusRequestedRangeNotSatisfiable)
+	}
+
+	// complete but corrupted
+	b := append([]byte(nil), as.data...)
+	b[100] ^= 1
+	os.WriteFile(name, b, 0644)
+	if err := downloadArchive(context.Background(), u, "", name); !isRetry(err) {
+		t.Fatalf("error %v, want a retry", err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("corrupted archive kept: %v", err)
+	}
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	as, u, name := newArchiveServer(t, 1<<20)
+	as.digest = digestOf([]byte("another archive"))
+
+	err := downloadArchive(context.Background(), u, "", name)
+	if !isRetry(err) {
+		t.Fatalf("error %v, want a retry", err)
+	}
+	for _, s := range []string{name, name + ValidatorExt} {
+		if _, err = os.Stat(s); !os.IsNotExist(err) {
+			t.Fatalf("%s kept: %v", filepath.Base(s), err)
+		}
+	}
+
+	// the retry starts over and is verified
+	as.digest = ""
+	if err = downloadArchive(context.Background(), u, "", name); err != nil {
+		t.Fatal(err)
+	}
+	if as.ranges[1] != "" || !bytes.Equal(readFile(t, name), as.data) {
+		t.Fatalf("retry range %q", as.ranges[1])
+	}
+}
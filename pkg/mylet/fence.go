@@ -0,0 +1,80 @@
+package mylet
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// FenceRequest makes the writer read only before a planned switchover,
+// or writable again when the switchover is given up
+type FenceRequest struct {
+	ReadOnly bool
+}
+
+// FenceResult is the GTID set executed once fenced, the new primary applies it before switching
+type FenceResult struct {
+	GtidExecuted string
+}
+
+// WaitGtidRequest waits for the GTID set to be applied, up to the timeout in seconds
+type WaitGtidRequest struct {
+	Gtid    string
+	Timeout int
+}
+
+// Fence sets the read only of the local mysqld, the commits in flight finish first
+func (mylet *Mylet) Fence(readOnly bool) (FenceResult, error) {
+	var result FenceResult
+
+	dsn := fmt.Sprintf("%s:%s%d@tcp(localhost:%d)/mysql",
+		mylet.Mysql.Spec.LocalUsername, mylet.Mysql.Spec.LocalPassword, mylet.Spec.Id, mylet.Spec.Port)
+	db, err := Open(dsn)
+	if err != nil {
+		return result, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout1m)
+	defer cancel()
+
+	query := []string{
+		"SET GLOBAL read_only = ON;",
+		"SET GLOBAL super_read_only = ON;",
+	}
+	if !readOnly {
+		query = []string{
+			"SET GLOBAL super_read_only = OFF;",
+			"SET GLOBAL read_only = OFF;",
+		}
+	}
+	for _, q := range query {
+		if _, err = db.ExecContext(ctx, q); err != nil {
+			return result, err
+		}
+	}
+
+	err = db.QueryRowContext(ctx, "SELECT @@GLOBAL.gtid_executed;").Scan(&result.GtidExecuted)
+	return result, err
+}
+
+// WaitGtid waits for the local mysqld to apply the GTID set
+func (mylet *Mylet) WaitGtid(r WaitGtidRequest) error {
+	dsn := fmt.Sprintf("%s:%s%d@tcp(localhost:%d)/mysql",
+		mylet.Mysql.Spec.LocalUsername, mylet.Mysql.Spec.LocalPassword, mylet.Spec.Id, mylet.Spec.Port)
+	db, err := Open(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.Timeout)*time.Second+Timeout5s)
+	defer cancel()
+
+	timedOut := 0
+	err = db.QueryRowContext(ctx, "SELECT WAIT_FOR_EXECUTED_GTID_SET(?, ?);", r.Gtid, r.Timeout).Scan(&timedOut)
+	if err == nil && timedOut != 0 {
+		err = fmt.Errorf("gtid set not applied in %ds", r.Timeout)
+	}
+	return err
+}
@@ -0,0 +1,223 @@
+package mylet
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	v1 "github.com/erda-project/mysql-operator/api/v1"
+	log "github.com/sirupsen/logrus"
+)
+
+// Actions decided by myctl, returned in the report result
+const (
+	GroupActionBootstrap = "bootstrap"
+	GroupActionJoin      = "join"
+)
+
+// Member states of performance_schema.replication_group_members
+const (
+	MemberOnline      = "ONLINE"
+	MemberRecovering  = "RECOVERING"
+	MemberOffline     = "OFFLINE"
+	MemberError       = "ERROR"
+	MemberUnreachable = "UNREACHABLE"
+)
+
+// Member roles of performance_schema.replication_group_members
+const (
+	RolePrimary   = "PRIMARY"
+	RoleSecondary = "SECONDARY"
+)
+
+type GroupMember struct {
+	Uuid  string
+	State string
+	Role  string
+	// Transactions received but not yet certified, the applier backlog
+	TransactionsInQueue int64
+	GtidExecuted        string
+}
+
+// IsMember reports whether the solo is a group replication member,
+// the solos after the primaries replicate from a member
+func (mylet *Mylet) IsMember() bool {
+	return mylet.Mysql.Spec.PrimaryMode != v1.ModeClassic && mylet.Spec.Id < mylet.Mysql.Spec.Primaries
+}
+
+// GroupReplicationUser is the distributed recovery user, unlike the replica user
+// its password is the same on every member since any member can be the donor
+func (mylet *Mylet) GroupReplicationUser() string {
+	return mylet.Mysql.Spec.ReplicaUsername + "_gr"
+}
+
+func (mylet *Mylet) localDB() (*sql.DB, error) {
+	dsn := fmt.Sprintf("%s:%s%d@tcp(localhost:%d)/mysql",
+		mylet.Mysql.Spec.LocalUsername, mylet.Mysql.Spec.LocalPassword, mylet.Spec.Id, mylet.Spec.Port)
+	return Open(dsn)
+}
+
+// SetupMember creates the recovery user and sets the recovery channel credentials,
+// group replication is started once myctl decides to bootstrap or join
+func (mylet *Mylet) SetupMember() error {
+	if !mylet.IsMember() {
+		return fmt.Errorf("%s is not a member", mylet.Spec.Name)
+	}
+
+	db, err := mylet.localDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	user := mylet.GroupReplicationUser()
+	password := mylet.Mysql.Spec.ReplicaPassword
+
+	// ssl is off, distributed recovery with caching_sha2_password requires a secure connection
+	query := []string{
+		"SET SESSION sql_log_bin = OFF;",
+		"SET GLOBAL read_only = OFF;",
+		"SET GLOBAL super_read_only = OFF;",
+		fmt.Sprintf("CREATE USER IF NOT EXISTS '%s'@'%%' IDENTIFIED WITH mysql_native_password BY '%s';", user, password),
+		fmt.Sprintf("ALTER USER '%s'@'%%' IDENTIFIED WITH mysql_native_password BY '%s';", user, password),
+		fmt.Sprintf("GRANT REPLICATION SLAVE ON *.* TO '%s'@'%%';", user),
+		"FLUSH PRIVILEGES;",
+	}
+
+	q := "CHANGE REPLICATION SOURCE TO SOURCE_USER = '%s', SOURCE_PASSWORD = '%s' FOR CHANNEL 'group_replication_recovery';"
+	if mylet.Mysql.Status.Version.Major == 5 {
+		q = "CHANGE MASTER TO MASTER_USER = '%s', MASTER_PASSWORD = '%s' FOR CHANNEL 'group_replication_recovery';"
+	}
+	query = append(query, fmt.Sprintf(q, user, password))
+
+	query = append(query,
+		"SET GLOBAL super_read_only = ON;",
+		"SET GLOBAL read_only = ON;",
+		"SET SESSION sql_log_bin = ON;",
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout5s)
+	defer cancel()
+
+	_, err = db.ExecContext(ctx, strings.Join(query, "\n"))
+	return err
+}
+
+// CollectGroupMember returns the local member state, role, queue and executed gtid set
+func (mylet *Mylet) CollectGroupMember() (*GroupMember, error) {
+	db, err := mylet.localDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout5s)
+	defer cancel()
+
+	m := &GroupMember{
+		State: MemberOffline,
+	}
+
+	err = db.QueryRowContext(ctx, "SELECT @@server_uuid;").Scan(&m.Uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	// 5.7 has no member role column, the single primary is a status variable
+	role := "m.MEMBER_ROLE"
+	if mylet.Mysql.Status.Version.Major == 5 {
+		role = "IF(m.MEMBER_ID = (SELECT VARIABLE_VALUE FROM performance_schema.global_status WHERE VARIABLE_NAME = 'group_replication_primary_member'), 'PRIMARY', 'SECONDARY')"
+	}
+	query := "SELECT m.MEMBER_STATE, " + role + ", IFNULL(s.COUNT_TRANSACTIONS_IN_QUEUE, 0)" +
+		" FROM performance_schema.replication_group_members m" +
+		" LEFT JOIN performance_schema.replication_group_member_stats s ON s.MEMBER_ID = m.MEMBER_ID" +
+		" WHERE m.MEMBER_ID = @@server_uuid;"
+
+	var state, memberRole sql.NullString
+	err = db.QueryRowContext(ctx, query).Scan(&state, &memberRole, &m.TransactionsInQueue)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if state.String != "" {
+		m.State = state.String
+	}
+	if m.State == MemberOnline {
+		m.Role = memberRole.String
+		if mylet.Mysql.Spec.PrimaryMode == v1.ModeMulti {
+			m.Role = RolePrimary
+		}
+	}
+
+	err = db.QueryRowContext(ctx, "SELECT @@GLOBAL.gtid_executed;").Scan(&m.GtidExecuted)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// GroupAction bootstraps or joins the group as decided by myctl
+func (mylet *Mylet) GroupAction(action string) error {
+	if !mylet.IsMember() {
+		return nil
+	}
+
+	switch action {
+	case GroupActionBootstrap, GroupActionJoin:
+	default:
+		return fmt.Errorf("group action invalid: %s", action)
+	}
+
+	db, err := mylet.localDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout1m)
+	defer cancel()
+
+	m, err := mylet.CollectGroupMember()
+	if err != nil {
+		return err
+	}
+	switch m.State {
+	case MemberOnline, MemberRecovering:
+		return nil
+	case MemberError:
+		// leave the group before rejoining
+		if _, err = db.ExecContext(ctx, "STOP GROUP_REPLICATION;"); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("[GroupAction] %s %s, gtid executed %s", mylet.Spec.Name, action, m.GtidExecuted)
+
+	if action == GroupActionBootstrap {
+		if _, err = db.ExecContext(ctx, "SET GLOBAL group_replication_bootstrap_group = ON;"); err != nil {
+			return err
+		}
+		defer func() {
+			_, err := db.ExecContext(context.Background(), "SET GLOBAL group_replication_bootstrap_group = OFF;")
+			if err != nil {
+				log.Errorf("[GroupAction] reset bootstrap group: %v", err)
+			}
+		}()
+	}
+
+	_, err = db.ExecContext(ctx, "START GROUP_REPLICATION;")
+	if err != nil {
+		return err
+	}
+
+	// the bootstrap member is the primary, the rest of the members replicate the user
+	if action == GroupActionBootstrap && mylet.Mysql.Spec.EnableExporter {
+		err = mylet.ExporterUser()
+		if err != nil {
+			log.Errorf("[GroupAction] exporter user: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package mylet
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GtidSet maps the source uuid, with an optional tag, to its merged intervals
+type GtidSet map[string][][2]int64
+
+func ParseGtidSet(s string) (GtidSet, error) {
+	a := make(GtidSet)
+
+	s = strings.Join(strings.Fields(s), "")
+	if s == "" {
+		return a, nil
+	}
+
+	for _, item := range strings.Split(s, ",") {
+		parts := strings.Split(item, ":")
+		if len(parts) < 2 || parts[0] == "" {
+			return nil, fmt.Errorf("gtid set invalid: %s", item)
+		}
+
+		k := strings.ToLower(parts[0])
+		for _, p := range parts[1:] {
+			if p == "" {
+				return nil, fmt.Errorf("gtid set invalid: %s", item)
+			}
+			if p[0] < '0' || p[0] > '9' {
+				// tagged gtid
+				k = strings.ToLower(parts[0]) + ":" + p
+				continue
+			}
+
+			var start, end int64
+			var err error
+			if i := strings.IndexByte(p, '-'); i == -1 {
+				start, err = strconv.ParseInt(p, 10, 64)
+				end = start
+			} else {
+				start, err = strconv.ParseInt(p[:i], 10, 64)
+				if err == nil {
+					end, err = strconv.ParseInt(p[i+1:], 10, 64)
+				}
+			}
+			if err != nil || start < 1 || end < start {
+				return nil, fmt.Errorf("gtid set invalid: %s", item)
+			}
+			a[k] = append(a[k], [2]int64{start, end})
+		}
+	}
+
+	for k, v := range a {
+		a[k] = mergeIntervals(v)
+	}
+	return a, nil
+}
+
+func mergeIntervals(a [][2]int64) [][2]int64 {
+	sort.Slice(a, func(i, j int) bool {
+		return a[i][0] < a[j][0]
+	})
+	b := a[:0]
+	for _, v := range a {
+		if n := len(b); n > 0 && v[0] <= b[n-1][1]+1 {
+			if v[1] > b[n-1][1] {
+				b[n-1][1] = v[1]
+			}
+			continue
+		}
+		b = append(b, v)
+	}
+	return b
+}
+
+// Count returns the number of transactions
+func (a GtidSet) Count() (n int64) {
+	for _, v := range a {
+		for _, i := range v {
+			n += i[1] - i[0] + 1
+		}
+	}
+	return
+}
+
+// Contains reports whether every transaction of b is in a
+func (a GtidSet) Contains(b GtidSet) bool {
+	for k, v := range b {
+		for _, i := range v {
+			ok := false
+			for _, j := range a[k] {
+				if j[0] <= i[0] && i[1] <= j[1] {
+					ok = true
+					break
+				}
+			}
+			if !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"net"
-	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
@@ -16,6 +15,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/erda-project/mysql-operator/pkg/crypt"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -56,6 +56,20 @@ func (mylet *Mylet) FetchAndPrepare() error {
 	}
 	s := mylet.Mysql.Status.Solos[id]
 
+	// cloned by mysqld itself, an older donor is seeded with xtrabackup
+	if mylet.CloneSeeding() {
+		err = mylet.CloneFrom(id)
+		if err != ErrCloneUnsupported {
+			return err
+		}
+		log.Info("clone unsupported by", s.Spec.Host)
+	}
+
+	k, err := mylet.BackupKey()
+	if err != nil {
+		return err
+	}
+
 	t := dir + ".cxrtmp"
 	err = os.RemoveAll(t)
 	if err != nil {
@@ -65,64 +79,83 @@ func (mylet *Mylet) FetchAndPrepare() error {
 	ctx, cancel := context.WithTimeout(context.Background(), Hour8)
 	defer cancel()
 
+	token := SoloToken(mylet.Mysql, mylet.Spec.Name)
 	u := url.URL{
 		Scheme: "http",
 		Host:   net.JoinHostPort(s.Spec.Host, strconv.Itoa(s.Spec.MyletPort)),
-		Path:   "/api/addons/mylet/download/backup",
+		Path:   "/api/addons/mylet/stream/backup",
 	}
-	q := make(url.Values, 1)
-	q.Set("datetime", "replication")
-	u.RawQuery = q.Encode()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	// streamed without a copy on the source, an older source serves the tarball of a backup
+	err = FetchStream(ctx, u.String(), token, t, k)
+	if err == ErrStreamUnsupported {
+		log.Info("stream backup unsupported by", s.Spec.Host)
+
+		u.Path = "/api/addons/mylet/download/backup"
+		q := make(url.Values, 1)
+		q.Set("datetime", "replication")
+		u.RawQuery = q.Encode()
+
+		if err = os.RemoveAll(t); err == nil {
+			err = DownloadBackup(ctx, u.String(), token, t, k)
+		}
+	}
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Token", SoloToken(mylet.Mysql, mylet.Spec.Name))
-
-	res, err := http.DefaultClient.Do(req)
+	err = mylet.PrepareBackup(id, t)
+	if err == nil {
+		err = mylet.RestoreBackup(id, filepath.Join(t, "base"), true)
+		if err == nil {
+			err = mylet.AdjustBackup(id)
+		}
+	}
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("status code %d", res.StatusCode)
-	}
+	return os.RemoveAll(t)
+}
 
-	// TODO
-	filename := res.Header.Get("Content-Disposition")
-	log.Info("download backup", filename)
+// DownloadBackup downloads the backup archive beside dir, resumable and checked,
+// then extracts it into dir, the token is sent to mylet if any,
+// a sealed archive is opened with the key
+func DownloadBackup(ctx context.Context, u, token, dir string, k *crypt.Key) error {
+	archive := dir + CompressExt
+	if err := DownloadArchive(ctx, u, token, archive); err != nil {
+		return err
+	}
 
-	err = os.MkdirAll(t, 0755)
+	f, err := os.Open(archive)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	cmd := exec.CommandContext(ctx, "tar", "-xzf", "-", "-C", t, "--strip-components=1")
-	cmd.Dir = t
-	cmd.Stdin = res.Body
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	err = cmd.Run()
+	r, id, err := crypt.Open(f, k)
 	if err != nil {
 		return err
 	}
-
-	err = mylet.PrepareBackup(id, t)
-	if err == nil {
-		err = mylet.RestoreBackup(id, filepath.Join(t, "base"), true)
-		if err == nil {
-			err = mylet.AdjustBackup(id)
-		}
+	if id != "" {
+		log.Info("download backup sealed", filepath.Base(archive), id)
 	}
+
+	err = os.MkdirAll(dir, 0755)
 	if err != nil {
 		return err
 	}
 
-	return os.RemoveAll(t)
+	cmd := exec.CommandContext(ctx, "tar", "-xzf", "-", "-C", dir, "--strip-components=1")
+	cmd.Dir = dir
+	cmd.Stdin = r
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err = cmd.Run(); err != nil {
+		return err
+	}
+	return os.Remove(archive)
 }
 
 func (mylet *Mylet) Initialize() error {
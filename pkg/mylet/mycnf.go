@@ -1,7 +1,6 @@
 package mylet
 
 const MyCnfTmpl = `[mysqld]
-# TODO
 ssl = OFF
 local_infile = OFF
 secure_file_priv = NULL
@@ -10,8 +9,6 @@ mysqlx = OFF
 {{- end}}
 #skip_name_resolve = ON
 #skip-host-cache
-max_connections = 2048
-max_allowed_packet = 256M
 explicit_defaults_for_timestamp = ON
 
 super_read_only = ON
@@ -35,12 +32,6 @@ enforce_gtid_consistency = ON
 binlog_format = ROW
 log_bin = {{.Spec.Name}}-bin
 log_error = {{.Spec.Name}}.err
-## 日志过期时间,包括二进制日志(过期自动删除)
-expire_logs_days = 7
-## 指定每个二进制日志文件的最大大小
-max_binlog_size = 1G
-## 指定在写入二进制日志之前，用于缓存事务的内存大小
-max_binlog_cache_size = 512M
 {{- if eq .Mysql.Status.Version.Major 5}}
 log_slave_updates = ON
 {{- else}}
@@ -75,10 +66,26 @@ disabled_storage_engines = MyISAM,BLACKHOLE,FEDERATED,ARCHIVE,MEMORY
 plugin_load_add = group_replication.so
 group_replication_group_name = {{.Mysql.Spec.GroupName}}
 group_replication_start_on_boot = OFF
-group_replication_local_address = {{.GroupReplicationLocalAddress}}
+group_replication_local_address = {{.MysqlSolo.GroupReplicationLocalAddress}}
 group_replication_group_seeds = {{.Mysql.GroupReplicationGroupSeeds}}
 group_replication_bootstrap_group = OFF
+{{- if eq .Mysql.Spec.PrimaryMode "Multi" }}
+group_replication_single_primary_mode = OFF
+group_replication_enforce_update_everywhere_checks = ON
+{{- end}}
 {{- end}}
 
 !includedir {{.Spec.Mydir}}/my.cnf.d/
 `
+
+// DefaultMysqlConfig is rendered into my.cnf.d, overridden by spec.mysqlConfig
+var DefaultMysqlConfig = map[string]string{
+	"max_connections":    "2048",
+	"max_allowed_packet": "256M",
+	// 日志过期时间,包括二进制日志(过期自动删除)
+	"expire_logs_days": "7",
+	// 指定每个二进制日志文件的最大大小
+	"max_binlog_size": "1G",
+	// 指定在写入二进制日志之前，用于缓存事务的内存大小
+	"max_binlog_cache_size": "512M",
+}
@@ -34,6 +34,26 @@ type Mylet struct {
 	ExitChan   chan struct{}
 
 	hangCount int // 连续探测失败次数
+
+	// Hash of the mysql config in effect
+	ConfigHash        string
+	fetchedConfigHash string
+
+	// The running conversion action and the last error
+	Converting   string
+	ConvertError string
+
+	// How far the restore got, reported to myctl
+	Restore RestoreReport
+
+	// The chain being verified
+	Verifying string
+
+	// The chains being read by base name, never pruned
+	reading map[string]int
+
+	// The stream backup being served to seed a solo
+	stream *StreamSession
 }
 
 // New creates a new Mylet
@@ -0,0 +1,477 @@
+package mylet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Restore actions requested by myctl
+const (
+	// Download and prepare the backup beside the datadir, applied on the next start
+	RestoreStage = "stage"
+	// Fetch the data from the source solo again on the next start
+	RestoreReseed = "reseed"
+)
+
+// Holds the restore name, in the staging dir, beside the datadir for a reseed,
+// and in the backup dir with the time once restored
+const RestoreFilename = "mylet_restore"
+
+// Holds the point in time to replay the binlogs up to, in the staging dir
+const PointInTimeFilename = "mylet_pitr"
+
+type RestoreRequest struct {
+	// The MysqlRestore
+	Name   string
+	Action string
+
+	// The archive to stage, the token is sent if the source is a mylet
+	URL   string
+	Token string
+	// Apply the incrementals up to the index, all if nil
+	Incremental *int
+
+	// The archived binlogs of the source since the backup, replayed up to the stop time or GTID,
+	// the incrementals after the point in time are not applied
+	BinlogURL string
+	StopTime  *time.Time
+	StopGtid  string
+}
+
+func (r *RestoreRequest) IsPointInTime() bool {
+	return r.BinlogURL != ""
+}
+
+// RestoreReport tells myctl how far the restore got on the solo
+type RestoreReport struct {
+	Staging  string
+	Staged   string
+	Restored string
+	// The restore failed to stage or apply and why
+	Failed string
+	Error  string
+}
+
+func (mylet *Mylet) RestoreDir() string {
+	return mylet.DataDir() + ".restore"
+}
+func (mylet *Mylet) ReseedFile() string {
+	return mylet.DataDir() + ".reseed"
+}
+
+// StageRestore downloads and prepares the backup while mysqld keeps running
+func (mylet *Mylet) StageRestore(r RestoreRequest) (err error) {
+	mylet.Lock()
+	o := mylet.Restore.Staging
+	if o == "" {
+		mylet.Restore.Staging = r.Name
+		mylet.Restore.Staged = ""
+		mylet.Restore.Failed = ""
+		mylet.Restore.Error = ""
+	}
+	mylet.Unlock()
+	if o != "" {
+		return fmt.Errorf("staging: %s", o)
+	}
+
+	defer func() {
+		mylet.Lock()
+		mylet.Restore.Staging = ""
+		if err == nil {
+			mylet.Restore.Staged = r.Name
+		} else {
+			mylet.Restore.Failed = r.Name
+			mylet.Restore.Error = r.Action + ": " + err.Error()
+		}
+		mylet.Unlock()
+	}()
+
+	k, err := mylet.BackupKey()
+	if err != nil {
+		return err
+	}
+
+	dir := mylet.RestoreDir()
+	if err = os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), Hour8)
+	defer cancel()
+
+	log.Infof("[Restore] %s stage %s from %s", mylet.Spec.Name, r.Name, r.URL)
+	if err = DownloadBackup(ctx, r.URL, r.Token, dir, k); err != nil {
+		return err
+	}
+
+	last := -1
+	if r.Incremental != nil {
+		last = *r.Incremental
+	}
+	if r.IsPointInTime() {
+		if last, err = PointInTimeIncremental(dir, r, last); err != nil {
+			return err
+		}
+
+		log.Infof("[Restore] %s stage binlogs of %s from %s", mylet.Spec.Name, r.Name, r.BinlogURL)
+		if err = DownloadBackup(ctx, r.BinlogURL, r.Token, filepath.Join(dir, "binlog"), k); err != nil {
+			return err
+		}
+
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if err = os.WriteFile(filepath.Join(dir, PointInTimeFilename), b, 0644); err != nil {
+			return err
+		}
+	}
+	if err = mylet.PrepareBackupUpTo(mylet.Spec.Id, dir, last); err != nil {
+		return err
+	}
+
+	log.Infof("[Restore] %s staged %s", mylet.Spec.Name, r.Name)
+	return os.WriteFile(filepath.Join(dir, RestoreFilename), []byte(r.Name), 0644)
+}
+
+// PointInTimeIncremental checks the full backup is consistent before the point in time,
+// returns the last incremental also consistent before it, up to the index, all if negative
+func PointInTimeIncremental(dir string, r RestoreRequest, last int) (int, error) {
+	var target GtidSet
+	if r.StopGtid != "" {
+		var err error
+		if target, err = ParseGtidSet(r.StopGtid); err != nil {
+			return 0, err
+		}
+	}
+
+	before := func(d string) (bool, error) {
+		if r.StopTime != nil {
+			t, dur, err := ReadBackupInfo(d)
+			if err != nil {
+				return false, err
+			}
+			if !t.Add(dur).Before(*r.StopTime) {
+				return false, nil
+			}
+		}
+		if target != nil {
+			s, err := ReadBackupGtid(d)
+			if err != nil {
+				return false, err
+			}
+			set, err := ParseGtidSet(s)
+			if err != nil {
+				return false, err
+			}
+			if set.Contains(target) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+
+	ok, err := before(filepath.Join(dir, "base"))
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("the full backup is not before the point in time")
+	}
+
+	a, err := GetIncrementals(dir)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, i := range a {
+		if last >= 0 && i > last {
+			break
+		}
+		ok, err = before(filepath.Join(dir, "inc"+strconv.Itoa(i)))
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+		n = i
+	}
+	return n, nil
+}
+
+// RequestReseed marks the datadir to be fetched again on the next start
+func (mylet *Mylet) RequestReseed(r RestoreRequest) error {
+	log.Infof("[Restore] %s reseed %s", mylet.Spec.Name, r.Name)
+	return os.WriteFile(mylet.ReseedFile(), []byte(r.Name), 0644)
+}
+
+// ErrDataDirLost is a failed restore whose datadir could not be moved back
+var ErrDataDirLost = errors.New("datadir lost")
+
+// ReplaceDataDir moves the datadir aside for fill to write a new one,
+// the old one is moved back if fill fails and dropped only once it succeeds
+func (mylet *Mylet) ReplaceDataDir(fill func() error) error {
+	dir := mylet.DataDir()
+	old := dir + ".cxrold"
+
+	_, err := os.Stat(old)
+	if err == nil {
+		// left by a start stopped in the middle, the datadir is partial
+		err = os.RemoveAll(dir)
+	} else if os.IsNotExist(err) {
+		err = os.Rename(dir, old)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = fill(); err == nil {
+		return os.RemoveAll(old)
+	}
+
+	e := os.RemoveAll(dir)
+	if e == nil {
+		e = os.Rename(old, dir)
+		if os.IsNotExist(e) {
+			e = nil
+		}
+	}
+	if e != nil {
+		return fmt.Errorf("%w: %v, move back: %v", ErrDataDirLost, err, e)
+	}
+	return err
+}
+
+// ApplyRestore replaces the datadir before mysqld starts,
+// with the staged backup, or by fetching from the source solo for a reseed,
+// a failed one is reported and the datadir kept, only a datadir lost is returned
+func (mylet *Mylet) ApplyRestore() error {
+	restoreDir := mylet.RestoreDir()
+
+	failed := func(name, action string, err error) {
+		log.Errorf("[Restore] %s %s %s failed: %v", mylet.Spec.Name, action, name, err)
+		mylet.Lock()
+		mylet.Restore.Failed = name
+		mylet.Restore.Error = action + ": " + err.Error()
+		mylet.Unlock()
+	}
+
+	if b, err := os.ReadFile(filepath.Join(restoreDir, RestoreFilename)); err == nil {
+		name := string(b)
+		log.Infof("[Restore] %s apply %s", mylet.Spec.Name, name)
+
+		err = mylet.ReplaceDataDir(func() error {
+			err := mylet.RestoreBackup(mylet.Spec.Id, filepath.Join(restoreDir, "base"), true)
+			if err != nil {
+				return err
+			}
+			if err = mylet.AdjustRestore(); err != nil {
+				return err
+			}
+			if b, err := os.ReadFile(filepath.Join(restoreDir, PointInTimeFilename)); err == nil {
+				var r RestoreRequest
+				if err = json.Unmarshal(b, &r); err != nil {
+					return err
+				}
+				if err = mylet.ReplayBinlogs(filepath.Join(restoreDir, "binlog"), r.StopTime, r.StopGtid); err != nil {
+					return err
+				}
+			} else if !os.IsNotExist(err) {
+				return err
+			}
+			return mylet.WriteRestored(name)
+		})
+		if errors.Is(err, ErrDataDirLost) {
+			return err
+		}
+		if err != nil {
+			failed(name, "apply", err)
+		}
+		// the backup is moved out, not applied again
+		if err = os.RemoveAll(restoreDir); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if b, err := os.ReadFile(mylet.ReseedFile()); err == nil {
+		name := string(b)
+		log.Infof("[Restore] %s reseed %s", mylet.Spec.Name, name)
+
+		err = mylet.ReplaceDataDir(func() error {
+			if err := mylet.FetchAndPrepare(); err != nil {
+				return err
+			}
+			return mylet.WriteRestored(name)
+		})
+		if errors.Is(err, ErrDataDirLost) {
+			return err
+		}
+		if err != nil {
+			failed(name, "reseed", err)
+		}
+		if err = os.Remove(mylet.ReseedFile()); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	name, _, err := mylet.ReadRestored()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	mylet.Lock()
+	mylet.Restore.Restored = name
+	mylet.Unlock()
+	return nil
+}
+
+func (mylet *Mylet) WriteRestored(name string) error {
+	dir := mylet.BackupDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	s := name + " " + time.Now().Format(DatetimeLayout) + "\n"
+	return os.WriteFile(filepath.Join(dir, RestoreFilename), []byte(s), 0644)
+}
+
+// ReadRestored returns the last restore applied and when,
+// the backups taken before hold the data replaced
+func (mylet *Mylet) ReadRestored() (name string, t time.Time, err error) {
+	b, err := os.ReadFile(filepath.Join(mylet.BackupDir(), RestoreFilename))
+	if err != nil {
+		return
+	}
+
+	s := strings.TrimSpace(string(b))
+	i := strings.LastIndexByte(s, ' ')
+	if i == -1 {
+		err = fmt.Errorf("no space")
+		return
+	}
+
+	name = s[:i]
+	t, err = time.ParseInLocation(DatetimeLayout, s[i+1:], time.Local)
+	return
+}
+
+// AdjustRestore takes over the restored data, the accounts may come from another mysql,
+// so mysqld starts without the grant tables to reset them
+func (mylet *Mylet) AdjustRestore() error {
+	o := mylet.LockBackup("adjust restore")
+	if o != "" {
+		return fmt.Errorf("backing: %s", o)
+	}
+	defer mylet.UnlockBackup()
+
+	gtid, err := mylet.ReadGtid()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout1m)
+	defer cancel()
+
+	socket := mylet.Socket()
+	cmd := mylet.Mysqld(ctx,
+		"--skip-networking",
+		"--skip-grant-tables",
+	)
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := cmd.Process.Signal(syscall.SIGTERM)
+		if err != nil {
+			log.Error("stop local mysqld", err)
+		}
+		err = cmd.Wait()
+		if err != nil {
+			log.Error("wait local mysqld", err)
+		}
+	}()
+
+	dsn := fmt.Sprintf("%s:@unix(%s)/mysql", mylet.Mysql.Spec.LocalUsername, socket)
+	db, err := Open(dsn)
+	if err != nil {
+		return err
+	}
+
+	local := fmt.Sprintf("'%s'@'localhost'", mylet.Mysql.Spec.LocalUsername)
+	localPassword := fmt.Sprintf("'%s%d'", mylet.Mysql.Spec.LocalPassword, mylet.Spec.Id)
+	replica := fmt.Sprintf("'%s'@'%%'", mylet.Mysql.Spec.ReplicaUsername)
+	replicaPassword := fmt.Sprintf("'%s%d'", mylet.Mysql.Spec.ReplicaPassword, mylet.Spec.Id)
+
+	query := []string{
+		// loads the grant tables, the accounts can be changed from now on
+		"FLUSH PRIVILEGES;",
+
+		"SET SESSION sql_log_bin = OFF;",
+		"SET GLOBAL read_only = OFF;",
+		"SET GLOBAL super_read_only = OFF;",
+
+		"RESET MASTER;",
+	}
+	q := fmt.Sprintf("SET GLOBAL gtid_purged = '%s';", gtid)
+	log.Info(q)
+	query = append(query, q,
+		"CREATE USER IF NOT EXISTS "+local+" IDENTIFIED WITH mysql_native_password BY "+localPassword+";",
+		"ALTER USER "+local+" IDENTIFIED WITH mysql_native_password BY "+localPassword+";",
+		"GRANT ALL PRIVILEGES ON *.* TO "+local+" WITH GRANT OPTION;",
+
+		"CREATE USER IF NOT EXISTS "+replica+" IDENTIFIED WITH mysql_native_password BY "+replicaPassword+";",
+		"ALTER USER "+replica+" IDENTIFIED WITH mysql_native_password BY "+replicaPassword+";",
+		"GRANT REPLICATION CLIENT, REPLICATION SLAVE ON *.* TO "+replica+";",
+
+		"FLUSH PRIVILEGES;",
+
+		"SET GLOBAL super_read_only = ON;",
+		"SET GLOBAL read_only = ON;",
+		"SET SESSION sql_log_bin = ON;",
+	)
+
+	for i := 1; i <= 10; i++ {
+		log.Info("ping local mysqld sleep 5 seconds", i)
+		time.Sleep(Timeout5s)
+
+		func() {
+			ctx, cancel := context.WithTimeout(context.Background(), Timeout5s)
+			defer cancel()
+
+			err = db.PingContext(ctx)
+			if err != nil {
+				return
+			}
+
+			_, err = db.ExecContext(ctx, strings.Join(query, "\n"))
+			if err != nil {
+				log.Fatal("adjust restore", err)
+			}
+		}()
+
+		if err == nil {
+			break
+		}
+	}
+
+	return err
+}
@@ -3,12 +3,16 @@ package mylet
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -17,7 +21,9 @@ import (
 
 	"github.com/cxr29/tiny"
 	"github.com/cxr29/tiny/alog"
+	"github.com/cxr29/tiny/compress"
 	v1 "github.com/erda-project/mysql-operator/api/v1"
+	"github.com/erda-project/mysql-operator/pkg/crypt"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -84,10 +90,23 @@ func Fetch(myctlAddr, soloName, groupToken string) (*Mylet, error) {
 		return nil, fmt.Errorf("return error: %s", v.Error)
 	}
 
-	// 调试：打印获取到的 spec 和 status
+	// 调试：打印获取到的 spec 和 status，在填入凭据之前
 	log.Infof("[Fetch] Got Spec: %+v", v.Data.Spec)
 	log.Infof("[Fetch] Got Status: %+v", v.Data.Status)
 
+	// credentials are not served by myctl, they come from secrets
+	v.Data.Spec.GroupToken = groupToken
+	v.Data.Spec.LocalPassword = os.Getenv("LOCAL_PASSWORD")
+	v.Data.Spec.ReplicaPassword = os.Getenv("REPLICA_PASSWORD")
+	v.Data.Spec.ExporterPassword = os.Getenv("EXPORTER_PASSWORD")
+	if bs := v.Data.Spec.BackupStorage; bs != nil {
+		bs.AccessKey = os.Getenv("BACKUP_STORAGE_ACCESS_KEY")
+		bs.SecretKey = os.Getenv("BACKUP_STORAGE_SECRET_KEY")
+	}
+	if be := v.Data.Spec.BackupEncryption; be != nil {
+		be.Key = os.Getenv("BACKUP_ENCRYPTION_KEY")
+	}
+
 	mysqlSolo := v.Data.Status.Solos[id]
 
 	mylet := &Mylet{
@@ -147,6 +166,16 @@ func (mylet *Mylet) CollectLocalStatus() v1.MysqlSoloStatus {
 		if err == nil {
 			status.Color = v1.Green
 			mylet.hangCount = 0 // 探测成功，重置 hang
+
+			lag := 0
+			if mylet.IsReplica() {
+				lag, err = ReplicaLag(ctx, db)
+			}
+			if err == nil {
+				status.Lag = &lag
+			} else {
+				log.Errorf("[CollectLocalStatus] replica lag: %v", err)
+			}
 		} else {
 			status.Color = v1.Red
 			mylet.hangCount++
@@ -178,6 +207,20 @@ func (mylet *Mylet) CollectReport() *MysqlReport {
 		Name:     mylet.Spec.Name,
 		SizeSpec: NewSizeSpec(mylet.Mysql),
 		States:   []json.RawMessage{stateJson},
+		Lag:      localStatus.Lag,
+
+		ConfigHash: mylet.ConfigHash,
+	}
+	mylet.Lock()
+	mr.ConvertError = mylet.ConvertError
+	mr.Restore = mylet.Restore
+	mylet.Unlock()
+	if mylet.IsMember() && mylet.ReadinessProbe && localStatus.Color == v1.Green {
+		m, err := mylet.CollectGroupMember()
+		if err != nil {
+			log.Errorf("[CollectReport] group member: %v", err)
+		}
+		mr.Group = m
 	}
 	log.Infof("[CollectReport] Name=%s, id=%d, color=%s, SizeSpec=%+v", mr.Name, id, localStatus.Color, mr.SizeSpec)
 	return mr
@@ -193,6 +236,12 @@ func (mylet *Mylet) Run() {
 		log.Fatal("Configure", err)
 	}
 
+	// a restore staged or a reseed requested before the restart
+	err = mylet.ApplyRestore()
+	if err != nil {
+		log.Fatal("ApplyRestore", err)
+	}
+
 	dir := mylet.DataDir()
 	empty, err := IsEmpty(dir)
 	if err != nil {
@@ -234,6 +283,16 @@ func (mylet *Mylet) Run() {
 						log.Errorf("Reload failed: %v", err)
 					}
 				}
+				if result.GroupAction != "" {
+					if err := mylet.GroupAction(result.GroupAction); err != nil {
+						log.Errorf("GroupAction failed: %v", err)
+					}
+				}
+				if result.ConfigHash != mylet.ConfigHash && result.ConfigHash != mylet.fetchedConfigHash {
+					if err := mylet.ReloadConfig(); err != nil {
+						log.Errorf("ReloadConfig failed: %v", err)
+					}
+				}
 			}
 		}
 	}()
@@ -249,6 +308,9 @@ func (mylet *Mylet) Run() {
 		os.Exit(0)
 	}()
 
+	// closed binlogs next to the backups for the point in time recovery
+	go mylet.ArchiveBinlogsLoop()
+
 	tiny.Group("/api/addons/mylet", mylet._Route)
 
 	Serve()
@@ -291,8 +353,20 @@ func (mylet *Mylet) _Route(r *tiny.Router) {
 	})
 
 	r.GET("/switch/primary/<id:int>", mylet._SwitchPrimary)
+	r.POST("/fence", mylet._Fence)
+	r.POST("/wait/gtid", mylet._WaitGtid)
+	r.POST("/convert", mylet._Convert)
+	r.POST("/restore", mylet._Restore)
 	r.GET("/download/backup", mylet._DownloadBackup)
+	r.GET("/stream/backup", mylet._StreamBackup)
+	r.POST("/clone/donor", mylet._CloneDonor)
+	r.POST("/apply/database", mylet._ApplyDatabase)
+	r.POST("/apply/user", mylet._ApplyUser)
+	r.GET("/backups", mylet._ListBackups)
+	r.GET("/download/binlogs", mylet._DownloadBinlogs)
 	r.POST("/backup", mylet._Backup)
+	r.POST("/prune/backups", mylet._PruneBackups)
+	r.POST("/verify/backup", mylet._VerifyBackup)
 
 	r.Group("", func(r *tiny.Router) {
 		r.Use(PushToken, mylet._ValidateToken)
@@ -324,6 +398,12 @@ func (mylet *Mylet) _DownloadBackup(ctx *tiny.Context) {
 	var f string
 
 	if s == "replication" {
+		// the backups taken before a restore hold the data replaced
+		_, restored, _ := mylet.ReadRestored()
+		stale := func(t time.Time) bool {
+			return time.Since(t) > Day || t.Before(restored)
+		}
+
 		a, err := mylet.GetCompresses()
 		if err != nil {
 			log.Error("get compresses", err)
@@ -332,7 +412,7 @@ func (mylet *Mylet) _DownloadBackup(ctx *tiny.Context) {
 		}
 
 		i := len(a) - 1
-		if i == -1 || time.Since(a[i]) > Day {
+		if i == -1 || stale(a[i]) {
 			a, err = mylet.GetBackups()
 			if err != nil {
 				log.Error("get backups", err)
@@ -341,7 +421,7 @@ func (mylet *Mylet) _DownloadBackup(ctx *tiny.Context) {
 			}
 
 			i = len(a) - 1
-			if i == -1 || time.Since(a[i]) > Day {
+			if i == -1 || stale(a[i]) {
 				_, err = mylet.FullBackup()
 				if err != nil {
 					log.Error("full backup", err)
@@ -356,8 +436,11 @@ func (mylet *Mylet) _DownloadBackup(ctx *tiny.Context) {
 				ctx.InternalServerError()
 				return
 			}
+			defer mylet.ReadBackup(strings.TrimSuffix(filepath.Base(f), CompressExt))()
+			mylet.EnforceRetention()
 		} else {
 			f = mylet.GetBackupDir(a[i]) + CompressExt
+			defer mylet.ReadBackup(strings.TrimSuffix(filepath.Base(f), CompressExt))()
 		}
 	} else {
 		t, err := time.ParseInLocation("20060102.150405", s, time.Local)
@@ -368,11 +451,26 @@ func (mylet *Mylet) _DownloadBackup(ctx *tiny.Context) {
 
 		d := mylet.GetBackupDir(t)
 		f = d + CompressExt
+		defer mylet.ReadBackup(filepath.Base(d))()
 
 		fi, err := os.Stat(f)
 		if os.IsNotExist(err) {
 			fi, err = os.Stat(d)
-			if os.IsNotExist(err) || !fi.IsDir() {
+			if os.IsNotExist(err) {
+				// shipped to the backup storage and gone locally
+				err = mylet.DownloadRemoteBackup(t)
+				if errors.Is(err, os.ErrNotExist) {
+					ctx.NotFound()
+					return
+				}
+				if err != nil {
+					log.Error("download remote backup", err)
+					ctx.InternalServerError()
+					return
+				}
+				fi, err = os.Stat(d)
+			}
+			if err != nil || !fi.IsDir() {
 				ctx.NotFound()
 				return
 			}
@@ -395,10 +493,245 @@ func (mylet *Mylet) _DownloadBackup(ctx *tiny.Context) {
 		}
 	}
 
+	// gzip again breaks the ranges
+	compress.Off(ctx)
+
+	k, err := mylet.BackupKey()
+	if err != nil {
+		log.Error("backup key", err)
+		ctx.InternalServerError()
+		return
+	}
+	if k != nil {
+		// a tarball made before the encryption is sealed once, then served like the others
+		id, err := crypt.ReadKeyID(f)
+		if err != nil {
+			ctx.NotFound()
+			return
+		}
+		if id == "" {
+			err = mylet.SealArchive(f, k)
+			if err != nil {
+				log.Error("seal backup", filepath.Base(f), err)
+				ctx.InternalServerError()
+				return
+			}
+		}
+	}
+
+	sum, err := ReadManifest(f)
+	if err != nil {
+		log.Error("read manifest", filepath.Base(f), err)
+		ctx.NotFound()
+		return
+	}
+	// the checksum tells the downloader the archive to resume and verify
+	ctx.Header().Set("Etag", `"`+sum+`"`)
+	if b, err := hex.DecodeString(sum); err == nil {
+		ctx.Header().Set(DigestHeader, "sha-256="+base64.StdEncoding.EncodeToString(b))
+	}
+
 	ctx.ContentDisposition(filepath.Base(f), "")
 	ctx.ServeFile(f)
 }
 
+// _StreamBackup streams a full backup taken on the fly to seed a solo,
+// resumed at the offset of the session, the trailer tells whether it is complete
+func (mylet *Mylet) _StreamBackup(ctx *tiny.Context) {
+	t, err := ParseToken(ctx.Request.Header.Get("Token"))
+	if err != nil || mylet == nil || t.GroupToken != GroupToken(mylet.Mysql) {
+		ctx.Forbidden()
+		return
+	}
+
+	id, _ := ctx.First("session")
+	offset, n := ctx.FirstInt64("offset")
+	if n < 0 || offset < 0 {
+		ctx.BadRequest()
+		return
+	}
+
+	s, err := mylet.StreamSession(t.Name, id)
+	if err != nil {
+		if err == ErrStreamGone {
+			ctx.Error(http.StatusText(http.StatusGone), http.StatusGone)
+			return
+		}
+		log.Error("stream session", err)
+		ctx.Error(err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	compress.Off(ctx)
+	ctx.Header().Set(StreamSessionHeader, s.Id)
+	ctx.Header().Set("Trailer", StreamTrailer)
+	ctx.ContentDisposition(mylet.Spec.Name+".xbstream.zst", "")
+
+	err = s.Serve(ctx.Request.Context(), ctx, offset)
+	if err != nil {
+		log.Errorf("stream backup at %d: %v", offset, err)
+		if !ctx.WroteHeader() {
+			if err == ErrStreamGone {
+				ctx.Error(http.StatusText(http.StatusGone), http.StatusGone)
+			} else {
+				ctx.Error(err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		ctx.Header().Set(StreamTrailer, err.Error())
+		return
+	}
+	ctx.Header().Set(StreamTrailer, StreamOK)
+}
+
+// _CloneDonor prepares this solo as the donor of a clone
+func (mylet *Mylet) _CloneDonor(ctx *tiny.Context) {
+	t, err := ParseToken(ctx.Request.Header.Get("Token"))
+	if err != nil || mylet == nil || t.GroupToken != GroupToken(mylet.Mysql) {
+		ctx.Forbidden()
+		return
+	}
+
+	err = mylet.PrepareDonor()
+	if err == ErrCloneUnsupported {
+		// told apart like an older mylet, the recipient falls back to xtrabackup
+		ctx.NotFound()
+		return
+	}
+	if err != nil {
+		log.Error("prepare donor", err)
+		ctx.WriteError(err)
+		return
+	}
+	ctx.WriteData(true)
+}
+
+// _ApplyDatabase converges the schema of a MysqlDatabase, on the writer only
+func (mylet *Mylet) _ApplyDatabase(ctx *tiny.Context) {
+	t, err := ParseToken(ctx.Request.Header.Get("Token"))
+	if err != nil || mylet == nil || t.GroupToken != GroupToken(mylet.Mysql) || !t.Myctl {
+		ctx.Forbidden()
+		return
+	}
+
+	var r DatabaseRequest
+	if err = ctx.DecodeJSON(&r); err != nil {
+		ctx.BadRequest()
+		return
+	}
+
+	v, err := mylet.ApplyDatabase(r)
+	if err != nil {
+		log.Error("apply database", r.Name, err)
+		ctx.WriteError(err)
+		return
+	}
+	ctx.WriteData(v)
+}
+
+// _ApplyUser converges the account of a MysqlUser, on the writer only
+func (mylet *Mylet) _ApplyUser(ctx *tiny.Context) {
+	t, err := ParseToken(ctx.Request.Header.Get("Token"))
+	if err != nil || mylet == nil || t.GroupToken != GroupToken(mylet.Mysql) || !t.Myctl {
+		ctx.Forbidden()
+		return
+	}
+
+	var r UserRequest
+	if err = ctx.DecodeJSON(&r); err != nil {
+		ctx.BadRequest()
+		return
+	}
+
+	v, err := mylet.ApplyUser(r)
+	if err != nil {
+		log.Error("apply user", r.Username, err)
+		ctx.WriteError(err)
+		return
+	}
+	ctx.WriteData(v)
+}
+
+// _DownloadBinlogs streams a tarball of the binlogs closed since the time,
+// the active one is rotated first so the latest changes are included
+func (mylet *Mylet) _DownloadBinlogs(ctx *tiny.Context) {
+	t, err := ParseToken(ctx.Request.Header.Get("Token"))
+	if err != nil || mylet == nil || t.GroupToken != GroupToken(mylet.Mysql) {
+		ctx.Forbidden()
+		return
+	}
+
+	s, n := ctx.First("since")
+	if n != 1 {
+		ctx.BadRequest()
+		return
+	}
+	since, err := time.ParseInLocation(DatetimeLayout, s, time.Local)
+	if err != nil {
+		ctx.BadRequest()
+		return
+	}
+
+	if err = mylet.ArchiveBinlogs(mylet.ReadinessProbe); err != nil {
+		log.Error("archive binlogs", err)
+		ctx.InternalServerError()
+		return
+	}
+	if err = mylet.FetchRemoteBinlogs(since); err != nil {
+		log.Error("fetch remote binlogs", err)
+		ctx.InternalServerError()
+		return
+	}
+
+	a, err := mylet.GetArchivedBinlogs()
+	if err != nil {
+		log.Error("get archived binlogs", err)
+		ctx.InternalServerError()
+		return
+	}
+	args := []string{"-czf", "-"}
+	for _, b := range a {
+		if !b.ClosedTime.Before(since) {
+			args = append(args, filepath.Join(filepath.Base(mylet.BinlogDir()), b.Name))
+		}
+	}
+	if len(args) == 2 {
+		ctx.NotFound()
+		return
+	}
+	defer mylet.ReadBackup(filepath.Base(mylet.BinlogDir()))()
+	compress.Off(ctx)
+
+	k, err := mylet.BackupKey()
+	if err != nil {
+		log.Error("backup key", err)
+		ctx.InternalServerError()
+		return
+	}
+
+	cmd := exec.CommandContext(ctx.Request.Context(), "tar", args...)
+	cmd.Dir = mylet.BackupDir()
+	cmd.Stderr = os.Stderr
+
+	ctx.ContentDisposition(mylet.Spec.Name+".binlog."+s+CompressExt, "")
+	if k == nil {
+		cmd.Stdout = ctx
+		err = cmd.Run()
+	} else {
+		var w io.WriteCloser
+		if w, err = k.NewWriter(ctx); err == nil {
+			cmd.Stdout = w
+			err = cmd.Run()
+			if e := w.Close(); err == nil {
+				err = e
+			}
+		}
+	}
+	if err != nil {
+		log.Error("tar binlogs", err)
+	}
+}
+
 func (mylet *Mylet) _Backup(ctx *tiny.Context) {
 	t, err := ParseToken(ctx.Request.Header.Get("Token"))
 	if err != nil || mylet == nil || t.GroupToken != GroupToken(mylet.Mysql) {
@@ -416,6 +749,11 @@ func (mylet *Mylet) _Backup(ctx *tiny.Context) {
 		ctx.BadRequest()
 		return
 	}
+	verify, n := ctx.FirstBool("verify")
+	if n != 0 && n != 1 {
+		ctx.BadRequest()
+		return
+	}
 
 	var bt time.Time
 	var inc int
@@ -454,9 +792,23 @@ func (mylet *Mylet) _Backup(ctx *tiny.Context) {
 		}
 	}
 
+	d := mylet.GetBackupDir(bt)
+	piece := "base"
+	if inc > 0 {
+		piece = "inc" + strconv.Itoa(inc)
+	}
+	f := filepath.Join(d, piece)
+
+	// off the volume, the local backup is kept as well
+	location, err := mylet.UploadBackup(bt, piece)
+	if err != nil {
+		log.Error("upload backup", filepath.Base(d), piece, err)
+		ctx.WriteError(err)
+		return
+	}
+
 	if compress {
-		d := mylet.GetBackupDir(bt)
-		_, err = mylet.CompressBackup(d)
+		f, err = mylet.CompressBackup(d)
 		if err != nil {
 			log.Error("compress backup", filepath.Base(d), err)
 			ctx.WriteError(err)
@@ -464,13 +816,184 @@ func (mylet *Mylet) _Backup(ctx *tiny.Context) {
 		}
 	}
 
-	ctx.WriteData(tiny.M{
-		"BackupTime":  bt.Format(DatetimeLayout),
-		"Incremental": inc,
-		"Compress":    compress,
+	size, err := DirSize(f)
+	if err != nil {
+		log.Error("backup size", f, err)
+	}
+
+	// only the compressed archive and the uploaded object are sealed
+	var keyId string
+	if compress || location != "" {
+		if k, err := mylet.BackupKey(); err == nil && k != nil {
+			keyId = k.ID
+		}
+	}
+
+	pruned := mylet.EnforceRetention()
+
+	var verification *VerifyResult
+	if verify {
+		v, err := mylet.VerifyBackup(bt, inc)
+		if err != nil {
+			log.Error("verify backup", filepath.Base(d), inc, err)
+			v.Error = err.Error()
+		}
+		verification = &v
+	}
+
+	ctx.WriteData(BackupResult{
+		BackupTime:   bt.Format(DatetimeLayout),
+		Incremental:  inc,
+		Compress:     compress,
+		Size:         size,
+		Location:     location,
+		KeyId:        keyId,
+		Verification: verification,
+		Pruned:       pruned.Removed,
+		Reclaimed:    pruned.Reclaimed,
 	})
 }
 
+func (mylet *Mylet) _ListBackups(ctx *tiny.Context) {
+	t, err := ParseToken(ctx.Request.Header.Get("Token"))
+	if err != nil || mylet == nil || t.GroupToken != GroupToken(mylet.Mysql) {
+		ctx.Forbidden()
+		return
+	}
+
+	a, err := mylet.ListBackups(ctx.Request.Context())
+	if err != nil {
+		log.Error("list backups", err)
+		ctx.WriteError(err)
+		return
+	}
+	ctx.WriteData(a)
+}
+
+func (mylet *Mylet) _PruneBackups(ctx *tiny.Context) {
+	t, err := ParseToken(ctx.Request.Header.Get("Token"))
+	if err != nil || mylet == nil || t.GroupToken != GroupToken(mylet.Mysql) || !t.Myctl {
+		ctx.Forbidden()
+		return
+	}
+
+	keep, n := ctx.FirstInt("keep")
+	if n != 0 && n != 1 {
+		ctx.BadRequest()
+		return
+	}
+	maxAge, n := ctx.FirstInt("maxAge")
+	if n != 0 && n != 1 {
+		ctx.BadRequest()
+		return
+	}
+
+	maxBytes, n := ctx.FirstInt64("maxBytes")
+	if n != 0 && n != 1 {
+		ctx.BadRequest()
+		return
+	}
+	chains := ctx.Request.Form["chain"]
+	for _, s := range chains {
+		if _, err = time.ParseInLocation(DatetimeLayout, s, time.Local); err != nil {
+			ctx.BadRequest()
+			return
+		}
+	}
+
+	a, err := mylet.PruneBackups(Retention{
+		Keep:     keep,
+		MaxAge:   time.Duration(maxAge) * time.Second,
+		MaxBytes: maxBytes,
+		Chains:   chains,
+	})
+	if err != nil {
+		log.Error("prune backups", a.Removed, err)
+		ctx.WriteError(err)
+		return
+	}
+	ctx.WriteData(a)
+}
+
+// _VerifyBackup restores the chain in a throwaway mysqld, the latest one if no datetime,
+// up to the incremental, all if none
+func (mylet *Mylet) _VerifyBackup(ctx *tiny.Context) {
+	t, err := ParseToken(ctx.Request.Header.Get("Token"))
+	if err != nil || mylet == nil || t.GroupToken != GroupToken(mylet.Mysql) {
+		ctx.Forbidden()
+		return
+	}
+
+	var bt time.Time
+	s, n := ctx.First("datetime")
+	if n == 1 {
+		bt, err = time.ParseInLocation(DatetimeLayout, s, time.Local)
+		if err != nil {
+			ctx.BadRequest()
+			return
+		}
+	} else if n != 0 {
+		ctx.BadRequest()
+		return
+	}
+	inc, n := ctx.FirstInt("incremental")
+	if n == 0 {
+		inc = -1
+	} else if n != 1 {
+		ctx.BadRequest()
+		return
+	}
+
+	v, err := mylet.VerifyBackup(bt, inc)
+	if err != nil {
+		log.Error("verify backup", s, err)
+		ctx.WriteError(err)
+		return
+	}
+	ctx.WriteData(v)
+}
+
+func (mylet *Mylet) _Restore(ctx *tiny.Context) {
+	t, err := ParseToken(ctx.Request.Header.Get("Token"))
+	if err != nil || mylet == nil || t.GroupToken != GroupToken(mylet.Mysql) || !t.Myctl {
+		ctx.Forbidden()
+		return
+	}
+
+	var r RestoreRequest
+	if err = ctx.DecodeJSON(&r); err != nil || r.Name == "" {
+		ctx.BadRequest()
+		return
+	}
+
+	switch r.Action {
+	case RestoreStage:
+		mylet.Lock()
+		o := mylet.Restore.Staging
+		mylet.Unlock()
+		if o != "" {
+			ctx.WriteErrorf("staging: %s", o)
+			return
+		}
+
+		// observed by myctl from the reports
+		go func() {
+			if err := mylet.StageRestore(r); err != nil {
+				log.Errorf("[Restore] %s: %v", r.Name, err)
+			}
+		}()
+	case RestoreReseed:
+		if err = mylet.RequestReseed(r); err != nil {
+			ctx.WriteError(err.Error())
+			return
+		}
+	default:
+		ctx.WriteErrorf("restore action invalid: %s", r.Action)
+		return
+	}
+	ctx.WriteData(r.Action)
+}
+
 func (mylet *Mylet) _SwitchPrimary(ctx *tiny.Context) {
 	t, err := ParseToken(ctx.Request.Header.Get("Token"))
 	if err != nil || mylet == nil || t.GroupToken != GroupToken(mylet.Mysql) || !t.Myctl {
@@ -489,3 +1012,87 @@ func (mylet *Mylet) _SwitchPrimary(ctx *tiny.Context) {
 	}
 	ctx.WriteData(newId)
 }
+
+// _Fence sets the read only of the writer around a planned switchover
+func (mylet *Mylet) _Fence(ctx *tiny.Context) {
+	t, err := ParseToken(ctx.Request.Header.Get("Token"))
+	if err != nil || mylet == nil || t.GroupToken != GroupToken(mylet.Mysql) || !t.Myctl {
+		ctx.Forbidden()
+		return
+	}
+
+	var r FenceRequest
+	if err = ctx.DecodeJSON(&r); err != nil {
+		ctx.BadRequest()
+		return
+	}
+
+	result, err := mylet.Fence(r.ReadOnly)
+	if err != nil {
+		log.Error("fence", r.ReadOnly, err)
+		ctx.WriteError(err)
+		return
+	}
+	ctx.WriteData(result)
+}
+
+// _WaitGtid waits for the new primary of a planned switchover to apply the GTID set of the old one
+func (mylet *Mylet) _WaitGtid(ctx *tiny.Context) {
+	t, err := ParseToken(ctx.Request.Header.Get("Token"))
+	if err != nil || mylet == nil || t.GroupToken != GroupToken(mylet.Mysql) || !t.Myctl {
+		ctx.Forbidden()
+		return
+	}
+
+	var r WaitGtidRequest
+	if err = ctx.DecodeJSON(&r); err != nil || r.Gtid == "" || r.Timeout <= 0 {
+		ctx.BadRequest()
+		return
+	}
+
+	if err = mylet.WaitGtid(r); err != nil {
+		log.Error("wait gtid", err)
+		ctx.WriteError(err)
+		return
+	}
+	ctx.WriteData(true)
+}
+
+func (mylet *Mylet) _Convert(ctx *tiny.Context) {
+	t, err := ParseToken(ctx.Request.Header.Get("Token"))
+	if err != nil || mylet == nil || t.GroupToken != GroupToken(mylet.Mysql) || !t.Myctl {
+		ctx.Forbidden()
+		return
+	}
+
+	var r ConvertRequest
+	if err = ctx.DecodeJSON(&r); err != nil {
+		ctx.BadRequest()
+		return
+	}
+
+	mylet.Lock()
+	o := mylet.Converting
+	mylet.Unlock()
+	if o != "" {
+		ctx.WriteErrorf("converting: %s", o)
+		return
+	}
+
+	// the check is quick, the others are observed by myctl from the reports
+	if r.Action == ConvertCheck {
+		if err = mylet.Convert(r); err != nil {
+			ctx.WriteError(err.Error())
+			return
+		}
+		ctx.WriteData(r.Action)
+		return
+	}
+
+	go func() {
+		if err := mylet.Convert(r); err != nil {
+			log.Errorf("[Convert] %s: %v", r.Action, err)
+		}
+	}()
+	ctx.WriteData(r.Action)
+}
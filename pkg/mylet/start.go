@@ -215,7 +215,14 @@ func (mylet *Mylet) postStartChecks(cmd *exec.Cmd) error {
 		return err
 	}
 
-	if mylet.IsPrimary() {
+	if mylet.IsMember() {
+		err = mylet.SetupMember()
+		if err != nil {
+			log.Errorf("setup member: %v", err)
+			return err
+		}
+		log.Infof("start member mysqld %s, waiting for myctl to bootstrap or join", version)
+	} else if mylet.IsPrimary() {
 		err = mylet.SetupPrimary()
 		if err != nil {
 			log.Errorf("setup primary: %v", err)
@@ -26,11 +26,19 @@ type SizeSpec struct {
 type MysqlReport struct {
 	Name string
 	SizeSpec
-	States []json.RawMessage
+	States     []json.RawMessage
+	Lag        *int
+	ConfigHash string
+	Group      *GroupMember
+	// The last conversion action error, empty if it succeeded
+	ConvertError string
+	Restore      RestoreReport
 }
 type ReportResult struct {
 	ReceiveTime time.Time
 	SizeSpec
+	ConfigHash  string
+	GroupAction string
 }
 
 type StateKey struct {
@@ -105,6 +113,13 @@ func (let *Mylet) SendReport(ctx context.Context, r *MysqlReport) (ReportResult,
 }
 
 func (let *Mylet) Reload(ss SizeSpec) error {
+	if let.Mysql.Spec.PrimaryMode != ss.PrimaryMode ||
+		let.Mysql.Spec.Primaries != ss.Primaries {
+		// the topology is converted step by step by myctl
+		log.Infoln("primary mode or/and primaries changed, waiting for myctl to convert")
+		return nil
+	}
+
 	let.Mysql.Spec.AutoSwitch = pointer.Bool(ss.AutoSwitch)
 
 	if *let.Mysql.Spec.Replicas != ss.Replicas {
@@ -137,13 +152,6 @@ func (let *Mylet) Reload(ss SizeSpec) error {
 		}
 	}
 
-	if let.Mysql.Spec.PrimaryMode != ss.PrimaryMode ||
-		let.Mysql.Spec.Primaries != ss.Primaries {
-		log.Infoln("primary mode or/and primaries changed, restart")
-		let.ExitChan <- struct{}{} //TODO sts restart
-		return nil
-	}
-
 	if *let.Mysql.Spec.PrimaryId != ss.PrimaryId {
 		err := let.ChangePrimary(ss.PrimaryId)
 		log.ErrError(err, "change primary")
@@ -0,0 +1,355 @@
+package mylet
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erda-project/mysql-operator/pkg/crypt"
+	"github.com/erda-project/mysql-operator/pkg/s3"
+	log "github.com/sirupsen/logrus"
+)
+
+// Storage returns the client of the backup storage, nil if none
+func (mylet *Mylet) Storage() (*s3.Client, error) {
+	bs := mylet.Mysql.Spec.BackupStorage
+	if bs == nil {
+		return nil, nil
+	}
+	return s3.New(bs.Endpoint, bs.Region, bs.Bucket, bs.AccessKey, bs.SecretKey, bs.PathStyle)
+}
+
+/*
+prefix/namespace/name.date.time/
+
+	base.tar.gz
+	inc1.tar.gz
+	inc....tar.gz
+*/
+func (mylet *Mylet) RemotePrefix() string {
+	p := path.Join(mylet.Mysql.Spec.BackupStorage.Prefix, mylet.Mysql.Namespace, mylet.Spec.Name)
+	return strings.TrimPrefix(p, "/") + "."
+}
+func (mylet *Mylet) RemoteKey(t time.Time, piece string) string {
+	return mylet.RemotePrefix() + t.Format(DatetimeLayout) + "/" + piece + CompressExt
+}
+
+// cmdReader reads the stdout of the command, a failed command is the error at the end
+type cmdReader struct {
+	io.Reader
+	cmd *exec.Cmd
+}
+
+func (r *cmdReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		if e := r.cmd.Wait(); e != nil {
+			return n, e
+		}
+	}
+	return n, err
+}
+
+// UploadBackup streams the base or an incremental of the chain up to the backup storage,
+// each one is a tarball extracted into the chain directory, sealed if encrypted,
+// returns the location, empty if no backup storage
+func (mylet *Mylet) UploadBackup(t time.Time, piece string) (string, error) {
+	c, err := mylet.Storage()
+	if c == nil || err != nil {
+		return "", err
+	}
+	k, err := mylet.BackupKey()
+	if err != nil {
+		return "", err
+	}
+
+	o := mylet.LockBackup("upload backup")
+	if o != "" {
+		return "", fmt.Errorf("backing: %s", o)
+	}
+	defer mylet.UnlockBackup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), Hour8)
+	defer cancel()
+
+	dir := mylet.GetBackupDir(t)
+	key := mylet.RemoteKey(t, piece)
+
+	cmd := exec.CommandContext(ctx, "tar", "-czf", "-", filepath.Join(filepath.Base(dir), piece))
+	cmd.Dir = filepath.Dir(dir)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err = cmd.Start(); err != nil {
+		return "", err
+	}
+
+	log.Info("start upload backup", key)
+
+	var r io.Reader = &cmdReader{stdout, cmd}
+	if k != nil {
+		sr := k.SealReader(r)
+		defer sr.Close()
+		r = sr
+	}
+
+	loc, err := c.Upload(ctx, key, r)
+	if err != nil {
+		cancel()
+		cmd.Wait()
+		log.Error("end upload backup", key, err)
+		return "", err
+	}
+
+	log.Info("end upload backup", loc)
+	return loc, nil
+}
+
+// RemoteBackup is a chain in the backup storage
+type RemoteBackup struct {
+	BackupTime   time.Time
+	Incrementals []int
+	// Size in bytes of the tarballs
+	Size     int64
+	Location string
+}
+
+// GetRemoteBackups lists the chains of the solo in the backup storage, oldest first,
+// nil if no backup storage
+func (mylet *Mylet) GetRemoteBackups(ctx context.Context) ([]RemoteBackup, error) {
+	c, err := mylet.Storage()
+	if c == nil || err != nil {
+		return nil, err
+	}
+
+	prefix := mylet.RemotePrefix()
+	objects, err := c.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]*RemoteBackup)
+	base := make(map[string]bool)
+	for _, o := range objects {
+		s := strings.TrimPrefix(o.Key, prefix)
+		i := strings.IndexByte(s, '/')
+		if i == -1 || !strings.HasSuffix(s, CompressExt) {
+			continue
+		}
+		dt := s[:i]
+		t, err := time.ParseInLocation(DatetimeLayout, dt, time.Local)
+		if err != nil {
+			continue
+		}
+
+		b := m[dt]
+		if b == nil {
+			b = &RemoteBackup{
+				BackupTime: t,
+				Location:   c.Location(prefix + dt + "/"),
+			}
+			m[dt] = b
+		}
+		b.Size += o.Size
+
+		piece := strings.TrimSuffix(s[i+1:], CompressExt)
+		if piece == "base" {
+			base[dt] = true
+		} else if strings.HasPrefix(piece, "inc") {
+			n, err := strconv.Atoi(strings.TrimPrefix(piece, "inc"))
+			if err == nil && n > 0 {
+				b.Incrementals = append(b.Incrementals, n)
+			}
+		}
+	}
+
+	var a []RemoteBackup
+	for dt, b := range m {
+		if base[dt] {
+			sort.Ints(b.Incrementals)
+			a = append(a, *b)
+		}
+	}
+	sort.Slice(a, func(i, j int) bool {
+		return a[i].BackupTime.Before(a[j].BackupTime)
+	})
+	return a, nil
+}
+
+// DownloadRemoteBackup fetches the chain back from the backup storage into the backup directory,
+// the error is os.ErrNotExist if the chain is not there
+func (mylet *Mylet) DownloadRemoteBackup(t time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), Hour8)
+	defer cancel()
+
+	c, err := mylet.Storage()
+	if err != nil {
+		return err
+	}
+	k, err := mylet.BackupKey()
+	if err != nil {
+		return err
+	}
+	a, err := mylet.GetRemoteBackups(ctx)
+	if err != nil {
+		return err
+	}
+	i := sort.Search(len(a), func(i int) bool { return !a[i].BackupTime.Before(t) })
+	if i == len(a) || !a[i].BackupTime.Equal(t) {
+		return fmt.Errorf("remote backup %s: %w", t.Format(DatetimeLayout), os.ErrNotExist)
+	}
+
+	o := mylet.LockBackup("download backup")
+	if o != "" {
+		return fmt.Errorf("backing: %s", o)
+	}
+	defer mylet.UnlockBackup()
+
+	// not listed as a backup until complete
+	dir := mylet.GetBackupDir(t)
+	tmp := filepath.Join(filepath.Dir(dir), "cxrtmp."+filepath.Base(dir))
+	if err = os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(tmp, 0700); err != nil {
+		return err
+	}
+
+	pieces := []string{"base"}
+	for _, n := range a[i].Incrementals {
+		pieces = append(pieces, "inc"+strconv.Itoa(n))
+	}
+	for _, piece := range pieces {
+		key := mylet.RemoteKey(t, piece)
+		log.Info("download remote backup", key)
+		if err = extractObject(ctx, c, key, tmp, k); err != nil {
+			os.RemoveAll(tmp)
+			return err
+		}
+	}
+
+	return os.Rename(tmp, dir)
+}
+
+func extractObject(ctx context.Context, c *s3.Client, key, dir string, k *crypt.Key) error {
+	body, err := c.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	r, _, err := crypt.Open(body, k)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	cmd := exec.CommandContext(ctx, "tar", "-xzf", "-", "-C", dir, "--strip-components=1")
+	cmd.Stdin = r
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// BackupInfo is a chain listed by mylet, kept locally or shipped to the backup storage
+type BackupInfo struct {
+	BackupTime string
+	// The local directory and its incrementals
+	Local        bool
+	Incrementals []int
+	// The local tarball
+	Compressed bool
+	// Id of the key the local tarball is sealed with, empty if plain
+	KeyId string
+	// The last verification of the local chain, nil if never verified
+	Verification *VerifyResult
+	// GTID set of the local full backup
+	Gtid string
+	// How long the local full backup took, the chain is consistent at BackupTime plus Duration
+	Duration time.Duration
+
+	// Where the chain is shipped, empty if not
+	Location           string
+	RemoteIncrementals []int
+	RemoteSize         int64
+}
+
+// ListBackups merges the local chains and the ones in the backup storage, oldest first
+func (mylet *Mylet) ListBackups(ctx context.Context) ([]BackupInfo, error) {
+	m := make(map[string]*BackupInfo)
+	get := func(t time.Time) *BackupInfo {
+		dt := t.Format(DatetimeLayout)
+		v := m[dt]
+		if v == nil {
+			v = &BackupInfo{BackupTime: dt}
+			m[dt] = v
+		}
+		return v
+	}
+
+	a, err := mylet.GetBackups()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range a {
+		v := get(t)
+		v.Local = true
+		v.Incrementals, err = GetIncrementals(mylet.GetBackupDir(t))
+		if err != nil {
+			return nil, err
+		}
+		v.Verification, err = ReadVerifyResult(mylet.GetBackupDir(t))
+		if err != nil {
+			return nil, err
+		}
+		if s, err := ReadBackupGtid(filepath.Join(mylet.GetBackupDir(t), "base")); err == nil {
+			v.Gtid = s
+		}
+		if _, d, err := ReadBackupInfo(filepath.Join(mylet.GetBackupDir(t), "base")); err == nil {
+			v.Duration = d
+		}
+	}
+
+	a, err = mylet.GetCompresses()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range a {
+		v := get(t)
+		v.Compressed = true
+		v.KeyId, err = crypt.ReadKeyID(mylet.GetBackupDir(t) + CompressExt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	remotes, err := mylet.GetRemoteBackups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range remotes {
+		v := get(r.BackupTime)
+		v.Location = r.Location
+		v.RemoteIncrementals = r.Incrementals
+		v.RemoteSize = r.Size
+	}
+
+	list := make([]BackupInfo, 0, len(m))
+	for _, v := range m {
+		list = append(list, *v)
+	}
+	// the layout sorts by time
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].BackupTime < list[j].BackupTime
+	})
+	return list, nil
+}
@@ -0,0 +1,521 @@
+package mylet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/erda-project/mysql-operator/pkg/crypt"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// The trailer of the stream, ok or why xtrabackup failed
+	StreamTrailer = "Mylet-Stream"
+	StreamOK      = "ok"
+
+	// The header naming the stream session, passed back with the offset to resume
+	StreamSessionHeader = "Mylet-Stream-Session"
+
+	// The stream is buffered on the source in memory, never on the volume:
+	// StreamWindow behind the furthest offset served is kept to resume,
+	// xtrabackup waits when StreamAhead is not served yet
+	StreamWindow = 32 << 20
+	StreamAhead  = 8 << 20
+
+	// A stream without a receiver that long is given up
+	StreamIdle = 10 * time.Minute
+
+	// Reconnections in a row without progress before the receiver gives up
+	StreamRetries = 5
+)
+
+var (
+	// ErrStreamUnsupported is a source not streaming backups, an older mylet
+	ErrStreamUnsupported = errors.New("stream backup unsupported")
+	// ErrStreamGone is a stream to resume no longer held by the source
+	ErrStreamGone = errors.New("stream backup gone")
+)
+
+// The receiver waits that much more after each reconnection in a row
+var streamRetryDelay = Timeout5s
+
+// StreamBackup writes a full backup to w, xbstream compressed with zstd and sealed if encrypted,
+// the data is never written to the volume
+func (mylet *Mylet) StreamBackup(ctx context.Context, w io.Writer) (err error) {
+	k, err := mylet.BackupKey()
+	if err != nil {
+		return err
+	}
+
+	o := mylet.LockBackup("stream backup")
+	if o != "" {
+		return fmt.Errorf("backing: %s", o)
+	}
+	defer mylet.UnlockBackup()
+
+	// xtrabackup keeps its checkpoints there, the data goes to stdout
+	tmp := filepath.Join(mylet.BackupDir(), "cxrtmp.stream")
+	if err = os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(tmp, 0700); err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if k != nil {
+		var sw io.WriteCloser
+		if sw, err = k.NewWriter(w); err != nil {
+			return err
+		}
+		defer func() {
+			if e := sw.Close(); err == nil {
+				err = e
+			}
+		}()
+		w = sw
+	}
+
+	xb := exec.CommandContext(ctx, "xtrabackup",
+		"--defaults-file="+mylet.MyCnf(),
+
+		"--host=127.0.0.1",
+		"--port="+strconv.Itoa(mylet.Spec.Port),
+		"--user="+mylet.Mysql.Spec.LocalUsername,
+		"--password="+mylet.Mysql.Spec.LocalPassword+strconv.Itoa(mylet.Spec.Id),
+
+		"--backup",
+		"--stream=xbstream",
+		"--target-dir="+tmp,
+	)
+	xb.Stderr = os.Stderr
+
+	zstd := exec.CommandContext(ctx, "zstd", "-q", "-c", "-T0")
+	zstd.Stdout = w
+	zstd.Stderr = os.Stderr
+
+	if err = pipeCommands(xb, zstd); err != nil {
+		return err
+	}
+
+	log.Info("start stream backup", mylet.Spec.Name)
+	err = xb.Wait()
+	if e := zstd.Wait(); err == nil {
+		err = e
+	}
+	if err == nil {
+		log.Info("end stream backup", mylet.Spec.Name)
+	} else {
+		log.Error("end stream backup", mylet.Spec.Name, err)
+	}
+	return err
+}
+
+// pipeCommands starts the commands with the stdout of the first into the stdin of the second
+func pipeCommands(first, second *exec.Cmd) error {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	first.Stdout = pw
+	second.Stdin = pr
+
+	err = second.Start()
+	if err == nil {
+		err = first.Start()
+		if err != nil {
+			pw.Close()
+			second.Wait()
+		}
+	}
+	// held by the children
+	pw.Close()
+	pr.Close()
+	return err
+}
+
+// StreamSession is a stream backup in progress, kept in a window to serve again from an offset
+type StreamSession struct {
+	sync.Mutex
+	cond sync.Cond
+
+	Id   string
+	Name string // the solo receiving
+
+	base    int64 // the offset of buf[0]
+	buf     []byte
+	served  int64 // the furthest offset served
+	readers int
+	idle    time.Time // no receiver since
+
+	done    bool
+	err     error
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+func NewStreamSession(name string) *StreamSession {
+	s := &StreamSession{
+		Id:      strconv.FormatInt(time.Now().UnixNano(), 36),
+		Name:    name,
+		idle:    time.Now(),
+		stopped: make(chan struct{}),
+	}
+	s.cond.L = &s.Mutex
+	return s
+}
+
+// Write appends the stream, waits while too much is not served yet
+func (s *StreamSession) Write(p []byte) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for !s.done && s.base+int64(len(s.buf))-s.served >= StreamAhead {
+		s.cond.Wait()
+	}
+	if s.done {
+		return 0, s.err
+	}
+
+	s.buf = append(s.buf, p...)
+	if n := s.served - StreamWindow - s.base; n >= StreamWindow/4 {
+		s.buf = append([]byte(nil), s.buf[n:]...)
+		s.base += n
+	}
+	s.cond.Broadcast()
+	return len(p), nil
+}
+
+// finish ends the stream with err, nil if complete
+func (s *StreamSession) finish(err error) {
+	s.Lock()
+	if !s.done {
+		s.done = true
+		s.err = err
+		s.cond.Broadcast()
+	}
+	s.Unlock()
+}
+
+// Abort gives up the stream and waits for xtrabackup to stop
+func (s *StreamSession) Abort(err error) {
+	s.finish(err)
+	s.cancel()
+	<-s.stopped
+}
+
+// Finished returns whether the stream is complete or given up
+func (s *StreamSession) Finished() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.done
+}
+
+// Idle returns how long the stream has had no receiver
+func (s *StreamSession) Idle() time.Duration {
+	s.Lock()
+	defer s.Unlock()
+	if s.readers > 0 {
+		return 0
+	}
+	return time.Since(s.idle)
+}
+
+// ReadAt reads the stream at offset, waits for it to be written
+func (s *StreamSession) ReadAt(ctx context.Context, p []byte, offset int64) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for {
+		end := s.base + int64(len(s.buf))
+		if offset < s.base || offset > end {
+			return 0, ErrStreamGone
+		}
+		if offset < end {
+			n := copy(p, s.buf[offset-s.base:])
+			if offset+int64(n) > s.served {
+				s.served = offset + int64(n)
+				s.cond.Broadcast()
+			}
+			return n, nil
+		}
+		if s.done {
+			if s.err != nil {
+				return 0, s.err
+			}
+			return 0, io.EOF
+		}
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		s.cond.Wait()
+	}
+}
+
+// Serve writes the stream to w from offset until it is complete
+func (s *StreamSession) Serve(ctx context.Context, w io.Writer, offset int64) error {
+	s.Lock()
+	s.readers++
+	s.Unlock()
+	defer func() {
+		s.Lock()
+		s.readers--
+		s.idle = time.Now()
+		s.Unlock()
+	}()
+
+	// wakes up ReadAt when the receiver goes away
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Lock()
+			s.cond.Broadcast()
+			s.Unlock()
+		case <-stop:
+		}
+	}()
+
+	p := make([]byte, 32<<10)
+	for {
+		n, err := s.ReadAt(ctx, p, offset)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(p[:n]); err != nil {
+			return err
+		}
+		offset += int64(n)
+	}
+}
+
+// StreamSession returns the stream backup to the solo name to resume by id,
+// a new one is started without id, replacing the previous one to the same solo
+func (mylet *Mylet) StreamSession(name, id string) (*StreamSession, error) {
+	mylet.Lock()
+	s := mylet.stream
+	mylet.Unlock()
+
+	if id != "" {
+		if s == nil || s.Id != id || s.Name != name {
+			return nil, ErrStreamGone
+		}
+		return s, nil
+	}
+
+	if s != nil {
+		if s.Name != name && !s.Finished() {
+			return nil, fmt.Errorf("backing: stream backup to %s", s.Name)
+		}
+		s.Abort(errors.New("stream backup restarted"))
+	}
+
+	s = NewStreamSession(name)
+	ctx, cancel := context.WithTimeout(context.Background(), Hour8)
+	s.cancel = cancel
+
+	mylet.Lock()
+	mylet.stream = s
+	mylet.Unlock()
+
+	go func() {
+		defer close(s.stopped)
+		s.finish(mylet.StreamBackup(ctx, s))
+	}()
+
+	go func() {
+		defer cancel()
+
+		t := time.NewTicker(time.Minute)
+		defer t.Stop()
+	loop:
+		for {
+			select {
+			case <-ctx.Done():
+				break loop
+			case <-t.C:
+				if s.Idle() > StreamIdle {
+					log.Info("stream backup idle", name)
+					break loop
+				}
+			}
+		}
+		s.finish(errors.New("stream backup given up"))
+
+		mylet.Lock()
+		if mylet.stream == s {
+			mylet.stream = nil
+		}
+		mylet.Unlock()
+	}()
+
+	return s, nil
+}
+
+// streamReader reads the stream backup of a source, reconnecting at the offset read when interrupted
+type streamReader struct {
+	ctx      context.Context
+	u, token string
+
+	session string
+	offset  int64
+	res     *http.Response
+	fails   int
+	err     error // why it stopped, zstd only sees the input cut
+}
+
+func (r *streamReader) connect() error {
+	req, err := http.NewRequestWithContext(r.ctx, "GET", r.u, nil)
+	if err != nil {
+		return err
+	}
+
+	if r.token != "" {
+		req.Header.Set("Token", r.token)
+	}
+	if r.session != "" {
+		q := req.URL.Query()
+		q.Set("session", r.session)
+		q.Set("offset", strconv.FormatInt(r.offset, 10))
+		req.URL.RawQuery = q.Encode()
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		if r.session == "" {
+			r.session = res.Header.Get(StreamSessionHeader)
+		}
+		r.res = res
+		return nil
+	case http.StatusNotFound:
+		err = ErrStreamUnsupported
+	case http.StatusGone:
+		err = ErrStreamGone
+	default:
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		err = fmt.Errorf("status code %d: %s", res.StatusCode, bytes.TrimSpace(b))
+	}
+	res.Body.Close()
+	return err
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for {
+		var err error
+		if r.res == nil {
+			err = r.connect()
+			if err == ErrStreamUnsupported || err == ErrStreamGone {
+				r.err = err
+				return 0, err
+			}
+		}
+
+		n := 0
+		if err == nil {
+			n, err = r.res.Body.Read(p)
+			r.offset += int64(n)
+			if n > 0 {
+				r.fails = 0
+			}
+			if err == io.EOF {
+				// the trailer follows the body
+				s := r.res.Trailer.Get(StreamTrailer)
+				if s == StreamOK {
+					return n, io.EOF
+				}
+				if s != "" {
+					r.err = fmt.Errorf("stream backup failed: %s", s)
+					return n, r.err
+				}
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				r.res.Body.Close()
+				r.res = nil
+			}
+		}
+		if err == nil || n > 0 {
+			return n, nil
+		}
+
+		r.fails++
+		if r.ctx.Err() != nil || r.fails > StreamRetries || r.session == "" && r.offset > 0 {
+			r.err = err
+			return 0, err
+		}
+		log.Errorf("receive stream backup at %d: %v", r.offset, err)
+
+		select {
+		case <-r.ctx.Done():
+			r.err = r.ctx.Err()
+			return 0, r.err
+		case <-time.After(time.Duration(r.fails) * streamRetryDelay):
+		}
+	}
+}
+
+func (r *streamReader) Close() error {
+	if r.res != nil {
+		return r.res.Body.Close()
+	}
+	return nil
+}
+
+// FetchStream unpacks the streamed backup of the source into dir/base,
+// an interrupted stream is resumed where it stopped
+func FetchStream(ctx context.Context, u, token, dir string, k *crypt.Key) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	base := filepath.Join(dir, "base")
+	if err := os.MkdirAll(base, 0700); err != nil {
+		return err
+	}
+
+	sr := &streamReader{ctx: ctx, u: u, token: token}
+	defer sr.Close()
+
+	r, _, err := crypt.Open(sr, k)
+	if err != nil {
+		return err
+	}
+
+	zstd := exec.CommandContext(ctx, "zstd", "-q", "-d", "-c")
+	zstd.Stdin = r
+	zstd.Stderr = os.Stderr
+
+	xbstream := exec.CommandContext(ctx, "xbstream", "-x", "-C", base)
+	xbstream.Stdout = os.Stdout
+	xbstream.Stderr = os.Stderr
+
+	if err = pipeCommands(zstd, xbstream); err != nil {
+		return err
+	}
+	err = zstd.Wait()
+	if e := xbstream.Wait(); err == nil {
+		err = e
+	}
+	if sr.err != nil {
+		return sr.err
+	}
+	return err
+}
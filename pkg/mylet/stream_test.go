@@ -0,0 +1,200 @@
+package mylet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// streamServer serves one stream session the way _StreamBackup does,
+// the first connection is cut after cutAt bytes
+type streamServer struct {
+	t    *testing.T
+	data []byte
+
+	cutAt int64
+	// read ahead of the receiver before the cut, the bytes lost in flight
+	lost int64
+
+	mu       sync.Mutex
+	session  *StreamSession
+	requests []string
+}
+
+func (ss *streamServer) feed(s *StreamSession) {
+	var err error
+	for i := 0; i < len(ss.data) && err == nil; i += 64 << 10 {
+		j := i + 64<<10
+		if j > len(ss.data) {
+			j = len(ss.data)
+		}
+		_, err = s.Write(ss.data[i:j])
+	}
+	s.finish(err)
+}
+
+// cutWriter writes up to the limit, then cuts the connection
+type cutWriter struct {
+	w     http.ResponseWriter
+	limit int64
+	n     int64
+	cut   func()
+}
+
+func (cw *cutWriter) Write(p []byte) (int, error) {
+	if cw.n+int64(len(p)) < cw.limit {
+		cw.n += int64(len(p))
+		return cw.w.Write(p)
+	}
+	cw.w.Write(p[:cw.limit-cw.n])
+	cw.w.(http.Flusher).Flush()
+	cw.cut()
+	panic(http.ErrAbortHandler)
+}
+
+func (ss *streamServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("session")
+	offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+
+	ss.mu.Lock()
+	ss.requests = append(ss.requests, r.URL.RawQuery)
+	first := len(ss.requests) == 1
+	s := ss.session
+	if id == "" {
+		s = NewStreamSession("receiver")
+		ss.session = s
+		go ss.feed(s)
+	} else if s == nil || s.Id != id {
+		s = nil
+	}
+	ss.mu.Unlock()
+
+	if s == nil {
+		http.Error(w, http.StatusText(http.StatusGone), http.StatusGone)
+		return
+	}
+
+	w.Header().Set(StreamSessionHeader, s.Id)
+	w.Header().Set("Trailer", StreamTrailer)
+
+	var out io.Writer = w
+	if first && ss.cutAt > 0 {
+		out = &cutWriter{w: w, limit: ss.cutAt, cut: func() {
+			// the source served further than the receiver got
+			p := make([]byte, 64<<10)
+			for o := ss.cutAt; o < ss.cutAt+ss.lost; {
+				n, err := s.ReadAt(context.Background(), p, o)
+				if err != nil {
+					ss.t.Error(err)
+					return
+				}
+				o += int64(n)
+			}
+		}}
+	}
+
+	wrote := false
+	err := s.Serve(r.Context(), writerFunc(func(p []byte) (int, error) {
+		wrote = true
+		return out.Write(p)
+	}), offset)
+	if err != nil {
+		if !wrote && err == ErrStreamGone {
+			http.Error(w, http.StatusText(http.StatusGone), http.StatusGone)
+			return
+		}
+		w.Header().Set(StreamTrailer, err.Error())
+		return
+	}
+	w.Header().Set(StreamTrailer, StreamOK)
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func newStreamServer(t *testing.T, size int, cutAt, lost int64) (*streamServer, *streamReader) {
+	old := streamRetryDelay
+	streamRetryDelay = time.Millisecond
+	t.Cleanup(func() { streamRetryDelay = old })
+
+	ss := &streamServer{
+		t:     t,
+		data:  make([]byte, size),
+		cutAt: cutAt,
+		lost:  lost,
+	}
+	rand.New(rand.NewSource(int64(size))).Read(ss.data)
+
+	server := httptest.NewServer(ss)
+	t.Cleanup(server.Close)
+
+	return ss, &streamReader{ctx: context.Background(), u: server.URL + "/stream"}
+}
+
+func TestStreamResume(t *testing.T) {
+	cutAt := int64(3<<20 + 12345)
+	ss, sr := newStreamServer(t, 6<<20, cutAt, 0)
+	defer sr.Close()
+
+	got, err := io.ReadAll(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, ss.data) {
+		t.Fatalf("received %d bytes, not the %d streamed", len(got), len(ss.data))
+	}
+
+	if len(ss.requests) != 2 {
+		t.Fatalf("requests %v, want a resume", ss.requests)
+	}
+	want := "offset=" + strconv.FormatInt(cutAt, 10) + "&session=" + ss.session.Id
+	if ss.requests[0] != "" || ss.requests[1] != want {
+		t.Fatalf("requests %v, want the resume %s", ss.requests, want)
+	}
+}
+
+func TestStreamGone(t *testing.T) {
+	// the source served past the window of the receiver before the cut,
+	// the window slides as more is written
+	cutAt := int64(1 << 20)
+	lost := int64(StreamWindow + StreamWindow/4 + 2<<20)
+	_, sr := newStreamServer(t, int(cutAt+lost+2*StreamAhead), cutAt, lost)
+	defer sr.Close()
+
+	n, err := io.Copy(io.Discard, sr)
+	if !errors.Is(err, ErrStreamGone) {
+		t.Fatalf("read %d bytes, error %v, want %v", n, err, ErrStreamGone)
+	}
+	if n != cutAt {
+		t.Fatalf("read %d bytes before the cut, want %d", n, cutAt)
+	}
+}
+
+func TestStreamSessionLost(t *testing.T) {
+	ss, sr := newStreamServer(t, 2<<20, 1<<20, 0)
+	defer sr.Close()
+
+	// the source restarted
+	buf := make([]byte, 1<<20)
+	if _, err := io.ReadFull(sr, buf); err != nil {
+		t.Fatal(err)
+	}
+	ss.mu.Lock()
+	ss.session = nil
+	ss.mu.Unlock()
+
+	if _, err := io.Copy(io.Discard, sr); !errors.Is(err, ErrStreamGone) {
+		t.Fatalf("error %v, want %v", err, ErrStreamGone)
+	}
+}
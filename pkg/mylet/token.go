@@ -1,8 +1,6 @@
 package mylet
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
 	"strconv"
 	"strings"
@@ -74,5 +72,5 @@ func SoloToken(mysql *v1.Mysql, name string) string {
 	return name + ":" + strconv.FormatInt(RandId, 36) + "@" + GroupToken(mysql)
 }
 func GroupToken(mysql *v1.Mysql) string {
-	return hex.EncodeToString(sha256.New().Sum([]byte(mysql.Spec.LocalUsername + ":" + mysql.Spec.LocalPassword + "@" + mysql.Name)))
+	return mysql.Spec.GroupToken
 }
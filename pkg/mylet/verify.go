@@ -0,0 +1,308 @@
+package mylet
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// The verification of the chain, in the chain directory
+	VerifyFilename = "mylet_verify"
+	// Tables sampled for CHECK TABLE
+	VerifySample = 10
+)
+
+// VerifyResult is the chain restored in a throwaway mysqld
+type VerifyResult struct {
+	BackupTime string
+	// The last incremental applied, 0 for the full backup only
+	Incremental int
+	VerifyTime  time.Time
+	Verified    bool
+	// Why the chain is not restorable
+	Error string `json:",omitempty"`
+
+	Gtid    string
+	Schemas int
+	Tables  int
+	// The tables passing CHECK TABLE
+	Checked []string
+}
+
+func (mylet *Mylet) VerifyDir() string {
+	return mylet.DataDir() + ".verify"
+}
+
+// ReadVerifyResult reads the last verification of the chain, nil if never verified
+func ReadVerifyResult(dir string) (*VerifyResult, error) {
+	b, err := os.ReadFile(filepath.Join(dir, VerifyFilename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var v VerifyResult
+	if err = json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// VerifyBackup proves the chain restorable: a copy is prepared up to the incremental, all if negative,
+// a throwaway mysqld is started on it and the data checked, the latest chain if the time is zero.
+// The result is recorded in the chain, the error is returned only if the chain could not be tried
+func (mylet *Mylet) VerifyBackup(t time.Time, last int) (VerifyResult, error) {
+	if t.IsZero() {
+		a, err := mylet.GetBackups()
+		if err != nil {
+			return VerifyResult{}, err
+		}
+		if len(a) == 0 {
+			return VerifyResult{}, fmt.Errorf("no backups")
+		}
+		t = a[len(a)-1]
+	}
+
+	dir := mylet.GetBackupDir(t)
+	defer mylet.ReadBackup(filepath.Base(dir))()
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		// shipped to the backup storage and gone locally
+		if err = mylet.DownloadRemoteBackup(t); err != nil {
+			return VerifyResult{}, err
+		}
+	}
+	a, err := GetIncrementals(dir)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+	if last < 0 && len(a) > 0 {
+		last = a[len(a)-1]
+	} else if last > 0 && !containsInt(a, last) {
+		return VerifyResult{}, fmt.Errorf("incremental %d not found", last)
+	} else if last < 0 {
+		last = 0
+	}
+
+	mylet.Lock()
+	o := mylet.Verifying
+	if o == "" {
+		mylet.Verifying = filepath.Base(dir)
+	}
+	mylet.Unlock()
+	if o != "" {
+		return VerifyResult{}, fmt.Errorf("verifying: %s", o)
+	}
+	defer func() {
+		mylet.Lock()
+		mylet.Verifying = ""
+		mylet.Unlock()
+	}()
+
+	r := VerifyResult{
+		BackupTime:  t.Format(DatetimeLayout),
+		Incremental: last,
+		VerifyTime:  time.Now(),
+	}
+	log.Info("verify backup", filepath.Base(dir), last)
+	err = mylet.verifyBackup(dir, &r)
+	r.Verified = err == nil
+	if err != nil {
+		r.Error = err.Error()
+		log.Error("verify backup", filepath.Base(dir), last, err)
+	} else {
+		log.Info("backup verified", filepath.Base(dir), last, "tables", r.Tables)
+	}
+
+	b, err := json.Marshal(r)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, VerifyFilename), b, 0644)
+	}
+	return r, err
+}
+
+func containsInt(a []int, i int) bool {
+	for _, v := range a {
+		if v == i {
+			return true
+		}
+	}
+	return false
+}
+
+func (mylet *Mylet) verifyBackup(dir string, r *VerifyResult) error {
+	scratch := mylet.VerifyDir()
+	if err := os.RemoveAll(scratch); err != nil {
+		return err
+	}
+	defer os.RemoveAll(scratch)
+
+	ctx, cancel := context.WithTimeout(context.Background(), Hour8)
+	defer cancel()
+
+	// prepared in place, so on a copy
+	cmd := exec.CommandContext(ctx, "cp", "-a", dir, scratch)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("copy backup: %w", err)
+	}
+
+	if err := mylet.PrepareBackupUpTo(mylet.Spec.Id, scratch, r.Incremental); err != nil {
+		return fmt.Errorf("prepare backup: %w", err)
+	}
+
+	piece := "base"
+	if r.Incremental > 0 {
+		piece = "inc" + strconv.Itoa(r.Incremental)
+	}
+	gtid, err := ReadBackupGtid(filepath.Join(scratch, piece))
+	if err != nil {
+		return fmt.Errorf("read gtid: %w", err)
+	}
+	if gtid == "" {
+		return fmt.Errorf("read gtid: empty")
+	}
+	r.Gtid = gtid
+
+	return mylet.checkBackup(filepath.Join(scratch, "base"), r)
+}
+
+// checkBackup starts mysqld on the prepared datadir, the grant tables skipped as it is local only,
+// counts the tables and checks a sample
+func (mylet *Mylet) checkBackup(datadir string, r *VerifyResult) error {
+	ctx, cancel := context.WithTimeout(context.Background(), Hour8)
+	defer cancel()
+
+	socket := filepath.Join(datadir, mylet.Spec.Name+".sock")
+	cmd := mylet.Mysqld(ctx,
+		"--datadir="+datadir,
+		"--skip-networking",
+		"--skip-grant-tables",
+		"--super_read_only=OFF",
+		"--read_only=OFF",
+		// beside the running mysqld
+		"--innodb_buffer_pool_size=134217728",
+	)
+
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := cmd.Process.Signal(syscall.SIGTERM)
+		if err != nil {
+			log.Error("stop verify mysqld", err)
+		}
+		err = cmd.Wait()
+		if err != nil {
+			log.Error("wait verify mysqld", err)
+		}
+	}()
+
+	dsn := fmt.Sprintf("root:@unix(%s)/mysql", socket)
+	db, err := Open(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for i := 1; i <= 10; i++ {
+		log.Info("ping verify mysqld sleep 5 seconds", i)
+		time.Sleep(Timeout5s)
+
+		func() {
+			ctx, cancel := context.WithTimeout(ctx, Timeout5s)
+			defer cancel()
+			err = db.PingContext(ctx)
+		}()
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("start mysqld: %w", err)
+	}
+
+	const where = " FROM information_schema.TABLES WHERE TABLE_TYPE = 'BASE TABLE'" +
+		" AND TABLE_SCHEMA NOT IN ('mysql', 'sys', 'information_schema', 'performance_schema')"
+
+	err = db.QueryRowContext(ctx, "SELECT COUNT(DISTINCT TABLE_SCHEMA), COUNT(*)"+where).Scan(&r.Schemas, &r.Tables)
+	if err != nil {
+		return fmt.Errorf("count tables: %w", err)
+	}
+
+	tables := []string{"`mysql`.`user`"}
+	rows, err := db.QueryContext(ctx, "SELECT TABLE_SCHEMA, TABLE_NAME"+where+" ORDER BY RAND() LIMIT "+strconv.Itoa(VerifySample))
+	if err != nil {
+		return fmt.Errorf("sample tables: %w", err)
+	}
+	for rows.Next() {
+		var schema, table string
+		if err = rows.Scan(&schema, &table); err != nil {
+			rows.Close()
+			return fmt.Errorf("sample tables: %w", err)
+		}
+		tables = append(tables, QuoteName(schema)+"."+QuoteName(table))
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("sample tables: %w", err)
+	}
+
+	for _, table := range tables {
+		if err = checkTable(ctx, db, table); err != nil {
+			return err
+		}
+		r.Checked = append(r.Checked, table)
+	}
+	return nil
+}
+
+// checkTable fails on an error row or a final status other than OK
+func checkTable(ctx context.Context, db *sql.DB, table string) error {
+	rows, err := db.QueryContext(ctx, "CHECK TABLE "+table)
+	if err != nil {
+		return fmt.Errorf("check table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	status := ""
+	for rows.Next() {
+		var name, op, typ, text string
+		if err = rows.Scan(&name, &op, &typ, &text); err != nil {
+			return fmt.Errorf("check table %s: %w", table, err)
+		}
+		switch strings.ToLower(typ) {
+		case "error":
+			return fmt.Errorf("check table %s: %s", table, text)
+		case "status":
+			status = text
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("check table %s: %w", table, err)
+	}
+	if status != "OK" {
+		return fmt.Errorf("check table %s: %s", table, status)
+	}
+	return nil
+}
+
+// QuoteName quotes the identifier with backticks
+func QuoteName(s string) string {
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
@@ -0,0 +1,388 @@
+// Package s3 speaks the subset of the S3 API the backups need, signed with AWS Signature Version 4,
+// it works with AWS S3 and the compatible stores like MinIO.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPartSize = 32 << 20
+	// The part size doubles every 1000 parts up to MaxPartSize,
+	// from the default it bounds an object of 10000 parts to about 2TiB
+	MaxPartSize    = 256 << 20
+	MaxParts       = 10000
+	PartsPerGrowth = 1000
+)
+
+// sha256 of the empty payload
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+type Client struct {
+	Endpoint  *url.URL
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// The bucket in the path instead of the host, MinIO needs it
+	PathStyle bool
+
+	PartSize   int
+	HTTPClient *http.Client
+}
+
+// New returns a client of the bucket, the endpoint is https if no scheme is given
+func New(endpoint, region, bucket, accessKey, secretKey string, pathStyle bool) (*Client, error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("endpoint host required")
+	}
+	if bucket == "" {
+		return nil, fmt.Errorf("bucket required")
+	}
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("credentials required")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &Client{
+		Endpoint:   u,
+		Region:     region,
+		Bucket:     bucket,
+		AccessKey:  accessKey,
+		SecretKey:  secretKey,
+		PathStyle:  pathStyle,
+		PartSize:   DefaultPartSize,
+		HTTPClient: http.DefaultClient,
+	}, nil
+}
+
+// Error is returned by the store
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("s3 status code %d, %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && (e.StatusCode == http.StatusNotFound || e.Code == "NoSuchKey")
+}
+
+// Location is where the key is stored
+func (c *Client) Location(key string) string {
+	return "s3://" + c.Bucket + "/" + key
+}
+
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// List returns the objects under the prefix, all pages
+func (c *Client) List(ctx context.Context, prefix string) ([]Object, error) {
+	var a []Object
+	token := ""
+	for {
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("prefix", prefix)
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		var v struct {
+			Contents              []Object
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		if err := c.doXML(ctx, "GET", "", q, nil, &v); err != nil {
+			return nil, err
+		}
+		a = append(a, v.Contents...)
+
+		if !v.IsTruncated || v.NextContinuationToken == "" {
+			return a, nil
+		}
+		token = v.NextContinuationToken
+	}
+}
+
+// Get returns the object body, close it after reading
+func (c *Client) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	res, err := c.do(ctx, "GET", key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (c *Client) Delete(ctx context.Context, key string) error {
+	res, err := c.do(ctx, "DELETE", key, nil, nil)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// Upload streams the reader up with a multipart upload, the size needs not be known,
+// the parts grow with the object, the upload is aborted if the reader fails
+// or the object needs more than MaxParts, returns the location
+func (c *Client) Upload(ctx context.Context, key string, r io.Reader) (string, error) {
+	q := url.Values{}
+	q.Set("uploads", "")
+	var v struct {
+		UploadId string
+	}
+	if err := c.doXML(ctx, "POST", key, q, nil, &v); err != nil {
+		return "", err
+	}
+
+	err := c.upload(ctx, key, v.UploadId, r)
+	if err != nil {
+		// the context may be done, abort anyway
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		q := url.Values{}
+		q.Set("uploadId", v.UploadId)
+		if res, e := c.do(ctx, "DELETE", key, q, nil); e == nil {
+			res.Body.Close()
+		}
+		return "", err
+	}
+
+	return c.Location(key), nil
+}
+
+type completedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+func (c *Client) upload(ctx context.Context, key, uploadId string, r io.Reader) error {
+	size := c.PartSize
+	if size <= 0 {
+		size = DefaultPartSize
+	}
+	buf := make([]byte, size)
+
+	var parts []completedPart
+	for n := 1; ; n++ {
+		if n > 1 && (n-1)%PartsPerGrowth == 0 && size < MaxPartSize {
+			size *= 2
+			if size > MaxPartSize {
+				size = MaxPartSize
+			}
+			buf = make([]byte, size)
+		}
+
+		m, err := io.ReadFull(r, buf)
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return err
+		}
+		// an empty object is an empty part
+		if m == 0 && n > 1 {
+			break
+		}
+		if n > MaxParts {
+			return fmt.Errorf("object %s larger than %d parts", key, MaxParts)
+		}
+
+		q := url.Values{}
+		q.Set("partNumber", strconv.Itoa(n))
+		q.Set("uploadId", uploadId)
+		res, err := c.do(ctx, "PUT", key, q, buf[:m])
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		parts = append(parts, completedPart{n, res.Header.Get("ETag")})
+
+		if last {
+			break
+		}
+	}
+
+	var complete struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}
+	complete.Parts = parts
+	b, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+
+	q := url.Values{}
+	q.Set("uploadId", uploadId)
+	// the completion may fail with a 200 and an error body
+	var v struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	if err = c.doXML(ctx, "POST", key, q, b, &v); err != nil {
+		return err
+	}
+	if v.XMLName.Local == "Error" {
+		return &Error{http.StatusOK, v.Code, v.Message}
+	}
+	return nil
+}
+
+func (c *Client) doXML(ctx context.Context, method, key string, q url.Values, body []byte, v interface{}) error {
+	res, err := c.do(ctx, method, key, q, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return xml.NewDecoder(res.Body).Decode(v)
+}
+
+// do sends the signed request, a status code other than 2xx is an *Error
+func (c *Client) do(ctx context.Context, method, key string, q url.Values, body []byte) (*http.Response, error) {
+	u := *c.Endpoint
+	p := strings.TrimSuffix(u.Path, "/")
+	if c.PathStyle {
+		p += "/" + c.Bucket
+	} else {
+		u.Host = c.Bucket + "." + u.Host
+	}
+	if key != "" {
+		p += "/" + key
+	}
+	if p == "" {
+		p = "/"
+	}
+	u.Path = p
+	u.RawPath = escape(p, false)
+	u.RawQuery = canonicalQuery(q)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	hash := emptyHash
+	if len(body) > 0 {
+		h := sha256.Sum256(body)
+		hash = hex.EncodeToString(h[:])
+	}
+	c.sign(req, hash, time.Now())
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 != 2 {
+		defer res.Body.Close()
+		e := &Error{StatusCode: res.StatusCode}
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+		if xml.Unmarshal(b, e) != nil || e.Code == "" {
+			e.Code = http.StatusText(res.StatusCode)
+			e.Message = string(b)
+		}
+		return nil, e
+	}
+	return res, nil
+}
+
+func (c *Client) sign(req *http.Request, hash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + hash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		hash,
+	}, "\n")
+
+	scope := date + "/" + c.Region + "/s3/aws4_request"
+	h := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(h[:])
+
+	k := hmacSHA256([]byte("AWS4"+c.SecretKey), date)
+	k = hmacSHA256(k, c.Region)
+	k = hmacSHA256(k, "s3")
+	k = hmacSHA256(k, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(k, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// canonicalQuery sorts and escapes the query the way it is signed
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var a []string
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			a = append(a, escape(k, true)+"="+escape(v, true))
+		}
+	}
+	return strings.Join(a, "&")
+}
+
+// escape keeps the unreserved characters only, and the slashes out of the query
+func escape(s string, query bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !query {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}